@@ -2,34 +2,274 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"expvar"
+	"flag"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/auth/jwt"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/auth/local"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/blob/disk"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/blob/s3"
 	"github.com/Wyydra/ya/backend/internal/adapter/driven/gateway/ws"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/media/imaging"
 	"github.com/Wyydra/ya/backend/internal/adapter/driven/media/pion"
-	repo "github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/memory"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/memory"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/postgres"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/sqlite"
 	handler "github.com/Wyydra/ya/backend/internal/adapter/driving/http"
+	"github.com/Wyydra/ya/backend/internal/core/port"
 	"github.com/Wyydra/ya/backend/internal/core/service"
 	"github.com/rs/zerolog"
 )
 
 const PORT = ":8080"
 
+var (
+	storeFlag   = flag.String("store", "memory", "message store: memory, sqlite or postgres")
+	sqlitePath  = flag.String("sqlite-path", "ya.db", "database file used by the sqlite store")
+	postgresDSN = flag.String("postgres-dsn", os.Getenv("YA_POSTGRES_DSN"), "connection string used by the postgres store")
+
+	adminAddr = flag.String("admin-addr", "localhost:9090", "address serving /metrics, keep it private; empty disables it")
+
+	jwtSecret   = flag.String("jwt-secret", os.Getenv("YA_JWT_SECRET"), "HMAC secret used to sign and verify local tokens")
+	jwksPath    = flag.String("jwks", "", "JSON Web Key Set file of an external identity provider")
+	jwtIssuer   = flag.String("jwt-issuer", "", "required token issuer (iss)")
+	jwtAudience = flag.String("jwt-audience", "", "required token audience (aud)")
+	usersFile   = flag.String("users-file", "", "htpasswd-style file (username:bcrypt) enabling password login")
+
+	wsQueueSize    = flag.Int("ws-queue-size", handler.DefaultWSConfig().QueueSize, "outbound frames buffered per WebSocket client")
+	wsOverflow     = flag.String("ws-overflow", string(handler.DefaultWSConfig().Overflow), "what to do when a client's queue is full: drop-oldest or disconnect")
+	wsWriteTimeout = flag.Duration("ws-write-timeout", handler.DefaultWSConfig().WriteTimeout, "deadline for writing a single frame to a client")
+	wsPing         = flag.Duration("ws-ping-interval", handler.DefaultWSConfig().PingInterval, "how often WebSocket clients are pinged")
+	wsPongTimeout  = flag.Duration("ws-pong-timeout", handler.DefaultWSConfig().PongTimeout, "silence after which a WebSocket client is considered dead")
+
+	hubQueueSize      = flag.Int("hub-queue-size", ws.DefaultHubConfig().QueueSize, "messages buffered between the services and the hub")
+	hubEnqueueTimeout = flag.Duration("hub-enqueue-timeout", ws.DefaultHubConfig().EnqueueTimeout, "how long sending waits for room in a full hub queue before failing")
+
+	blobFlag    = flag.String("blob-store", "disk", "attachment store: disk or s3")
+	blobDir     = flag.String("blob-dir", "blobs", "directory used by the disk blob store")
+	blobSecret  = flag.String("blob-secret", os.Getenv("YA_BLOB_SECRET"), "HMAC secret signing download URLs of the disk blob store")
+	s3Endpoint  = flag.String("s3-endpoint", "", "host[:port] of the S3-compatible service")
+	s3Bucket    = flag.String("s3-bucket", "", "bucket used by the s3 blob store")
+	s3Region    = flag.String("s3-region", "", "region of the bucket")
+	s3AccessKey = flag.String("s3-access-key", os.Getenv("YA_S3_ACCESS_KEY"), "access key of the s3 blob store")
+	s3SecretKey = flag.String("s3-secret-key", os.Getenv("YA_S3_SECRET_KEY"), "secret key of the s3 blob store")
+	s3Insecure  = flag.Bool("s3-insecure", false, "talk plain HTTP to the S3-compatible service, e.g. a local MinIO")
+
+	attachmentMaxSize  = flag.Int64("attachment-max-size", service.DefaultAttachmentConfig().MaxSize, "maximum size of an attachment, in bytes")
+	attachmentMaxFiles = flag.Int("attachment-max-files", service.DefaultAttachmentConfig().MaxFiles, "maximum number of attachments per message")
+	attachmentTypes    = flag.String("attachment-types", strings.Join(service.DefaultAttachmentConfig().Types, ","), "comma-separated media types allowed as attachments, e.g. image/*,application/pdf")
+	attachmentURLTTL   = flag.Duration("attachment-url-ttl", service.DefaultAttachmentConfig().URLTTL, "how long attachment download URLs stay valid")
+	thumbnailSize      = flag.Int("thumbnail-size", imaging.DefaultThumbnailSize, "longest side of image thumbnails, in pixels")
+)
+
+const localTokenTTL = 24 * time.Hour
+
+type repositories struct {
+	messages  port.MessageRepository
+	users     port.UserRepository
+	rooms     port.RoomRepository
+	markers   port.ReadMarkerRepository
+	reactions port.ReactionRepository
+}
+
+// openStore builds the repositories of the store selected by -store. The
+// returned func releases the underlying connection.
+func openStore(l zerolog.Logger) (repositories, func()) {
+	switch *storeFlag {
+	case "memory":
+		return repositories{
+			messages:  memory.NewMessageRepository(),
+			users:     memory.NewUserRepository(),
+			rooms:     memory.NewRoomRepository(),
+			markers:   memory.NewReadMarkerRepository(),
+			reactions: memory.NewReactionRepository(),
+		}, func() {}
+	case "sqlite":
+		db, err := sqlite.Open(context.Background(), *sqlitePath)
+		if err != nil {
+			l.Fatal().Err(err).Str("path", *sqlitePath).Msg("Failed to open sqlite database")
+		}
+		return repositories{
+			messages:  sqlite.NewMessageRepository(db),
+			users:     sqlite.NewUserRepository(db),
+			rooms:     sqlite.NewRoomRepository(db),
+			markers:   sqlite.NewReadMarkerRepository(db),
+			reactions: sqlite.NewReactionRepository(db),
+		}, func() { db.Close() }
+	case "postgres":
+		pool, err := postgres.Open(context.Background(), *postgresDSN)
+		if err != nil {
+			l.Fatal().Err(err).Msg("Failed to connect to postgres")
+		}
+		return repositories{
+			messages:  postgres.NewMessageRepository(pool),
+			users:     postgres.NewUserRepository(pool),
+			rooms:     postgres.NewRoomRepository(pool),
+			markers:   postgres.NewReadMarkerRepository(pool),
+			reactions: postgres.NewReactionRepository(pool),
+		}, pool.Close
+	}
+	l.Fatal().Str("store", *storeFlag).Msg("Unknown store")
+	return repositories{}, nil
+}
+
+// buildAuth wires the authentication providers selected by flags. With no
+// key configured the server runs unauthenticated. Password login checks the
+// users file when given, registered accounts otherwise; the returned hasher
+// is nil unless registration is possible.
+func buildAuth(l zerolog.Logger, users port.UserRepository) (handler.AuthConfig, port.PasswordHasher) {
+	var (
+		cfg    handler.AuthConfig
+		hasher port.PasswordHasher
+	)
+
+	keys := jwt.NewKeySet()
+	if *jwksPath != "" {
+		if err := keys.LoadJWKS(*jwksPath); err != nil {
+			l.Fatal().Err(err).Msg("Failed to load JWKS")
+		}
+	}
+	if *jwtSecret != "" {
+		keys.AddSecret("local", []byte(*jwtSecret))
+		cfg.Issuer = jwt.NewIssuer("local", []byte(*jwtSecret), *jwtIssuer, localTokenTTL)
+	}
+
+	switch {
+	case *usersFile != "":
+		if cfg.Issuer == nil {
+			l.Fatal().Msg("-users-file requires -jwt-secret to sign login tokens")
+		}
+		store, err := local.LoadFile(*usersFile)
+		if err != nil {
+			l.Fatal().Err(err).Msg("Failed to load users file")
+		}
+		cfg.Passwords = local.NewProvider(store)
+	case cfg.Issuer != nil:
+		provider := local.NewProvider(users)
+		cfg.Passwords = provider
+		hasher = provider
+	}
+
+	if keys.Len() == 0 {
+		l.Warn().Msg("No JWT keys configured, authentication is DISABLED")
+		return cfg, hasher
+	}
+	cfg.Verifier = jwt.NewVerifier(keys, jwt.Config{Issuer: *jwtIssuer, Audience: *jwtAudience})
+	return cfg, hasher
+}
+
+// openBlobStore builds the store selected by -blob-store. The returned
+// handler serves its signed URLs under /blobs/, nil when the store serves
+// them itself.
+func openBlobStore(l zerolog.Logger) (port.BlobStore, http.Handler) {
+	switch *blobFlag {
+	case "disk":
+		secret := []byte(*blobSecret)
+		if len(secret) == 0 {
+			l.Warn().Msg("No -blob-secret configured, download URLs will not survive a restart")
+			secret = make([]byte, 32)
+			rand.Read(secret)
+		}
+		store, err := disk.NewStore(*blobDir, "/blobs", secret)
+		if err != nil {
+			l.Fatal().Err(err).Str("dir", *blobDir).Msg("Failed to open blob directory")
+		}
+		return store, store
+	case "s3":
+		store, err := s3.NewStore(context.Background(), s3.Config{
+			Endpoint:  *s3Endpoint,
+			Bucket:    *s3Bucket,
+			Region:    *s3Region,
+			AccessKey: *s3AccessKey,
+			SecretKey: *s3SecretKey,
+			Insecure:  *s3Insecure,
+		})
+		if err != nil {
+			l.Fatal().Err(err).Msg("Failed to connect to the blob store")
+		}
+		return store, nil
+	}
+	l.Fatal().Str("store", *blobFlag).Msg("Unknown blob store")
+	return nil, nil
+}
+
+func buildAttachmentConfig(l zerolog.Logger) service.AttachmentConfig {
+	cfg := service.AttachmentConfig{
+		MaxSize:  *attachmentMaxSize,
+		MaxFiles: *attachmentMaxFiles,
+		URLTTL:   *attachmentURLTTL,
+	}
+	for _, t := range strings.Split(*attachmentTypes, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			cfg.Types = append(cfg.Types, t)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		l.Fatal().Err(err).Msg("Invalid attachment settings")
+	}
+	return cfg
+}
+
+func buildWSConfig(l zerolog.Logger) handler.WSConfig {
+	overflow, err := handler.ParseOverflowPolicy(*wsOverflow)
+	if err != nil {
+		l.Fatal().Err(err).Msg("Invalid -ws-overflow")
+	}
+	cfg := handler.WSConfig{
+		QueueSize:    *wsQueueSize,
+		Overflow:     overflow,
+		WriteTimeout: *wsWriteTimeout,
+		PingInterval: *wsPing,
+		PongTimeout:  *wsPongTimeout,
+	}
+	if err := cfg.Validate(); err != nil {
+		l.Fatal().Err(err).Msg("Invalid WebSocket settings")
+	}
+	return cfg
+}
+
+func buildHubConfig(l zerolog.Logger) ws.HubConfig {
+	cfg := ws.HubConfig{
+		QueueSize:      *hubQueueSize,
+		EnqueueTimeout: *hubEnqueueTimeout,
+	}
+	if err := cfg.Validate(); err != nil {
+		l.Fatal().Err(err).Msg("Invalid hub settings")
+	}
+	return cfg
+}
+
 func main() {
+	flag.Parse()
+
 	w := zerolog.ConsoleWriter{Out: os.Stdout}
 	l := zerolog.New(w).With().Timestamp().Caller().Logger()
 
-	repo := repo.NewMessageRepository()
-	hub := ws.NewHub()
+	repos, closeStore := openStore(l)
+	defer closeStore()
+	hub := ws.NewHub(buildHubConfig(l), expvar.NewMap("hub"))
+	blobs, blobHandler := openBlobStore(l)
 
 	mediaEngine := pion.NewPionAdapter()
-	
-	chatService := service.NewChatService(repo, hub)
-	callService := service.NewCallService(mediaEngine, hub)
-	h := handler.NewHandler(chatService, callService, hub)
+	images, err := imaging.NewProcessor(*thumbnailSize)
+	if err != nil {
+		l.Fatal().Err(err).Msg("Invalid -thumbnail-size")
+	}
+
+	authConfig, hasher := buildAuth(l, repos.users)
+
+	chatService := service.NewChatService(repos.messages, repos.users, repos.rooms, repos.markers, repos.reactions, blobs, images, hub, buildAttachmentConfig(l))
+	callService := service.NewCallService(mediaEngine, repos.rooms, hub)
+	userService := service.NewUserService(repos.users, hasher)
+	roomService := service.NewRoomService(repos.rooms, repos.users, hub, callService)
+	h := handler.NewHandler(chatService, callService, userService, roomService, hub, blobHandler, authConfig, buildWSConfig(l))
 
 	go hub.Run()
 
@@ -47,6 +287,19 @@ func main() {
 		}
 	}()
 
+	admin := &http.Server{
+		Addr:    *adminAddr,
+		Handler: handler.NewAdminRouter(),
+	}
+	if *adminAddr != "" {
+		go func() {
+			l.Info().Str("addr", *adminAddr).Msg("Starting admin server")
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				l.Fatal().Err(err).Msg("Failed to start admin server")
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
@@ -59,6 +312,9 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		l.Error().Err(err).Msg("Server forced to shutdown")
 	}
+	if err := admin.Shutdown(ctx); err != nil {
+		l.Error().Err(err).Msg("Admin server forced to shutdown")
+	}
 
 	hub.Stop()
 	l.Info().Msg("Server exited")
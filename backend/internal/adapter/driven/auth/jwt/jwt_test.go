@@ -0,0 +1,67 @@
+package jwt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifySubjects(t *testing.T) {
+	ctx := context.Background()
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	// oct key "external" holds the secret "external-secret"
+	if err := os.WriteFile(jwks, []byte(`{"keys": [{"kty": "oct", "kid": "external", "k": "ZXh0ZXJuYWwtc2VjcmV0"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeySet()
+	if err := keys.LoadJWKS(jwks); err != nil {
+		t.Fatal(err)
+	}
+	keys.AddSecret("local", []byte("local-secret"))
+	verifier := NewVerifier(keys, Config{})
+
+	userID := domain.NewUserID()
+	local, _, err := NewIssuer("local", []byte("local-secret"), "", time.Minute).IssueToken(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := verifier.VerifyToken(ctx, local); err != nil || got.UserID != userID {
+		t.Fatalf("local token: got %v, %v, want %v", got, err, userID)
+	}
+
+	external := func(issuer, subject string) string {
+		token := gojwt.NewWithClaims(gojwt.SigningMethodHS256, gojwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   subject,
+			ExpiresAt: gojwt.NewNumericDate(time.Now().Add(time.Minute)),
+		})
+		token.Header["kid"] = "external"
+		signed, err := token.SignedString([]byte("external-secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// A provider naming a local user as its subject must not become that user
+	impersonated, err := verifier.VerifyToken(ctx, external("https://idp.example", userID.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impersonated.UserID == userID {
+		t.Fatal("external token with a local user's ID as subject authenticated as that user")
+	}
+	again, err := verifier.VerifyToken(ctx, external("https://idp.example", userID.String()))
+	if err != nil || again.UserID != impersonated.UserID {
+		t.Fatalf("external subject maps to %v then %v, want a stable ID", impersonated, again)
+	}
+	other, err := verifier.VerifyToken(ctx, external("https://other.example", userID.String()))
+	if err != nil || other.UserID == impersonated.UserID {
+		t.Fatalf("same subject from two issuers maps to %v and %v, want distinct IDs", impersonated, other)
+	}
+}
@@ -0,0 +1,159 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// KeySet holds the keys tokens may be signed with, indexed by key ID.
+// Symmetric keys are []byte, asymmetric ones their public key.
+type KeySet struct {
+	keys map[string]crypto.PublicKey
+	// local holds the IDs of the keys this server signs its own tokens with
+	local map[string]bool
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{
+		keys:  make(map[string]crypto.PublicKey),
+		local: make(map[string]bool),
+	}
+}
+
+// AddSecret registers the HMAC secret local tokens are signed with under kid.
+func (ks *KeySet) AddSecret(kid string, secret []byte) {
+	ks.keys[kid] = secret
+	ks.local[kid] = true
+}
+
+// LoadJWKS reads a JSON Web Key Set file, e.g. one exported from an identity
+// provider. RSA, EC, OKP (Ed25519) and oct keys are supported.
+func (ks *KeySet) LoadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("jwks %s: %w", path, err)
+	}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("jwks %s: key %q: %w", path, k.Kid, err)
+		}
+		ks.keys[k.Kid] = key
+		delete(ks.local, k.Kid)
+	}
+	return nil
+}
+
+func (ks *KeySet) Len() int {
+	return len(ks.keys)
+}
+
+// lookup returns the key for kid and whether it is a local one. Tokens
+// without a kid are accepted when the set holds a single key.
+func (ks *KeySet) lookup(kid string) (key crypto.PublicKey, local bool, err error) {
+	if key, ok := ks.keys[kid]; ok {
+		return key, ks.local[kid], nil
+	}
+	if kid == "" && len(ks.keys) == 1 {
+		for id, key := range ks.keys {
+			return key, ks.local[id], nil
+		}
+	}
+	return nil, false, fmt.Errorf("unknown signing key %q", kid)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC / OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,62 @@
+package local
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userNamespace derives a stable UserID from a username listed in a file.
+var userNamespace = uuid.MustParse("b2d7e0a4-6f0e-4f43-9a8e-6c1f2d9b7c15")
+
+// FileStore is a read-only CredentialStore backed by an htpasswd-style file.
+type FileStore struct {
+	users map[string][]byte // username -> bcrypt hash
+}
+
+// LoadFile reads "username:bcrypt-hash" lines, as produced by
+// `htpasswd -nB user`. Blank lines and lines starting with # are ignored.
+func LoadFile(path string) (*FileStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	store := &FileStore{users: make(map[string][]byte)}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("%s:%d: expected username:hash", path, n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		store.users[username] = []byte(hash)
+	}
+	return store, scanner.Err()
+}
+
+func (s *FileStore) PasswordHash(ctx context.Context, username string) (domain.UserID, []byte, error) {
+	hash, ok := s.users[username]
+	if !ok {
+		return domain.UserID{}, nil, domain.ErrUserNotFound
+	}
+	return UserID(username), hash, nil
+}
+
+// UserID is the stable identity of a user listed in a file.
+func UserID(username string) domain.UserID {
+	return domain.UserID(uuid.NewSHA1(userNamespace, []byte(username)))
+}
@@ -0,0 +1,47 @@
+package local
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against for unknown usernames so that lookups take
+// the same time whether or not the user exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+// CredentialStore looks up the bcrypt hash of a username. Satisfied by
+// port.UserRepository and by FileStore.
+type CredentialStore interface {
+	PasswordHash(ctx context.Context, username string) (domain.UserID, []byte, error)
+}
+
+// implements port.PasswordAuthenticator and port.PasswordHasher
+type Provider struct {
+	store CredentialStore
+}
+
+func NewProvider(store CredentialStore) *Provider {
+	return &Provider{store: store}
+}
+
+func (p *Provider) Authenticate(ctx context.Context, username, password string) (domain.UserID, error) {
+	userID, hash, err := p.store.PasswordHash(ctx, username)
+	if errors.Is(err, domain.ErrUserNotFound) || (err == nil && hash == nil) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return domain.UserID{}, domain.ErrInvalidCredentials
+	}
+	if err != nil {
+		return domain.UserID{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return domain.UserID{}, domain.ErrInvalidCredentials
+	}
+	return userID, nil
+}
+
+func (p *Provider) HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
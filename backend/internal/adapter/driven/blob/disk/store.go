@@ -0,0 +1,233 @@
+package disk
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/google/uuid"
+)
+
+const (
+	dataDir = "data"
+	// metaDir mirrors dataDir with the BlobInfo of each blob, so that keys
+	// cannot collide with metadata files
+	metaDir = "meta"
+)
+
+// Store keeps blobs as files under a directory. Its signed URLs point to its
+// own ServeHTTP, which must be mounted at baseURL.
+type Store struct {
+	root    *os.Root
+	baseURL string
+	secret  []byte
+}
+
+var _ port.BlobStore = (*Store)(nil)
+
+func NewStore(dir, baseURL string, secret []byte) (*Store, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("disk blob store: empty signing secret")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+func (s *Store) Close() error {
+	return s.root.Close()
+}
+
+func (s *Store) Put(ctx context.Context, key string, body io.Reader, info port.BlobInfo) error {
+	name, err := s.name(dataDir, key)
+	if err != nil {
+		return err
+	}
+	meta, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := s.root.MkdirAll(path.Dir(name), 0o750); err != nil {
+		return err
+	}
+	// Write aside then rename, readers never see a partial blob
+	tmp := path.Join(path.Dir(name), ".tmp-"+uuid.NewString())
+	f, err := s.root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(body, info.Size+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n != info.Size {
+		err = fmt.Errorf("disk blob store: got %d bytes, expected %d", n, info.Size)
+	}
+	if err != nil {
+		s.root.Remove(tmp)
+		return err
+	}
+
+	metaName, _ := s.name(metaDir, key)
+	if err := s.root.MkdirAll(path.Dir(metaName), 0o750); err != nil {
+		s.root.Remove(tmp)
+		return err
+	}
+	if err := s.root.WriteFile(metaName, meta, 0o640); err != nil {
+		s.root.Remove(tmp)
+		return err
+	}
+	return s.root.Rename(tmp, name)
+}
+
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, _, err := s.open(key)
+	return f, err
+}
+
+func (s *Store) open(key string) (*os.File, port.BlobInfo, error) {
+	name, err := s.name(dataDir, key)
+	if err != nil {
+		return nil, port.BlobInfo{}, err
+	}
+	metaName, _ := s.name(metaDir, key)
+	var info port.BlobInfo
+	meta, err := s.root.ReadFile(metaName)
+	if err == nil {
+		err = json.Unmarshal(meta, &info)
+	}
+	if err != nil {
+		return nil, port.BlobInfo{}, notFound(err)
+	}
+	f, err := s.root.Open(name)
+	if err != nil {
+		return nil, port.BlobInfo{}, notFound(err)
+	}
+	return f, info, nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	name, err := s.name(dataDir, key)
+	if err != nil {
+		return err
+	}
+	metaName, _ := s.name(metaDir, key)
+	for _, n := range []string{name, metaName} {
+		if err := s.root.Remove(n); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) SignedURL(ctx context.Context, key string, expires time.Time) (string, error) {
+	if _, err := s.name(dataDir, key); err != nil {
+		return "", err
+	}
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	q := url.Values{"expires": {exp}, "signature": {s.sign(key, exp)}}
+	return s.baseURL + "/" + strings.Join(segments, "/") + "?" + q.Encode(), nil
+}
+
+// ServeHTTP serves the blob named by the rest of the path after baseURL, as
+// long as the URL carries a valid signature.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := s.basePath() + "/"
+	key, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	exp := r.URL.Query().Get("expires")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires ||
+		!hmac.Equal([]byte(r.URL.Query().Get("signature")), []byte(s.sign(key, exp))) {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return
+	}
+
+	f, info, err := s.open(key)
+	if err != nil {
+		if errors.Is(err, port.ErrBlobNotFound) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", info.ContentType)
+	if info.ContentDisposition != "" {
+		h.Set("Content-Disposition", info.ContentDisposition)
+	}
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "sandbox")
+	h.Set("Cache-Control", "private, max-age="+strconv.FormatInt(max(expires-time.Now().Unix(), 0), 10))
+	http.ServeContent(w, r, "", st.ModTime(), f)
+}
+
+func (s *Store) basePath() string {
+	if u, err := url.Parse(s.baseURL); err == nil {
+		return u.Path
+	}
+	return s.baseURL
+}
+
+func (s *Store) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// name maps key to a path below dir, rejecting keys that would not round
+// trip through a URL path.
+func (s *Store) name(dir, key string) (string, error) {
+	if key == "" || path.Clean("/"+key) != "/"+key {
+		return "", fmt.Errorf("disk blob store: invalid key %q", key)
+	}
+	if dir == metaDir {
+		return path.Join(dir, key+".json"), nil
+	}
+	return path.Join(dir, key), nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return port.ErrBlobNotFound
+	}
+	return err
+}
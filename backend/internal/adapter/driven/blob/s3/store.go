@@ -0,0 +1,92 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type Config struct {
+	// Endpoint is host[:port], e.g. "s3.amazonaws.com" or "localhost:9000"
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Insecure talks plain HTTP, for a local stand-in such as MinIO
+	Insecure bool
+}
+
+// Store keeps blobs in a bucket of any S3-compatible service. Downloads go
+// straight to the service through presigned URLs.
+type Store struct {
+	client *minio.Client
+	bucket string
+}
+
+var _ port.BlobStore = (*Store)(nil)
+
+// NewStore connects to the service and checks that the bucket exists.
+func NewStore(ctx context.Context, cfg Config) (*Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ok, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("s3 blob store: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("s3 blob store: bucket %q does not exist", cfg.Bucket)
+	}
+	return &Store{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *Store) Put(ctx context.Context, key string, body io.Reader, info port.BlobInfo) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, body, info.Size, minio.PutObjectOptions{
+		ContentType:        info.ContentType,
+		ContentDisposition: info.ContentDisposition,
+	})
+	return err
+}
+
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	// GetObject is lazy, Stat surfaces a missing key
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, notFound(err)
+	}
+	return obj, nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *Store) SignedURL(ctx context.Context, key string, expires time.Time) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, time.Until(expires), nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func notFound(err error) error {
+	if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+		return port.ErrBlobNotFound
+	}
+	return err
+}
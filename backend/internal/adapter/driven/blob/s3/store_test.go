@@ -0,0 +1,104 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+// newTestStore runs an in-memory S3 stand-in holding the bucket "blobs".
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	backend := s3mem.New()
+	if err := backend.CreateBucket("blobs"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(context.Background(), Config{
+		Endpoint:  u.Host,
+		Bucket:    "blobs",
+		Region:    "us-east-1",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Insecure:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStore(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	const key, body = "attachments/a/report.txt", "quarterly numbers"
+
+	info := port.BlobInfo{Size: int64(len(body)), ContentType: "text/plain", ContentDisposition: `attachment; filename="report.txt"`}
+	if err := store.Put(ctx, key, strings.NewReader(body), info); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(got) != body {
+		t.Fatalf("get = %q, %v, want %q", got, err, body)
+	}
+
+	signed, err := store.SignedURL(ctx, key, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("signed url: %v", err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(got) != body {
+		t.Fatalf("signed url served %d %q, want %q", resp.StatusCode, got, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != info.ContentType {
+		t.Fatalf("content type = %q, want %q", ct, info.ContentType)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, port.ErrBlobNotFound) {
+		t.Fatalf("get after delete: err = %v, want ErrBlobNotFound", err)
+	}
+}
+
+func TestNewStoreMissingBucket(t *testing.T) {
+	srv := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL)
+	_, err := NewStore(context.Background(), Config{
+		Endpoint: u.Host, Bucket: "missing", Region: "us-east-1",
+		AccessKey: "access", SecretKey: "secret", Insecure: true,
+	})
+	if err == nil {
+		t.Fatal("store opened on a missing bucket")
+	}
+}
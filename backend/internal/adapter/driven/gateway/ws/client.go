@@ -5,6 +5,13 @@ import "github.com/Wyydra/ya/backend/internal/core/domain"
 type Client interface {
 	ID() string
 	SendText(msg domain.Message) error
+	// SendUpdate delivers a new version of a message sent earlier.
+	SendUpdate(msg domain.Message) error
 	SendSignal(signal domain.Signal) error
+	SendCallEnded(roomID domain.RoomID) error
+	SendPresence(p domain.Presence) error
+	SendTyping(t domain.Typing) error
+	SendReceipt(m domain.ReadMarker) error
+	SendReaction(r domain.ReactionChange) error
 	Close() error
 }
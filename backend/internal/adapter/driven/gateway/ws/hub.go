@@ -3,89 +3,547 @@ package ws
 import (
 	"context"
 	"errors"
+	"expvar"
+	"fmt"
+	"maps"
 	"sync"
+	"time"
 
 	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
 	"github.com/rs/zerolog/log"
 )
 
+type HubConfig struct {
+	// QueueSize is the number of deliveries buffered between the services
+	// and Run.
+	QueueSize int
+	// EnqueueTimeout bounds how long a caller waits for room in a full
+	// queue before the delivery is refused.
+	EnqueueTimeout time.Duration
+}
+
+func DefaultHubConfig() HubConfig {
+	return HubConfig{
+		QueueSize:      1024,
+		EnqueueTimeout: 2 * time.Second,
+	}
+}
+
+func (c HubConfig) Validate() error {
+	if c.QueueSize < 1 {
+		return errors.New("queue size must be positive")
+	}
+	if c.EnqueueTimeout <= 0 {
+		return errors.New("enqueue timeout must be positive")
+	}
+	return nil
+}
+
+// delivery is a message on its way to either the subscribers of its room or,
+// when users is set, to those users only.
+type delivery struct {
+	msg   domain.Message
+	users []string
+	// update marks an edit or deletion of a message sent earlier
+	update bool
+}
+
 // implements port.RealTimeGateway
 type Hub struct {
-	mu         sync.Mutex
-	clients    map[Client]bool
-	broadcast  chan domain.Message
+	mu      sync.Mutex
+	clients map[Client]bool
+	// UserID -> connections of that user
+	users map[string]map[Client]struct{}
+	// RoomID -> UserIDs subscribed to the room
+	rooms map[domain.RoomID]map[string]struct{}
+	// UserID -> RoomIDs, reverse index used for cleanup
+	memberships map[string]map[domain.RoomID]struct{}
+	// Thread root -> UserIDs following the thread
+	threads map[domain.MessageID]map[string]struct{}
+	// UserID -> followed thread roots and their room, used for cleanup
+	follows map[string]map[domain.MessageID]domain.RoomID
+	// RoomID -> UserID -> the connection the user joined the call from
+	calls map[domain.RoomID]map[string]Client
+
+	cfg        HubConfig
+	metrics    *expvar.Map
+	broadcast  chan delivery
 	register   chan Client
 	unregister chan Client
 	quit       chan struct{}
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		clients:    make(map[Client]bool),
-		broadcast:  make(chan domain.Message),
-		register:   make(chan Client),
-		unregister: make(chan Client),
-		quit:       make(chan struct{}),
+// NewHub creates a hub that keeps its counters and queue gauges in metrics,
+// which the caller publishes, e.g. with expvar.NewMap. A nil map keeps
+// them unpublished.
+func NewHub(cfg HubConfig, metrics *expvar.Map) *Hub {
+	if metrics == nil {
+		metrics = new(expvar.Map)
+	}
+	h := &Hub{
+		clients:     make(map[Client]bool),
+		users:       make(map[string]map[Client]struct{}),
+		rooms:       make(map[domain.RoomID]map[string]struct{}),
+		memberships: make(map[string]map[domain.RoomID]struct{}),
+		threads:     make(map[domain.MessageID]map[string]struct{}),
+		follows:     make(map[string]map[domain.MessageID]domain.RoomID),
+		calls:       make(map[domain.RoomID]map[string]Client),
+		cfg:         cfg,
+		metrics:     metrics,
+		broadcast:   make(chan delivery, cfg.QueueSize),
+		register:    make(chan Client),
+		unregister:  make(chan Client),
+		quit:        make(chan struct{}),
 	}
+	metrics.Set("queue_capacity", expvar.Func(func() any { return cap(h.broadcast) }))
+	metrics.Set("queue_depth", expvar.Func(func() any { return len(h.broadcast) }))
+	return h
 }
 
 func (h *Hub) BroadcastMessage(ctx context.Context, msg domain.Message) error {
+	return h.enqueue(ctx, delivery{msg: msg})
+}
+
+func (h *Hub) SendMessage(ctx context.Context, userIDs []domain.UserID, msg domain.Message) error {
+	return h.enqueue(ctx, delivery{msg: msg, users: userKeys(userIDs)})
+}
+
+func (h *Hub) BroadcastUpdate(ctx context.Context, msg domain.Message) error {
+	return h.enqueue(ctx, delivery{msg: msg, update: true})
+}
+
+func (h *Hub) SendUpdate(ctx context.Context, userIDs []domain.UserID, msg domain.Message) error {
+	return h.enqueue(ctx, delivery{msg: msg, users: userKeys(userIDs), update: true})
+}
+
+func userKeys(ids []domain.UserID) []string {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, id.String())
+	}
+	return keys
+}
+
+// enqueue hands d to Run. When the queue is full the caller waits, up to
+// EnqueueTimeout, and gets ErrGatewayUnavailable if no room frees up.
+func (h *Hub) enqueue(ctx context.Context, d delivery) error {
 	select {
-	case h.broadcast <- msg:
+	case h.broadcast <- d:
+		h.metrics.Add("enqueued", 1)
+		return nil
 	default:
-		log.Warn().Msg("Broadcast channel full, dropping message")
+	}
+
+	h.metrics.Add("enqueue_waits", 1)
+	timer := time.NewTimer(h.cfg.EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case h.broadcast <- d:
+		h.metrics.Add("enqueued", 1)
+		return nil
+	case <-timer.C:
+		h.metrics.Add("rejected", 1)
+		log.Warn().Str("message_id", d.msg.ID.String()).Msg("Broadcast queue full, refusing message")
+		return fmt.Errorf("%w: broadcast queue full", port.ErrGatewayUnavailable)
+	case <-h.quit:
+		h.metrics.Add("rejected", 1)
+		return fmt.Errorf("%w: hub stopped", port.ErrGatewayUnavailable)
+	case <-ctx.Done():
+		h.metrics.Add("rejected", 1)
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) SendSignal(ctx context.Context, roomID domain.RoomID, userID domain.UserID, signal domain.Signal) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client, ok := h.calls[roomID][userID.String()]
+	if !ok {
+		return nil // Not in the call anymore, e.g. disconnected
+	}
+	return client.SendSignal(signal)
+}
+
+func (h *Hub) EndCall(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	uid := userID.String()
+	client, ok := h.calls[roomID][uid]
+	if !ok {
+		return nil
+	}
+	h.dropCall(roomID, uid)
+	if err := client.SendCallEnded(roomID); err != nil {
+		log.Error().Err(err).Str("client_id", client.ID()).Msg("Error sending event")
+		client.Close()
 	}
 	return nil
 }
 
-func (h *Hub) SendSignal(ctx context.Context, userID domain.UserID, signal domain.Signal) error {
+// ClaimCall makes client the connection its user is in the call of roomID
+// from, so signals reach it rather than another tab. A connection that held
+// the call before is told it ended.
+func (h *Hub) ClaimCall(roomID domain.RoomID, client Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	for client := range h.clients {
-		if client.ID() == userID.String() {
-			return client.SendSignal(signal)
+	uid := client.ID()
+	if _, ok := h.calls[roomID]; !ok {
+		h.calls[roomID] = make(map[string]Client)
+	}
+	previous, ok := h.calls[roomID][uid]
+	h.calls[roomID][uid] = client
+	if ok && previous != client {
+		if err := previous.SendCallEnded(roomID); err != nil {
+			log.Error().Err(err).Str("client_id", previous.ID()).Msg("Error sending event")
+			previous.Close()
 		}
 	}
-	return nil // Client not found, maybe offline, ignore or error
+}
+
+// ReleaseCall gives up the call of roomID and reports whether client still
+// held it. A connection whose call was taken over must not end it.
+func (h *Hub) ReleaseCall(roomID domain.RoomID, client Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	uid := client.ID()
+	if h.calls[roomID][uid] != client {
+		return false
+	}
+	h.dropCall(roomID, uid)
+	return true
+}
+
+// InCall reports whether client is the connection its user is in the call of
+// roomID from.
+func (h *Hub) InCall(roomID domain.RoomID, client Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.calls[roomID][client.ID()] == client
+}
+
+// Must be called with h.mu held.
+func (h *Hub) dropCall(roomID domain.RoomID, uid string) {
+	delete(h.calls[roomID], uid)
+	if len(h.calls[roomID]) == 0 {
+		delete(h.calls, roomID)
+	}
+}
+
+func (h *Hub) SendTyping(ctx context.Context, typing domain.Typing) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.fanOut(typing.RoomID, typing.UserID.String(), func(c Client) error { return c.SendTyping(typing) })
+	return nil
+}
+
+func (h *Hub) SendReceipt(ctx context.Context, marker domain.ReadMarker) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.fanOut(marker.RoomID, "", func(c Client) error { return c.SendReceipt(marker) })
+	return nil
+}
+
+func (h *Hub) SendReaction(ctx context.Context, change domain.ReactionChange) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	send := func(c Client) error { return c.SendReaction(change) }
+	h.fanOut(change.RoomID, "", send)
+	subscribers := h.rooms[change.RoomID]
+	for uid := range h.threads[change.ThreadID] {
+		if _, ok := subscribers[uid]; ok {
+			continue
+		}
+		for client := range h.users[uid] {
+			if err := send(client); err != nil {
+				log.Error().Err(err).Str("client_id", client.ID()).Msg("Error sending event")
+				client.Close()
+			}
+		}
+	}
+	return nil
 }
 
 func (h *Hub) NotifyUserJoined(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
-	return errors.New("not implemented")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.announce(domain.NewPresence(roomID, userID, domain.PresenceJoin))
+	return nil
+}
+
+func (h *Hub) NotifyUserLeft(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.announce(domain.NewPresence(roomID, userID, domain.PresenceLeave))
+	return nil
+}
+
+func (h *Hub) OnlineUsers(ctx context.Context, roomID domain.RoomID) ([]domain.UserID, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var online []domain.UserID
+	for uid := range h.rooms[roomID] {
+		if len(h.users[uid]) == 0 {
+			continue
+		}
+		userID, err := domain.NewUserIDFromString(uid)
+		if err != nil {
+			return nil, err
+		}
+		online = append(online, userID)
+	}
+	return online, nil
+}
+
+func (h *Hub) JoinRoom(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	uid := userID.String()
+	if _, ok := h.rooms[roomID]; !ok {
+		h.rooms[roomID] = make(map[string]struct{})
+	}
+	_, subscribed := h.rooms[roomID][uid]
+	h.rooms[roomID][uid] = struct{}{}
+
+	if _, ok := h.memberships[uid]; !ok {
+		h.memberships[uid] = make(map[domain.RoomID]struct{})
+	}
+	h.memberships[uid][roomID] = struct{}{}
+
+	if !subscribed && len(h.users[uid]) > 0 {
+		h.announce(domain.NewPresence(roomID, userID, domain.PresenceOnline))
+	}
+	return nil
+}
+
+func (h *Hub) LeaveRoom(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.leaveRoom(roomID, userID.String())
+	return nil
+}
+
+func (h *Hub) FollowThread(ctx context.Context, roomID domain.RoomID, rootID domain.MessageID, userID domain.UserID) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	uid := userID.String()
+	if _, ok := h.threads[rootID]; !ok {
+		h.threads[rootID] = make(map[string]struct{})
+	}
+	h.threads[rootID][uid] = struct{}{}
+
+	if _, ok := h.follows[uid]; !ok {
+		h.follows[uid] = make(map[domain.MessageID]domain.RoomID)
+	}
+	h.follows[uid][rootID] = roomID
+	return nil
+}
+
+func (h *Hub) UnfollowThread(ctx context.Context, rootID domain.MessageID, userID domain.UserID) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.unfollow(rootID, userID.String())
+	return nil
+}
+
+// unfollow must be called with h.mu held.
+func (h *Hub) unfollow(rootID domain.MessageID, uid string) {
+	if followers, ok := h.threads[rootID]; ok {
+		delete(followers, uid)
+		if len(followers) == 0 {
+			delete(h.threads, rootID)
+		}
+	}
+	if roots, ok := h.follows[uid]; ok {
+		delete(roots, rootID)
+		if len(roots) == 0 {
+			delete(h.follows, uid)
+		}
+	}
+}
+
+// leaveRoom also drops the threads of the room uid follows.
+// Must be called with h.mu held.
+func (h *Hub) leaveRoom(roomID domain.RoomID, uid string) {
+	for rootID, threadRoom := range h.follows[uid] {
+		if threadRoom == roomID {
+			h.unfollow(rootID, uid)
+		}
+	}
+	if members, ok := h.rooms[roomID]; ok {
+		delete(members, uid)
+		if len(members) == 0 {
+			delete(h.rooms, roomID)
+		}
+	}
+	if rooms, ok := h.memberships[uid]; ok {
+		delete(rooms, roomID)
+		if len(rooms) == 0 {
+			delete(h.memberships, uid)
+		}
+	}
 }
 
 func (h *Hub) Run() {
 	for {
 		select {
 		case <-h.quit:
+			h.mu.Lock()
 			for client := range h.clients {
-				client.Close()
-				delete(h.clients, client)
+				h.removeClient(client)
 			}
+			h.mu.Unlock()
 			return
 
 		case client := <-h.register:
+			h.mu.Lock()
 			h.clients[client] = true
-			log.Info().Str("client_id", client.ID()).Msg("Client registered")
+			uid := client.ID()
+			first := len(h.users[uid]) == 0
+			if first {
+				h.users[uid] = make(map[Client]struct{})
+			}
+			h.users[uid][client] = struct{}{}
+			// Rooms the user was subscribed to while offline, e.g. invited
+			if first {
+				h.announceUser(uid, h.memberships[uid], domain.PresenceOnline)
+			}
+			h.mu.Unlock()
+			log.Info().Str("client_id", uid).Msg("Client registered")
 
 		case client := <-h.unregister:
+			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				client.Close()
+				released := h.removeClient(client)
+				h.announceUser(client.ID(), released, domain.PresenceOffline)
 				log.Info().Str("client_id", client.ID()).Msg("Client unregistered")
 			}
+			h.mu.Unlock()
 
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				// TODO: check if client is in the same room as message.RoomID
-				if err := client.SendText(message); err != nil {
-					log.Error().Err(err).Str("client_id", client.ID()).Msg("Error sending message")
-					client.Close()
-					delete(h.clients, client)
+		case d := <-h.broadcast:
+			h.mu.Lock()
+			if d.users != nil {
+				for _, uid := range d.users {
+					h.deliver(uid, d)
+				}
+			} else {
+				subscribers := h.rooms[d.msg.RoomID]
+				for uid := range subscribers {
+					h.deliver(uid, d)
+				}
+				// Followers of the thread not already reached through the room
+				for uid := range h.threads[d.msg.ThreadID()] {
+					if _, ok := subscribers[uid]; !ok {
+						h.deliver(uid, d)
+					}
 				}
 			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// deliver writes d to every connection of uid, closing those that fail.
+// Each connection counts as one delivered or dropped message.
+// Closed connections are removed when their reader unregisters them.
+// Must be called with h.mu held.
+func (h *Hub) deliver(uid string, d delivery) {
+	for client := range h.users[uid] {
+		send := client.SendText
+		if d.update {
+			send = client.SendUpdate
+		}
+		if err := send(d.msg); err != nil {
+			h.metrics.Add("dropped", 1)
+			log.Error().Err(err).Str("client_id", client.ID()).Msg("Error sending message")
+			client.Close()
+			continue
+		}
+		h.metrics.Add("delivered", 1)
+	}
+}
+
+// fanOut calls send for every connection subscribed to roomID, skipping
+// those of the user except, and closes the connections that fail.
+// Must be called with h.mu held.
+func (h *Hub) fanOut(roomID domain.RoomID, except string, send func(Client) error) {
+	for uid := range h.rooms[roomID] {
+		if uid == except {
+			continue
+		}
+		for client := range h.users[uid] {
+			if err := send(client); err != nil {
+				log.Error().Err(err).Str("client_id", client.ID()).Msg("Error sending event")
+				client.Close()
+			}
+		}
+	}
+}
+
+// announce sends p to the connections subscribed to its room, except those
+// of the user it is about. Must be called with h.mu held.
+func (h *Hub) announce(p domain.Presence) {
+	h.fanOut(p.RoomID, p.UserID.String(), func(c Client) error { return c.SendPresence(p) })
+}
+
+// announceUser announces that uid went online or offline in each room.
+// Must be called with h.mu held.
+func (h *Hub) announceUser(uid string, rooms map[domain.RoomID]struct{}, kind domain.PresenceKind) {
+	userID, err := domain.NewUserIDFromString(uid)
+	if err != nil {
+		return
+	}
+	for roomID := range rooms {
+		h.announce(domain.NewPresence(roomID, userID, kind))
+	}
+}
+
+// removeClient closes the connection and drops it from every index. Room
+// memberships and followed threads are released once the user has no connection left, and are
+// then returned. Must be called with h.mu held.
+func (h *Hub) removeClient(client Client) map[domain.RoomID]struct{} {
+	client.Close()
+	delete(h.clients, client)
+
+	uid := client.ID()
+	for roomID, owners := range h.calls {
+		if owners[uid] == client {
+			h.dropCall(roomID, uid)
 		}
 	}
+	conns, ok := h.users[uid]
+	if !ok {
+		return nil
+	}
+	delete(conns, client)
+	if len(conns) > 0 {
+		return nil
+	}
+	delete(h.users, uid)
+	released := maps.Clone(h.memberships[uid])
+	for roomID := range released {
+		h.leaveRoom(roomID, uid)
+	}
+	for rootID := range h.follows[uid] {
+		h.unfollow(rootID, uid)
+	}
+	return released
 }
 
 func (h *Hub) Register(c Client) {
@@ -0,0 +1,209 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+// fakeClient records the messages it is sent. A failing client refuses them.
+type fakeClient struct {
+	id      string
+	failing bool
+
+	mu       sync.Mutex
+	received []string
+	closed   bool
+	got      chan struct{}
+}
+
+func newFakeClient(userID domain.UserID) *fakeClient {
+	return &fakeClient{id: userID.String(), got: make(chan struct{}, 16)}
+}
+
+func (c *fakeClient) ID() string { return c.id }
+
+func (c *fakeClient) SendText(msg domain.Message) error { return c.record(msg.Content) }
+
+func (c *fakeClient) SendUpdate(msg domain.Message) error { return c.record("update " + msg.Content) }
+
+func (c *fakeClient) record(event string) error {
+	if c.failing {
+		return errors.New("connection broken")
+	}
+	c.mu.Lock()
+	c.received = append(c.received, event)
+	c.mu.Unlock()
+	c.got <- struct{}{}
+	return nil
+}
+
+func (c *fakeClient) events() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.received)
+}
+
+func (c *fakeClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeClient) SendSignal(sig domain.Signal) error { return c.record("signal " + sig.Payload) }
+
+func (c *fakeClient) SendCallEnded(domain.RoomID) error { return c.record("call ended") }
+
+func (c *fakeClient) SendPresence(domain.Presence) error       { return nil }
+func (c *fakeClient) SendTyping(domain.Typing) error           { return nil }
+func (c *fakeClient) SendReceipt(domain.ReadMarker) error      { return nil }
+func (c *fakeClient) SendReaction(domain.ReactionChange) error { return nil }
+
+func metric(hub *Hub, name string) int64 {
+	if v, ok := hub.metrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestHubFanOut(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub(DefaultHubConfig(), nil)
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+
+	roomID, other := domain.NewRoomID(), domain.NewRoomID()
+	alice, bob, carol, dave, sentinel := domain.NewUserID(), domain.NewUserID(), domain.NewUserID(), domain.NewUserID(), domain.NewUserID()
+
+	aliceWeb, alicePhone := newFakeClient(alice), newFakeClient(alice)
+	bobClient, carolClient, daveClient := newFakeClient(bob), newFakeClient(carol), newFakeClient(dave)
+	broken := newFakeClient(dave)
+	broken.failing = true
+	barrier := newFakeClient(sentinel)
+	for _, c := range []*fakeClient{aliceWeb, alicePhone, bobClient, carolClient, daveClient, broken, barrier} {
+		hub.Register(c)
+	}
+	for _, uid := range []domain.UserID{alice, bob, dave} {
+		if err := hub.JoinRoom(ctx, roomID, uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hub.JoinRoom(ctx, other, carol); err != nil {
+		t.Fatal(err)
+	}
+
+	root, _ := domain.NewMessage(alice, roomID, "root")
+	reply, _ := domain.NewReply(bob, *root, "reply")
+	// carol follows the thread without being subscribed to the room
+	if err := hub.FollowThread(ctx, roomID, root.ID, carol); err != nil {
+		t.Fatal(err)
+	}
+	direct, _ := domain.NewMessage(alice, roomID, "direct")
+
+	delivered, dropped := metric(hub, "delivered"), metric(hub, "dropped")
+	if err := hub.BroadcastMessage(ctx, *root); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.BroadcastMessage(ctx, *reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.BroadcastUpdate(ctx, *root); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.SendMessage(ctx, []domain.UserID{bob}, *direct); err != nil {
+		t.Fatal(err)
+	}
+	// Run delivers in order, so the sentinel's message marks the end
+	done, _ := domain.NewMessage(sentinel, other, "done")
+	if err := hub.SendMessage(ctx, []domain.UserID{sentinel}, *done); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-barrier.got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hub did not deliver")
+	}
+
+	tests := []struct {
+		name   string
+		client *fakeClient
+		want   []string
+	}{
+		{"every connection of a subscriber", aliceWeb, []string{"root", "reply", "update root"}},
+		{"second connection", alicePhone, []string{"root", "reply", "update root"}},
+		{"addressed user", bobClient, []string{"root", "reply", "update root", "direct"}},
+		{"thread follower", carolClient, []string{"root", "reply", "update root"}},
+		{"connection beside a broken one", daveClient, []string{"root", "reply", "update root"}},
+		{"broken connection", broken, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.client.events(); !slices.Equal(got, tt.want) {
+				t.Fatalf("received %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if !broken.closed {
+		t.Fatal("failing connection was not closed")
+	}
+	// One count per connection: the received events above plus the sentinel's
+	if got := metric(hub, "delivered") - delivered; got != 17 {
+		t.Fatalf("delivered = %d, want 17", got)
+	}
+	if got := metric(hub, "dropped") - dropped; got != 3 {
+		t.Fatalf("dropped = %d, want 3", got)
+	}
+}
+
+func TestHubCallRouting(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub(DefaultHubConfig(), nil)
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+
+	roomID, alice := domain.NewRoomID(), domain.NewUserID()
+	web, phone := newFakeClient(alice), newFakeClient(alice)
+	hub.Register(web)
+	hub.Register(phone)
+
+	signal := func(payload string) {
+		t.Helper()
+		if err := hub.SendSignal(ctx, roomID, alice, domain.NewSignal(domain.SignalOffer, payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signal("before joining")
+	hub.ClaimCall(roomID, phone)
+	signal("to phone")
+	// Joining from another tab moves the call there
+	hub.ClaimCall(roomID, web)
+	signal("to web")
+	if hub.ReleaseCall(roomID, phone) {
+		t.Fatal("connection released a call it no longer holds")
+	}
+	if !hub.InCall(roomID, web) || hub.InCall(roomID, phone) {
+		t.Fatal("call not held by the connection that joined last")
+	}
+	if err := hub.EndCall(ctx, roomID, alice); err != nil {
+		t.Fatal(err)
+	}
+	signal("after the end")
+	if hub.ReleaseCall(roomID, web) {
+		t.Fatal("ended call still held")
+	}
+
+	if got, want := phone.events(), []string{"signal to phone", "call ended"}; !slices.Equal(got, want) {
+		t.Fatalf("phone received %q, want %q", got, want)
+	}
+	if got, want := web.events(), []string{"signal to web", "call ended"}; !slices.Equal(got, want) {
+		t.Fatalf("web received %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	tagOrientation = 0x0112
+	tagGPSIFD      = 0x8825
+	ifdEntrySize   = 12
+)
+
+var errBadEXIF = errors.New("malformed EXIF data")
+
+// typeSizes is the size in bytes of one value of each TIFF field type.
+var typeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1,
+	7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// scrubEXIF empties the GPS IFD of TIFF-structured EXIF data in place and
+// returns the orientation, 1 when absent. The layout and size of the data
+// are preserved.
+func scrubEXIF(tiff []byte) (int, error) {
+	if len(tiff) < 8 {
+		return 0, errBadEXIF
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, errBadEXIF
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0, errBadEXIF
+	}
+
+	orientation := 1
+	ifd0 := order.Uint32(tiff[4:])
+	n, err := ifdCount(tiff, ifd0, order)
+	if err != nil {
+		return 0, err
+	}
+	for i := range n {
+		entry := tiff[ifd0+2+i*ifdEntrySize:][:ifdEntrySize]
+		switch order.Uint16(entry) {
+		case tagOrientation:
+			if o := int(order.Uint16(entry[8:])); o >= 1 && o <= 8 {
+				orientation = o
+			}
+		case tagGPSIFD:
+			if err := clearIFD(tiff, order.Uint32(entry[8:]), order); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return orientation, nil
+}
+
+// clearIFD zeroes the entries of the IFD at off and their out of line
+// values, then marks the IFD empty and last.
+func clearIFD(tiff []byte, off uint32, order binary.ByteOrder) error {
+	n, err := ifdCount(tiff, off, order)
+	if err != nil {
+		return err
+	}
+	entries := tiff[off+2:][:n*ifdEntrySize]
+	for i := range n {
+		entry := entries[i*ifdEntrySize:][:ifdEntrySize]
+		size, ok := typeSizes[order.Uint16(entry[2:])]
+		if !ok {
+			return errBadEXIF
+		}
+		size *= order.Uint32(entry[4:])
+		if size > 4 {
+			valueOff := order.Uint32(entry[8:])
+			if uint64(valueOff)+uint64(size) > uint64(len(tiff)) {
+				return errBadEXIF
+			}
+			clear(tiff[valueOff:][:size])
+		}
+	}
+	clear(entries)
+	order.PutUint16(tiff[off:], 0)
+	// The next IFD pointer now follows the empty entry list
+	order.PutUint32(tiff[off+2:], 0)
+	return nil
+}
+
+// ifdCount returns the number of entries of the IFD at off, checking that
+// they and the next IFD pointer fit in tiff.
+func ifdCount(tiff []byte, off uint32, order binary.ByteOrder) (uint32, error) {
+	if uint64(off)+2 > uint64(len(tiff)) {
+		return 0, errBadEXIF
+	}
+	n := uint32(order.Uint16(tiff[off:]))
+	if uint64(off)+2+uint64(n)*ifdEntrySize+4 > uint64(len(tiff)) {
+		return 0, errBadEXIF
+	}
+	return n, nil
+}
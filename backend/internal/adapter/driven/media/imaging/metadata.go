@@ -0,0 +1,172 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	// XMP packets may carry location too, unlike EXIF they are dropped whole
+	xmpHeaders = [][]byte{
+		[]byte("http://ns.adobe.com/xap/1.0/\x00"),
+		[]byte("http://ns.adobe.com/xmp/extension/\x00"),
+	}
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+	errBadJPEG = errors.New("malformed JPEG")
+	errBadPNG  = errors.New("malformed PNG")
+	errBadWebP = errors.New("malformed WebP")
+)
+
+// scrubJPEG returns data without location metadata, and the orientation.
+// EXIF that cannot be scrubbed is dropped.
+func scrubJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errBadJPEG
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+	for i := 2; ; {
+		// Markers may be preceded by fill bytes
+		for i+1 < len(data) && data[i] == 0xFF && data[i+1] == 0xFF {
+			i++
+		}
+		if i+2 > len(data) || data[i] != 0xFF {
+			return nil, 0, errBadJPEG
+		}
+		marker := data[i+1]
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if marker == 0xD9 {
+			out.Write(data[i : i+2])
+			return out.Bytes(), orientation, nil
+		}
+		if i+4 > len(data) {
+			return nil, 0, errBadJPEG
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, 0, errBadJPEG
+		}
+		segment := data[i:end]
+		payload := segment[4:]
+		switch {
+		case marker == 0xDA:
+			// Entropy-coded data follows the start of scan up to the end
+			out.Write(data[i:])
+			return out.Bytes(), orientation, nil
+		case marker == 0xE1 && bytes.HasPrefix(payload, exifHeader):
+			segment = bytes.Clone(segment)
+			o, err := scrubEXIF(segment[4+len(exifHeader):])
+			if err != nil {
+				segment = nil
+			} else {
+				orientation = o
+			}
+		case marker == 0xE1 && isXMP(payload):
+			segment = nil
+		}
+		out.Write(segment)
+		i = end
+	}
+}
+
+// scrubPNG returns data without location metadata, and the orientation.
+func scrubPNG(data []byte) ([]byte, int, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, 0, errBadPNG
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	orientation := 1
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, 0, errBadPNG
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return nil, 0, errBadPNG
+		}
+		chunk := data[i:end]
+		kind, body := string(chunk[4:8]), chunk[8:8+length]
+		switch kind {
+		case "eXIf":
+			chunk = bytes.Clone(chunk)
+			o, err := scrubEXIF(chunk[8 : 8+length])
+			if err != nil {
+				chunk = nil
+				break
+			}
+			orientation = o
+			binary.BigEndian.PutUint32(chunk[8+length:], crc32.ChecksumIEEE(chunk[4:8+length]))
+		case "iTXt", "tEXt", "zTXt":
+			if isMetadataText(body) {
+				chunk = nil
+			}
+		}
+		out.Write(chunk)
+		i = end
+		if kind == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), orientation, nil
+}
+
+// scrubWebP returns data without location metadata, and the orientation.
+// RIFF sizes are left untouched: EXIF is scrubbed in place and XMP blanked.
+func scrubWebP(data []byte) ([]byte, int, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, 0, errBadWebP
+	}
+	out := bytes.Clone(data)
+	orientation := 1
+	for i := 12; i+8 <= len(out); {
+		size := int(binary.LittleEndian.Uint32(out[i+4:]))
+		end := i + 8 + size
+		if size < 0 || end > len(out) || end < i {
+			return nil, 0, errBadWebP
+		}
+		body := out[i+8 : end]
+		switch string(out[i : i+4]) {
+		case "EXIF":
+			// Some writers keep the JPEG style header
+			tiff := bytes.TrimPrefix(body, exifHeader)
+			if o, err := scrubEXIF(tiff); err != nil {
+				clear(body)
+			} else {
+				orientation = o
+			}
+		case "XMP ":
+			for j := range body {
+				body[j] = ' '
+			}
+		}
+		i = end + size%2
+	}
+	return out, orientation, nil
+}
+
+func isXMP(payload []byte) bool {
+	for _, h := range xmpHeaders {
+		if bytes.HasPrefix(payload, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMetadataText reports whether a PNG text chunk holds XMP or EXIF, as
+// written by Adobe tools and ImageMagick.
+func isMetadataText(body []byte) bool {
+	keyword, _, _ := bytes.Cut(body, []byte{0})
+	return string(keyword) == "XML:com.adobe.xmp" || bytes.HasPrefix(keyword, []byte("Raw profile type"))
+}
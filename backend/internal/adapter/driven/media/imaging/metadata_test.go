@@ -0,0 +1,192 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// latitude is the out of line GPS value every test image carries.
+var latitude = []byte("LATITUDE-SECRET-24-BYTES")
+
+// tiffWithGPS builds EXIF data holding an orientation and a GPS IFD with a
+// latitude reference and an out of line latitude, which ends the data.
+func tiffWithGPS(order binary.ByteOrder, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	put16 := func(v uint16) { binary.Write(&buf, order, v) }
+	put32 := func(v uint32) { binary.Write(&buf, order, v) }
+	// entry writes an IFD entry, value is left to the caller
+	entry := func(tag, typ uint16, count uint32) {
+		put16(tag)
+		put16(typ)
+		put32(count)
+	}
+	put16(42)
+	put32(8)
+
+	// IFD0 at 8: two entries, then the next IFD pointer
+	const gpsIFD = 8 + 2 + 2*ifdEntrySize + 4
+	put16(2)
+	entry(tagOrientation, 3, 1)
+	put16(orientation)
+	put16(0)
+	entry(tagGPSIFD, 4, 1)
+	put32(gpsIFD)
+	put32(0)
+
+	// GPS IFD: latitude ref "N" inline, latitude as three rationals
+	const latitudeOff = gpsIFD + 2 + 2*ifdEntrySize + 4
+	put16(2)
+	entry(0x0001, 2, 2)
+	buf.WriteString("N\x00\x00\x00")
+	entry(0x0002, 5, 3)
+	put32(latitudeOff)
+	put32(0)
+	buf.Write(latitude)
+	return buf.Bytes()
+}
+
+func TestScrubEXIF(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			tiff := tiffWithGPS(order, 6)
+			size := len(tiff)
+			orientation, err := scrubEXIF(tiff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if orientation != 6 {
+				t.Fatalf("orientation = %d, want 6", orientation)
+			}
+			if len(tiff) != size {
+				t.Fatalf("size changed from %d to %d", size, len(tiff))
+			}
+			// The GPS IFD and its values end the data
+			gps := order.Uint32(tiff[8+2+ifdEntrySize+8:])
+			if gps == 0 || bytes.ContainsFunc(tiff[gps:], func(r rune) bool { return r != 0 }) {
+				t.Fatalf("GPS IFD not cleared: % x", tiff[gps:])
+			}
+		})
+	}
+
+	malformed := map[string][]byte{
+		"short":           []byte("II*\x00"),
+		"byte order":      append([]byte("XX"), tiffWithGPS(binary.LittleEndian, 1)[2:]...),
+		"magic":           append([]byte("II\x2b\x00"), tiffWithGPS(binary.LittleEndian, 1)[4:]...),
+		"truncated IFD":   tiffWithGPS(binary.LittleEndian, 1)[:20],
+		"truncated value": tiffWithGPS(binary.LittleEndian, 1)[:len(tiffWithGPS(binary.LittleEndian, 1))-8],
+	}
+	for name, tiff := range malformed {
+		t.Run(name, func(t *testing.T) {
+			if _, err := scrubEXIF(tiff); err == nil {
+				t.Fatal("malformed EXIF accepted")
+			}
+		})
+	}
+}
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := range 20 {
+		for x := range 40 {
+			img.Set(x, y, color.NRGBA{uint8(x * 6), uint8(y * 12), 90, 255})
+		}
+	}
+	return img
+}
+
+// jpegWithMetadata encodes a test image with EXIF and XMP segments.
+func jpegWithMetadata(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := jpeg.Encode(&enc, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	segment := func(payload ...[]byte) []byte {
+		body := bytes.Join(payload, nil)
+		return append([]byte{0xFF, 0xE1, byte((len(body) + 2) >> 8), byte(len(body) + 2)}, body...)
+	}
+	data := enc.Bytes()
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write(segment(exifHeader, tiff))
+	out.Write(segment(xmpHeaders[0], []byte(`<x:xmpmeta><exif:GPSLatitude>48,51N</exif:GPSLatitude></x:xmpmeta>`)))
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+// pngWithMetadata encodes a test image with eXIf and XMP text chunks.
+func pngWithMetadata(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := png.Encode(&enc, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	chunk := func(kind string, body []byte) []byte {
+		c := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+		c = append(append(c, kind...), body...)
+		return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+	}
+	data := enc.Bytes()
+	// After the signature and IHDR
+	ihdrEnd := len(pngSignature) + 12 + 13
+	var out bytes.Buffer
+	out.Write(data[:ihdrEnd])
+	out.Write(chunk("eXIf", tiff))
+	out.Write(chunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<exif:GPSLatitude>48,51N</exif:GPSLatitude>")))
+	out.Write(data[ihdrEnd:])
+	return out.Bytes()
+}
+
+func TestProcessScrubsLocation(t *testing.T) {
+	p, err := NewProcessor(DefaultThumbnailSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		contentType string
+		data        []byte
+	}{
+		{"image/jpeg", jpegWithMetadata(t, tiffWithGPS(binary.BigEndian, 6))},
+		{"image/png", pngWithMetadata(t, tiffWithGPS(binary.LittleEndian, 6))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			out, err := p.Process(context.Background(), tt.contentType, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(out.Data, latitude) || bytes.Contains(out.Data, []byte("GPSLatitude")) {
+				t.Fatal("location metadata survived")
+			}
+			if !bytes.Contains(out.Data, []byte("Exif\x00\x00")) && !bytes.Contains(out.Data, []byte("eXIf")) {
+				t.Fatal("scrubbed EXIF was dropped instead of kept")
+			}
+			// Orientation 6 turns the 40×20 image upright
+			if out.Width != 20 || out.Height != 40 {
+				t.Fatalf("size = %d×%d, want 20×40", out.Width, out.Height)
+			}
+			if _, _, err := image.Decode(bytes.NewReader(out.Data)); err != nil {
+				t.Fatalf("scrubbed image does not decode: %v", err)
+			}
+			thumb, _, err := image.Decode(bytes.NewReader(out.Thumbnail))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := thumb.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+				t.Fatalf("thumbnail = %v, want 20×40", b)
+			}
+		})
+	}
+}
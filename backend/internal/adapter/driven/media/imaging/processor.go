@@ -0,0 +1,155 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	DefaultThumbnailSize = 320
+	// maxPixels bounds the images decoded for a thumbnail, larger ones are
+	// stored without
+	maxPixels   = 64 << 20
+	jpegQuality = 80
+)
+
+// Processor works on JPEG, PNG, GIF, WebP and BMP images in pure Go.
+type Processor struct {
+	// size bounds both sides of thumbnails
+	size int
+}
+
+var _ port.ImageProcessor = (*Processor)(nil)
+
+func NewProcessor(thumbnailSize int) (*Processor, error) {
+	if thumbnailSize < 1 {
+		return nil, errors.New("thumbnail size must be positive")
+	}
+	return &Processor{size: thumbnailSize}, nil
+}
+
+func (p *Processor) Process(ctx context.Context, contentType string, data []byte) (port.ProcessedImage, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return port.ProcessedImage{}, port.ErrUnsupportedImage
+	}
+	orientation := 1
+	switch mediaType {
+	case "image/jpeg":
+		data, orientation, err = scrubJPEG(data)
+	case "image/png":
+		data, orientation, err = scrubPNG(data)
+	case "image/webp":
+		data, orientation, err = scrubWebP(data)
+	case "image/gif", "image/bmp":
+		// No location metadata in these formats
+	default:
+		return port.ProcessedImage{}, port.ErrUnsupportedImage
+	}
+	if err != nil {
+		return port.ProcessedImage{}, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return port.ProcessedImage{}, err
+	}
+	out := port.ProcessedImage{Data: data, Width: cfg.Width, Height: cfg.Height}
+	if orientation >= 5 {
+		out.Width, out.Height = cfg.Height, cfg.Width
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return out, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return port.ProcessedImage{}, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return port.ProcessedImage{}, err
+	}
+	thumb := orient(p.scale(img), orientation)
+	var buf bytes.Buffer
+	if opaque(img) {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: jpegQuality})
+		out.ThumbnailContentType = "image/jpeg"
+	} else {
+		err = png.Encode(&buf, thumb)
+		out.ThumbnailContentType = "image/png"
+	}
+	if err != nil {
+		return port.ProcessedImage{}, err
+	}
+	out.Thumbnail = buf.Bytes()
+	return out, nil
+}
+
+// scale shrinks img to fit the thumbnail size, keeping its aspect ratio.
+// Smaller images are only copied.
+func (p *Processor) scale(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if longest := max(w, h); longest > p.size {
+		w = max(w*p.size/longest, 1)
+		h = max(h*p.size/longest, 1)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation, so that thumbnails display upright
+// without metadata.
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.SetNRGBA(x, y, src.NRGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
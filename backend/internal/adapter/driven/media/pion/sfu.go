@@ -3,9 +3,10 @@ package pion
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Wyydra/ya/backend/internal/core/domain"
@@ -20,6 +21,9 @@ type Peer struct {
 	
 	mu sync.Mutex
 	negotiationPending bool // True if we need to renegotiate but were in unstable state
+
+	// Audio of a muted peer is dropped instead of relayed
+	muted atomic.Bool
 }
 
 type trackInfo struct {
@@ -160,6 +164,9 @@ func (a *PionAdapter) AddPeer(sessionID domain.SessionID, userID domain.UserID)
 					if err == io.EOF { return }
 					return
 				}
+				if remoteTrack.Kind() == webrtc.RTPCodecTypeAudio && peer.muted.Load() {
+					continue
+				}
 				if _, err := localTrack.Write(rtpBuf[:i]); err != nil {
 					if err == io.EOF { return }
 					return
@@ -261,13 +268,13 @@ func (a *PionAdapter) HandleSignal(sessionID domain.SessionID, userID domain.Use
 	session, ok := a.sessions[sessionID]
 	if !ok {
 		a.mu.RUnlock()
-		return errors.New("session not found")
+		return fmt.Errorf("session not found: %w", domain.ErrNotInCall)
 	}
 	peer, ok := session[userID]
 	a.mu.RUnlock()
 	
 	if !ok {
-		return errors.New("peer not found")
+		return fmt.Errorf("peer not found: %w", domain.ErrNotInCall)
 	}
 
 	switch signal.Type {
@@ -303,17 +310,18 @@ func (a *PionAdapter) HandleSignal(sessionID domain.SessionID, userID domain.Use
 	return nil
 }
 
-func (a *PionAdapter) RemovePeer(sessionID domain.SessionID, userID domain.UserID) {
+func (a *PionAdapter) RemovePeer(sessionID domain.SessionID, userID domain.UserID) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	
 	session, ok := a.sessions[sessionID]
 	if !ok {
-		return
+		return false
 	}
 	
 	// 1. Close the leaving peer
-	if peer, ok := session[userID]; ok {
+	peer, removed := session[userID]
+	if removed {
 		peer.PC.Close()
 		delete(session, userID)
 	}
@@ -364,6 +372,19 @@ func (a *PionAdapter) RemovePeer(sessionID domain.SessionID, userID domain.UserI
 			}
 		}
 	}
+	return removed
+}
+
+func (a *PionAdapter) SetMuted(sessionID domain.SessionID, userID domain.UserID, muted bool) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	peer, ok := a.sessions[sessionID][userID]
+	if !ok {
+		return domain.ErrNotInCall
+	}
+	peer.muted.Store(muted)
+	return nil
 }
 
 func min(a, b int) int {
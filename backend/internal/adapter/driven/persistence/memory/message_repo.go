@@ -2,24 +2,246 @@ package memory
 
 import (
 	"context"
+	"slices"
 	"sync"
+	"time"
+
 	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
 )
 
+type messageRef struct {
+	roomID domain.RoomID
+	seq    int64
+}
+
 type MessageRepository struct {
-	mu       sync.Mutex
-	messages []domain.Message
+	mu sync.Mutex
+	// RoomID -> messages ordered by Seq; the message with Seq n is at n-1
+	rooms     map[domain.RoomID][]domain.Message
+	index     map[domain.MessageID]messageRef
+	revisions map[domain.MessageID][]domain.MessageRevision
+	// Root -> sequence numbers of its replies, ascending
+	replies map[domain.MessageID][]int64
+	search  *searchIndex
 }
 
 func NewMessageRepository() *MessageRepository {
 	return &MessageRepository{
-		messages: make([]domain.Message, 0),
+		rooms:     make(map[domain.RoomID][]domain.Message),
+		index:     make(map[domain.MessageID]messageRef),
+		revisions: make(map[domain.MessageID][]domain.MessageRevision),
+		replies:   make(map[domain.MessageID][]int64),
+		search:    newSearchIndex(),
 	}
 }
 
-func (r *MessageRepository) Save(ctx context.Context, msg domain.Message) error {
+func (r *MessageRepository) Save(ctx context.Context, msg *domain.Message) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.messages = append(r.messages, msg)
+	var root int
+	if msg.ParentID != nil {
+		var err error
+		if root, err = r.position(msg.RoomID, *msg.ParentID); err != nil {
+			return err
+		}
+	}
+	msg.Seq = int64(len(r.rooms[msg.RoomID])) + 1
+	if msg.ParentID != nil {
+		r.rooms[msg.RoomID][root].ReplyCount++
+		r.replies[*msg.ParentID] = append(r.replies[*msg.ParentID], msg.Seq)
+	}
+	r.index[msg.ID] = messageRef{roomID: msg.RoomID, seq: msg.Seq}
+	r.rooms[msg.RoomID] = append(r.rooms[msg.RoomID], *msg)
+	r.search.add(msg.ID, msg.Content)
 	return nil
 }
+
+func (r *MessageRepository) Latest(ctx context.Context, roomID domain.RoomID, limit int) ([]domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msgs := r.rooms[roomID]
+	return window(msgs, len(msgs)-limit, len(msgs)), nil
+}
+
+func (r *MessageRepository) Before(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID, limit int) ([]domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos, err := r.position(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return window(r.rooms[roomID], pos-limit, pos), nil
+}
+
+func (r *MessageRepository) After(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID, limit int) ([]domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos, err := r.position(roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return window(r.rooms[roomID], pos+1, pos+1+limit), nil
+}
+
+func (r *MessageRepository) Since(ctx context.Context, roomID domain.RoomID, seq int64, limit int) ([]domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Seq n lives at index n-1, so messages after seq start at index seq
+	return window(r.rooms[roomID], int(seq), int(seq)+limit), nil
+}
+
+func (r *MessageRepository) Between(ctx context.Context, roomID domain.RoomID, from, to time.Time, limit int) ([]domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]domain.Message, 0)
+	for _, msg := range r.rooms[roomID] {
+		if len(out) == limit {
+			break
+		}
+		if !msg.CreatedAt.Before(from) && msg.CreatedAt.Before(to) {
+			out = append(out, msg)
+		}
+	}
+	return out, nil
+}
+
+func (r *MessageRepository) Get(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) (domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos, err := r.position(roomID, messageID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	return r.rooms[roomID][pos], nil
+}
+
+func (r *MessageRepository) Edit(ctx context.Context, msg domain.Message, previous domain.MessageRevision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos, err := r.position(msg.RoomID, msg.ID)
+	if err != nil {
+		return err
+	}
+	if r.rooms[msg.RoomID][pos].Deleted() {
+		return domain.ErrMessageDeleted
+	}
+	msg.ReplyCount = r.rooms[msg.RoomID][pos].ReplyCount
+	r.search.remove(msg.ID, r.rooms[msg.RoomID][pos].Content)
+	r.search.add(msg.ID, msg.Content)
+	r.rooms[msg.RoomID][pos] = msg
+	r.revisions[msg.ID] = append(r.revisions[msg.ID], previous)
+	return nil
+}
+
+func (r *MessageRepository) Delete(ctx context.Context, msg domain.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos, err := r.position(msg.RoomID, msg.ID)
+	if err != nil {
+		return err
+	}
+	msg.ReplyCount = r.rooms[msg.RoomID][pos].ReplyCount
+	r.search.remove(msg.ID, r.rooms[msg.RoomID][pos].Content)
+	r.rooms[msg.RoomID][pos] = msg
+	delete(r.revisions, msg.ID)
+	return nil
+}
+
+func (r *MessageRepository) Revisions(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) ([]domain.MessageRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.position(roomID, messageID); err != nil {
+		return nil, err
+	}
+	return append([]domain.MessageRevision{}, r.revisions[messageID]...), nil
+}
+
+func (r *MessageRepository) Thread(ctx context.Context, roomID domain.RoomID, rootID domain.MessageID, seq int64, limit int) ([]domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.position(roomID, rootID); err != nil {
+		return nil, err
+	}
+	out := make([]domain.Message, 0)
+	for _, n := range r.replies[rootID] {
+		if len(out) == limit {
+			break
+		}
+		if n > seq {
+			out = append(out, r.rooms[roomID][n-1])
+		}
+	}
+	return out, nil
+}
+
+func (r *MessageRepository) LastSeqs(ctx context.Context, roomIDs []domain.RoomID) (map[domain.RoomID]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seqs := make(map[domain.RoomID]int64, len(roomIDs))
+	for _, id := range roomIDs {
+		if n := len(r.rooms[id]); n > 0 {
+			seqs[id] = int64(n)
+		}
+	}
+	return seqs, nil
+}
+
+func (r *MessageRepository) Search(ctx context.Context, q port.MessageSearch) ([]domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matches := func(msg domain.Message) bool {
+		return !msg.Deleted() &&
+			(q.SenderID == nil || msg.SenderID == *q.SenderID) &&
+			(q.From.IsZero() || !msg.CreatedAt.Before(q.From)) &&
+			(q.To.IsZero() || msg.CreatedAt.Before(q.To))
+	}
+	out := make([]domain.Message, 0)
+	if len(q.Terms) > 0 {
+		rooms := make(map[domain.RoomID]bool, len(q.RoomIDs))
+		for _, id := range q.RoomIDs {
+			rooms[id] = true
+		}
+		for id := range r.search.match(q.Terms) {
+			ref := r.index[id]
+			if msg := r.rooms[ref.roomID][ref.seq-1]; rooms[ref.roomID] && matches(msg) {
+				out = append(out, msg)
+			}
+		}
+	} else {
+		for _, id := range q.RoomIDs {
+			for _, msg := range r.rooms[id] {
+				if matches(msg) {
+					out = append(out, msg)
+				}
+			}
+		}
+	}
+	slices.SortFunc(out, func(a, b domain.Message) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return out[:min(len(out), q.Limit)], nil
+}
+
+// position returns the slice index of messageID within its room.
+// Must be called with r.mu held.
+func (r *MessageRepository) position(roomID domain.RoomID, messageID domain.MessageID) (int, error) {
+	ref, ok := r.index[messageID]
+	if !ok || ref.roomID != roomID {
+		return 0, domain.ErrMessageNotFound
+	}
+	return int(ref.seq) - 1, nil
+}
+
+// window copies msgs[lo:hi], clamping both bounds to the slice.
+func window(msgs []domain.Message, lo, hi int) []domain.Message {
+	lo = max(lo, 0)
+	hi = min(hi, len(msgs))
+	if lo >= hi {
+		return []domain.Message{}
+	}
+	out := make([]domain.Message, hi-lo)
+	copy(out, msgs[lo:hi])
+	return out
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+type ReactionRepository struct {
+	mu sync.RWMutex
+	// MessageID -> reactions, oldest first
+	reactions map[domain.MessageID][]domain.Reaction
+}
+
+func NewReactionRepository() *ReactionRepository {
+	return &ReactionRepository{
+		reactions: make(map[domain.MessageID][]domain.Reaction),
+	}
+}
+
+func (r *ReactionRepository) Add(ctx context.Context, reaction domain.Reaction) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.find(reaction.MessageID, reaction.UserID, reaction.Emoji) >= 0 {
+		return false, nil
+	}
+	r.reactions[reaction.MessageID] = append(r.reactions[reaction.MessageID], reaction)
+	return true, nil
+}
+
+func (r *ReactionRepository) Remove(ctx context.Context, messageID domain.MessageID, userID domain.UserID, emoji string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.find(messageID, userID, emoji)
+	if i < 0 {
+		return false, nil
+	}
+	r.reactions[messageID] = slices.Delete(r.reactions[messageID], i, i+1)
+	if len(r.reactions[messageID]) == 0 {
+		delete(r.reactions, messageID)
+	}
+	return true, nil
+}
+
+func (r *ReactionRepository) ForMessages(ctx context.Context, messageIDs []domain.MessageID) (map[domain.MessageID][]domain.Reaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[domain.MessageID][]domain.Reaction)
+	for _, id := range messageIDs {
+		if reactions, ok := r.reactions[id]; ok {
+			out[id] = slices.Clone(reactions)
+		}
+	}
+	return out, nil
+}
+
+// find returns the index of a reaction, or -1. Must be called with r.mu held.
+func (r *ReactionRepository) find(messageID domain.MessageID, userID domain.UserID, emoji string) int {
+	return slices.IndexFunc(r.reactions[messageID], func(re domain.Reaction) bool {
+		return re.UserID == userID && re.Emoji == emoji
+	})
+}
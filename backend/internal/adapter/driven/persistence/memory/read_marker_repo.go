@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+type ReadMarkerRepository struct {
+	mu sync.RWMutex
+	// RoomID -> UserID -> marker
+	markers map[domain.RoomID]map[domain.UserID]domain.ReadMarker
+}
+
+func NewReadMarkerRepository() *ReadMarkerRepository {
+	return &ReadMarkerRepository{
+		markers: make(map[domain.RoomID]map[domain.UserID]domain.ReadMarker),
+	}
+}
+
+func (r *ReadMarkerRepository) Advance(ctx context.Context, marker domain.ReadMarker) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room, ok := r.markers[marker.RoomID]
+	if !ok {
+		room = make(map[domain.UserID]domain.ReadMarker)
+		r.markers[marker.RoomID] = room
+	}
+	if current, ok := room[marker.UserID]; ok && current.Seq >= marker.Seq {
+		return false, nil
+	}
+	room[marker.UserID] = marker
+	return true, nil
+}
+
+func (r *ReadMarkerRepository) ForRoom(ctx context.Context, roomID domain.RoomID) ([]domain.ReadMarker, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]domain.ReadMarker, 0, len(r.markers[roomID]))
+	for _, m := range r.markers[roomID] {
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (r *ReadMarkerRepository) ForUser(ctx context.Context, userID domain.UserID) (map[domain.RoomID]domain.ReadMarker, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[domain.RoomID]domain.ReadMarker)
+	for roomID, room := range r.markers {
+		if m, ok := room[userID]; ok {
+			out[roomID] = m
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,190 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+type RoomRepository struct {
+	mu    sync.RWMutex
+	rooms map[domain.RoomID]*domain.Room
+	// UserID -> rooms the user is a member of
+	byMember map[domain.UserID]map[domain.RoomID]struct{}
+	bans     map[domain.RoomID]map[domain.UserID]domain.Ban
+}
+
+func NewRoomRepository() *RoomRepository {
+	return &RoomRepository{
+		rooms:    make(map[domain.RoomID]*domain.Room),
+		byMember: make(map[domain.UserID]map[domain.RoomID]struct{}),
+		bans:     make(map[domain.RoomID]map[domain.UserID]domain.Ban),
+	}
+}
+
+func (r *RoomRepository) Create(ctx context.Context, room domain.Room) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rooms[room.ID]; ok {
+		return domain.ErrRoomExists
+	}
+	room.Members = slices.Clone(room.Members)
+	r.rooms[room.ID] = &room
+	for _, m := range room.Members {
+		r.index(room.ID, m.UserID)
+	}
+	return nil
+}
+
+func (r *RoomRepository) Get(ctx context.Context, id domain.RoomID) (domain.Room, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	room, ok := r.rooms[id]
+	if !ok {
+		return domain.Room{}, domain.ErrRoomNotFound
+	}
+	return copyRoom(room), nil
+}
+
+func (r *RoomRepository) ListForUser(ctx context.Context, userID domain.UserID) ([]domain.Room, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]domain.Room, 0, len(r.byMember[userID]))
+	for id := range r.byMember[userID] {
+		out = append(out, copyRoom(r.rooms[id]))
+	}
+	slices.SortFunc(out, func(a, b domain.Room) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return out, nil
+}
+
+func (r *RoomRepository) Update(ctx context.Context, room domain.Room) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.rooms[room.ID]
+	if !ok {
+		return domain.ErrRoomNotFound
+	}
+	stored.Name = room.Name
+	stored.Topic = room.Topic
+	return nil
+}
+
+func (r *RoomRepository) AddMember(ctx context.Context, roomID domain.RoomID, member domain.Member) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return domain.ErrRoomNotFound
+	}
+	if _, ok := room.Member(member.UserID); ok {
+		return domain.ErrAlreadyMember
+	}
+	room.Members = append(room.Members, member)
+	r.index(roomID, member.UserID)
+	return nil
+}
+
+func (r *RoomRepository) RemoveMember(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.removeMember(roomID, userID)
+}
+
+// removeMember must be called with r.mu held.
+func (r *RoomRepository) removeMember(roomID domain.RoomID, userID domain.UserID) error {
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return domain.ErrRoomNotFound
+	}
+	i := slices.IndexFunc(room.Members, func(m domain.Member) bool { return m.UserID == userID })
+	if i < 0 {
+		return domain.ErrNotMember
+	}
+	room.Members = slices.Delete(room.Members, i, i+1)
+	delete(r.byMember[userID], roomID)
+	if len(r.byMember[userID]) == 0 {
+		delete(r.byMember, userID)
+	}
+	return nil
+}
+
+func (r *RoomRepository) Member(ctx context.Context, roomID domain.RoomID, userID domain.UserID) (domain.Member, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return domain.Member{}, domain.ErrNotMember
+	}
+	m, ok := room.Member(userID)
+	if !ok {
+		return domain.Member{}, domain.ErrNotMember
+	}
+	return m, nil
+}
+
+func (r *RoomRepository) UpdateMember(ctx context.Context, roomID domain.RoomID, member domain.Member) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return domain.ErrNotMember
+	}
+	i := slices.IndexFunc(room.Members, func(m domain.Member) bool { return m.UserID == member.UserID })
+	if i < 0 {
+		return domain.ErrNotMember
+	}
+	room.Members[i].Role = member.Role
+	return nil
+}
+
+func (r *RoomRepository) AddBan(ctx context.Context, ban domain.Ban) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rooms[ban.RoomID]; !ok {
+		return domain.ErrRoomNotFound
+	}
+	if _, ok := r.bans[ban.RoomID]; !ok {
+		r.bans[ban.RoomID] = make(map[domain.UserID]domain.Ban)
+	}
+	if _, ok := r.bans[ban.RoomID][ban.UserID]; !ok {
+		r.bans[ban.RoomID][ban.UserID] = ban
+	}
+	if err := r.removeMember(ban.RoomID, ban.UserID); err != nil && !errors.Is(err, domain.ErrNotMember) {
+		return err
+	}
+	return nil
+}
+
+func (r *RoomRepository) RemoveBan(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.bans[roomID], userID)
+	if len(r.bans[roomID]) == 0 {
+		delete(r.bans, roomID)
+	}
+	return nil
+}
+
+func (r *RoomRepository) IsBanned(ctx context.Context, roomID domain.RoomID, userID domain.UserID) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.bans[roomID][userID]
+	return ok, nil
+}
+
+// index must be called with r.mu held.
+func (r *RoomRepository) index(roomID domain.RoomID, userID domain.UserID) {
+	if _, ok := r.byMember[userID]; !ok {
+		r.byMember[userID] = make(map[domain.RoomID]struct{})
+	}
+	r.byMember[userID][roomID] = struct{}{}
+}
+
+func copyRoom(room *domain.Room) domain.Room {
+	out := *room
+	out.Members = slices.Clone(room.Members)
+	return out
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"strings"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+// searchIndex is an inverted index from the words of message contents to
+// the messages containing them.
+type searchIndex struct {
+	words map[string]map[domain.MessageID]struct{}
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{words: make(map[string]map[domain.MessageID]struct{})}
+}
+
+func (idx *searchIndex) add(id domain.MessageID, content string) {
+	for _, word := range domain.SearchTerms(content) {
+		ids, ok := idx.words[word]
+		if !ok {
+			ids = make(map[domain.MessageID]struct{})
+			idx.words[word] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+func (idx *searchIndex) remove(id domain.MessageID, content string) {
+	for _, word := range domain.SearchTerms(content) {
+		delete(idx.words[word], id)
+		if len(idx.words[word]) == 0 {
+			delete(idx.words, word)
+		}
+	}
+}
+
+// match returns the messages in which every term starts a word.
+func (idx *searchIndex) match(terms []string) map[domain.MessageID]struct{} {
+	var out map[domain.MessageID]struct{}
+	for _, term := range terms {
+		found := make(map[domain.MessageID]struct{})
+		for word, ids := range idx.words {
+			if !strings.HasPrefix(word, term) {
+				continue
+			}
+			for id := range ids {
+				if _, ok := out[id]; out == nil || ok {
+					found[id] = struct{}{}
+				}
+			}
+		}
+		out = found
+		if len(out) == 0 {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/searchtest"
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+)
+
+func TestSearchIndex(t *testing.T) {
+	idx := newSearchIndex()
+	release, lunch := domain.NewMessageID(), domain.NewMessageID()
+	idx.add(release, "Deploying the new Release tonight")
+	idx.add(lunch, "lunch after the release?")
+
+	tests := []struct {
+		name  string
+		terms []string
+		want  []domain.MessageID
+	}{
+		{"word", []string{"lunch"}, []domain.MessageID{lunch}},
+		{"prefix", []string{"rel"}, []domain.MessageID{release, lunch}},
+		{"all terms", []string{"release", "tonight"}, []domain.MessageID{release}},
+		{"inside a word", []string{"ease"}, nil},
+		{"no match", []string{"release", "dinner"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idx.match(tt.terms)
+			if len(got) != len(tt.want) {
+				t.Fatalf("matched %v, want %v", slices.Collect(maps.Keys(got)), tt.want)
+			}
+			for _, id := range tt.want {
+				if _, ok := got[id]; !ok {
+					t.Fatalf("matched %v, want %v", slices.Collect(maps.Keys(got)), tt.want)
+				}
+			}
+		})
+	}
+
+	idx.remove(lunch, "lunch after the release?")
+	if got := idx.match([]string{"release"}); len(got) != 1 {
+		t.Fatalf("after remove matched %d messages, want 1", len(got))
+	}
+	for _, word := range []string{"lunch", "after"} {
+		if _, ok := idx.words[word]; ok {
+			t.Fatalf("word %q kept after its last message was removed", word)
+		}
+	}
+}
+
+// saveMessages stores one message per content in roomID, a second apart
+// starting at base.
+func saveMessages(t *testing.T, repo *MessageRepository, roomID domain.RoomID, sender domain.UserID, base time.Time, contents ...string) []domain.Message {
+	t.Helper()
+	out := make([]domain.Message, 0, len(contents))
+	for i, content := range contents {
+		msg, err := domain.NewMessage(sender, roomID, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		if err := repo.Save(context.Background(), msg); err != nil {
+			t.Fatalf("save %q: %v", content, err)
+		}
+		out = append(out, *msg)
+	}
+	return out
+}
+
+func contents(msgs []domain.Message) []string {
+	out := make([]string, len(msgs))
+	for i, msg := range msgs {
+		out[i] = msg.Content
+	}
+	return out
+}
+
+func TestMessageSearch(t *testing.T) {
+	repo := NewMessageRepository()
+	ctx := context.Background()
+	roomID, other, hidden := domain.NewRoomID(), domain.NewRoomID(), domain.NewRoomID()
+	alice, bob := domain.NewUserID(), domain.NewUserID()
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	saveMessages(t, repo, roomID, alice, base, "Deploying the new Release tonight", "lunch?")
+	saveMessages(t, repo, other, bob, base.Add(time.Minute), "release went fine")
+	saveMessages(t, repo, hidden, bob, base, "release notes are private")
+	gone := saveMessages(t, repo, roomID, alice, base.Add(2*time.Minute), "release canceled")[0]
+	gone.Delete(alice)
+	if err := repo.Delete(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+	edited := saveMessages(t, repo, roomID, bob, base.Add(3*time.Minute), "dinner plans")[0]
+	rev, err := edited.Edit("breakfast plans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Edit(ctx, edited, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	rooms := []domain.RoomID{roomID, other}
+	tests := []struct {
+		name string
+		q    port.MessageSearch
+		want []string
+	}{
+		{"prefix newest first", port.MessageSearch{Terms: []string{"rel"}, RoomIDs: rooms, Limit: 10},
+			[]string{"release went fine", "Deploying the new Release tonight"}},
+		{"all terms", port.MessageSearch{Terms: []string{"release", "tonight"}, RoomIDs: rooms, Limit: 10},
+			[]string{"Deploying the new Release tonight"}},
+		{"sender", port.MessageSearch{SenderID: &bob, RoomIDs: rooms, Limit: 10},
+			[]string{"breakfast plans", "release went fine"}},
+		{"range", port.MessageSearch{Terms: []string{"release"}, RoomIDs: rooms, To: base.Add(time.Minute), Limit: 10},
+			[]string{"Deploying the new Release tonight"}},
+		{"limit", port.MessageSearch{Terms: []string{"release"}, RoomIDs: rooms, Limit: 1},
+			[]string{"release went fine"}},
+		{"edited content", port.MessageSearch{Terms: []string{"breakfast"}, RoomIDs: rooms, Limit: 10},
+			[]string{"breakfast plans"}},
+		{"content before the edit", port.MessageSearch{Terms: []string{"dinner"}, RoomIDs: rooms, Limit: 10},
+			[]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := repo.Search(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := contents(msgs); !slices.Equal(got, tt.want) {
+				t.Fatalf("found %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchWords(t *testing.T) {
+	searchtest.Run(t, NewMessageRepository())
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+type userRecord struct {
+	user         domain.User
+	passwordHash []byte
+}
+
+type UserRepository struct {
+	mu         sync.RWMutex
+	users      map[domain.UserID]*userRecord
+	byUsername map[string]domain.UserID
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{
+		users:      make(map[domain.UserID]*userRecord),
+		byUsername: make(map[string]domain.UserID),
+	}
+}
+
+func (r *UserRepository) Create(ctx context.Context, user domain.User, passwordHash []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byUsername[user.Username]; ok {
+		return domain.ErrUsernameTaken
+	}
+	r.users[user.ID] = &userRecord{user: user, passwordHash: passwordHash}
+	r.byUsername[user.Username] = user.ID
+	return nil
+}
+
+func (r *UserRepository) Get(ctx context.Context, id domain.UserID) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec, ok := r.users[id]
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return rec.user, nil
+}
+
+func (r *UserRepository) GetMany(ctx context.Context, ids []domain.UserID) (map[domain.UserID]domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[domain.UserID]domain.User, len(ids))
+	for _, id := range ids {
+		if rec, ok := r.users[id]; ok {
+			out[id] = rec.user
+		}
+	}
+	return out, nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, user domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.users[user.ID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	// Usernames are immutable
+	user.Username = rec.user.Username
+	rec.user = user
+	return nil
+}
+
+func (r *UserRepository) PasswordHash(ctx context.Context, username string) (domain.UserID, []byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byUsername[username]
+	if !ok {
+		return domain.UserID{}, nil, domain.ErrUserNotFound
+	}
+	return id, r.users[id].passwordHash, nil
+}
@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLockID is the advisory lock held while migrating, so several
+// replicas starting together do not race on the schema.
+const migrationLockID = 0x7961 // "ya"
+
+// Open connects a pool to dsn and brings the schema up to date before
+// returning. Pool sizing is taken from the DSN (pool_max_conns, ...).
+func Open(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if err := backfillSearch(ctx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("search backfill: %w", err)
+	}
+	return pool, nil
+}
+
+// backfillBatch is the number of messages backfillSearch updates per
+// statement.
+const backfillBatch = 500
+
+// backfillSearch fills the search column of the messages written before
+// the repository maintained it. Messages are walked in id order, so rows
+// written meanwhile by another replica do not keep it going.
+func backfillSearch(ctx context.Context, pool *pgxpool.Pool) error {
+	var after uuid.UUID
+	for {
+		rows, err := pool.Query(ctx,
+			"SELECT id, content FROM messages WHERE search IS NULL AND id > $1 ORDER BY id LIMIT $2",
+			after, backfillBatch,
+		)
+		if err != nil {
+			return err
+		}
+		var (
+			ids   []uuid.UUID
+			words [][]string
+		)
+		for rows.Next() {
+			var content string
+			if err := rows.Scan(&after, &content); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, after)
+			words = append(words, searchWords(content))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		batch := &pgx.Batch{}
+		for i, id := range ids {
+			batch.Queue("UPDATE messages SET search = array_to_tsvector($1::text[]) WHERE id = $2 AND search IS NULL", words[i], id)
+		}
+		if err := pool.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+		log.Info().Int("messages", len(ids)).Msg("Indexed messages for search")
+	}
+}
+
+// migrate applies every embedded migration not yet recorded in
+// schema_migrations, each in its own transaction. Files are named
+// NNNN_description.sql.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER     PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		version, err := strconv.Atoi(strings.SplitN(entry.Name(), "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %s: invalid version prefix", entry.Name())
+		}
+		if version <= current {
+			continue
+		}
+
+		script, err := migrations.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return err
+		}
+
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		log.Info().Str("migration", entry.Name()).Msg("Applied postgres migration")
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	pool := openTestDB(t)
+	ctx := context.Background()
+
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(entries) {
+		t.Fatalf("applied %d migrations, want %d", applied, len(entries))
+	}
+
+	// Running again must leave an up to date schema untouched
+	if err := migrate(ctx, pool); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(entries) {
+		t.Fatalf("applied %d migrations after rerun, want %d", applied, len(entries))
+	}
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tests run against the server at YA_TEST_POSTGRES_DSN (URL form) when set,
+// otherwise against an embedded Postgres started here, which downloads its
+// binaries on first use. Each test gets its own database.
+//
+// Without a server the tests skip, unless Postgres was asked for: through
+// YA_TEST_POSTGRES_DSN or YA_TEST_POSTGRES=1, they fail instead.
+var (
+	serverDSN   string
+	unavailable string
+	required    = os.Getenv("YA_TEST_POSTGRES") == "1" || os.Getenv("YA_TEST_POSTGRES_DSN") != ""
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	if dsn := os.Getenv("YA_TEST_POSTGRES_DSN"); dsn != "" {
+		conn, err := pgx.Connect(context.Background(), dsn)
+		if err != nil {
+			unavailable = "YA_TEST_POSTGRES_DSN: " + err.Error()
+			return m.Run()
+		}
+		conn.Close(context.Background())
+		serverDSN = dsn
+		return m.Run()
+	}
+
+	dir, err := os.MkdirTemp("", "ya-postgres")
+	if err != nil {
+		unavailable = err.Error()
+		return m.Run()
+	}
+	defer os.RemoveAll(dir)
+
+	port, err := freePort()
+	if err != nil {
+		unavailable = err.Error()
+		return m.Run()
+	}
+	cfg := embeddedpostgres.DefaultConfig().
+		Port(port).
+		RuntimePath(filepath.Join(dir, "runtime")).
+		DataPath(filepath.Join(dir, "data")).
+		Logger(io.Discard)
+	pg := embeddedpostgres.NewDatabase(cfg)
+	if err := pg.Start(); err != nil {
+		unavailable = "embedded postgres: " + err.Error()
+		return m.Run()
+	}
+	defer pg.Stop()
+
+	serverDSN = cfg.GetConnectionURL() + "?sslmode=disable"
+	return m.Run()
+}
+
+func freePort() (uint32, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// openTestDB creates an empty database for t and opens it through Open, so
+// every test starts from freshly applied migrations.
+func openTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	if serverDSN == "" {
+		if required {
+			t.Fatalf("postgres unavailable: %s", unavailable)
+		}
+		t.Skipf("postgres unavailable: %s (set YA_TEST_POSTGRES=1 to fail instead)", unavailable)
+	}
+	ctx := context.Background()
+
+	admin, err := pgx.Connect(ctx, serverDSN)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	name := "ya_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+		admin.Close(ctx)
+		t.Fatalf("create database: %v", err)
+	}
+
+	u, err := url.Parse(serverDSN)
+	if err != nil {
+		t.Fatalf("parse dsn: %v", err)
+	}
+	u.Path = "/" + name
+	pool, err := Open(ctx, u.String())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+		if _, err := admin.Exec(ctx, fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", name)); err != nil {
+			t.Errorf("drop database: %v", err)
+		}
+		admin.Close(ctx)
+	})
+	return pool
+}
@@ -0,0 +1,401 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	messageColumns    = "id, room_id, sender_id, content, seq, created_at, edited_at, deleted_at, deleted_by, parent_id, reply_count"
+	attachmentColumns = "id, message_id, name, content_type, size, blob_key, created_at, width, height, thumbnail_key"
+
+	// maxLexemeLen is the longest word a tsvector can hold, in bytes.
+	maxLexemeLen = 2047
+)
+
+// tsqueryQuote escapes a word for a quoted tsquery lexeme.
+var tsqueryQuote = strings.NewReplacer(`\`, `\\`, "'", "''")
+
+type MessageRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewMessageRepository(pool *pgxpool.Pool) *MessageRepository {
+	return &MessageRepository{pool: pool}
+}
+
+func (r *MessageRepository) Save(ctx context.Context, msg *domain.Message) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		var parentID *uuid.UUID
+		if msg.ParentID != nil {
+			parentID = (*uuid.UUID)(msg.ParentID)
+			tag, err := tx.Exec(ctx,
+				"UPDATE messages SET reply_count = reply_count + 1 WHERE id = $1 AND room_id = $2",
+				*parentID, uuid.UUID(msg.RoomID),
+			)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				return domain.ErrMessageNotFound
+			}
+		}
+
+		// The row lock on room_sequences serialises writers of the same room
+		var seq int64
+		err := tx.QueryRow(ctx,
+			`INSERT INTO room_sequences (room_id, seq) VALUES ($1, 1)
+			ON CONFLICT (room_id) DO UPDATE SET seq = room_sequences.seq + 1
+			RETURNING seq`,
+			uuid.UUID(msg.RoomID),
+		).Scan(&seq)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx,
+			"INSERT INTO messages (id, room_id, sender_id, content, seq, created_at, parent_id, search) VALUES ($1, $2, $3, $4, $5, $6, $7, array_to_tsvector($8::text[]))",
+			uuid.UUID(msg.ID), uuid.UUID(msg.RoomID), uuid.UUID(msg.SenderID), msg.Content, seq, msg.CreatedAt, parentID, searchWords(msg.Content),
+		); err != nil {
+			return err
+		}
+		for i, a := range msg.Attachments {
+			if _, err := tx.Exec(ctx,
+				"INSERT INTO attachments (id, message_id, position, name, content_type, size, blob_key, created_at, width, height, thumbnail_key) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+				uuid.UUID(a.ID), uuid.UUID(msg.ID), i, a.Name, a.ContentType, a.Size, a.Key, a.CreatedAt, a.Width, a.Height, a.ThumbnailKey,
+			); err != nil {
+				return err
+			}
+		}
+		msg.Seq = seq
+		return nil
+	})
+}
+
+func (r *MessageRepository) Latest(ctx context.Context, roomID domain.RoomID, limit int) ([]domain.Message, error) {
+	msgs, err := r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = $1 ORDER BY seq DESC LIMIT $2",
+		uuid.UUID(roomID), limit,
+	)
+	slices.Reverse(msgs)
+	return msgs, err
+}
+
+func (r *MessageRepository) Before(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID, limit int) ([]domain.Message, error) {
+	seq, err := r.seqOf(ctx, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = $1 AND seq < $2 ORDER BY seq DESC LIMIT $3",
+		uuid.UUID(roomID), seq, limit,
+	)
+	slices.Reverse(msgs)
+	return msgs, err
+}
+
+func (r *MessageRepository) After(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID, limit int) ([]domain.Message, error) {
+	seq, err := r.seqOf(ctx, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return r.Since(ctx, roomID, seq, limit)
+}
+
+func (r *MessageRepository) Since(ctx context.Context, roomID domain.RoomID, seq int64, limit int) ([]domain.Message, error) {
+	return r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = $1 AND seq > $2 ORDER BY seq LIMIT $3",
+		uuid.UUID(roomID), seq, limit,
+	)
+}
+
+func (r *MessageRepository) Between(ctx context.Context, roomID domain.RoomID, from, to time.Time, limit int) ([]domain.Message, error) {
+	return r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = $1 AND created_at >= $2 AND created_at < $3 ORDER BY seq LIMIT $4",
+		uuid.UUID(roomID), from, to, limit,
+	)
+}
+
+func (r *MessageRepository) Get(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) (domain.Message, error) {
+	msgs, err := r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE id = $1 AND room_id = $2",
+		uuid.UUID(messageID), uuid.UUID(roomID),
+	)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if len(msgs) == 0 {
+		return domain.Message{}, domain.ErrMessageNotFound
+	}
+	return msgs[0], nil
+}
+
+func (r *MessageRepository) Edit(ctx context.Context, msg domain.Message, previous domain.MessageRevision) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			"UPDATE messages SET content = $1, edited_at = $2, search = array_to_tsvector($5::text[]) WHERE id = $3 AND room_id = $4 AND deleted_at IS NULL",
+			msg.Content, msg.EditedAt, uuid.UUID(msg.ID), uuid.UUID(msg.RoomID), searchWords(msg.Content),
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			// Deleted since it was loaded, or never there
+			var exists bool
+			if err := tx.QueryRow(ctx,
+				"SELECT EXISTS (SELECT 1 FROM messages WHERE id = $1 AND room_id = $2)",
+				uuid.UUID(msg.ID), uuid.UUID(msg.RoomID),
+			).Scan(&exists); err != nil {
+				return err
+			}
+			if exists {
+				return domain.ErrMessageDeleted
+			}
+			return domain.ErrMessageNotFound
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO message_revisions (message_id, content, edited_at) VALUES ($1, $2, $3)",
+			uuid.UUID(previous.MessageID), previous.Content, previous.EditedAt,
+		)
+		return err
+	})
+}
+
+func (r *MessageRepository) Delete(ctx context.Context, msg domain.Message) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			"UPDATE messages SET content = $1, deleted_at = $2, deleted_by = $3, search = array_to_tsvector($6::text[]) WHERE id = $4 AND room_id = $5",
+			msg.Content, msg.DeletedAt, uuid.UUID(msg.DeletedBy), uuid.UUID(msg.ID), uuid.UUID(msg.RoomID), searchWords(msg.Content),
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return domain.ErrMessageNotFound
+		}
+		if _, err := tx.Exec(ctx,
+			"DELETE FROM message_revisions WHERE message_id = $1",
+			uuid.UUID(msg.ID),
+		); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			"DELETE FROM attachments WHERE message_id = $1",
+			uuid.UUID(msg.ID),
+		)
+		return err
+	})
+}
+
+func (r *MessageRepository) Revisions(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) ([]domain.MessageRevision, error) {
+	if _, err := r.seqOf(ctx, roomID, messageID); err != nil {
+		return nil, err
+	}
+	rows, err := r.pool.Query(ctx,
+		"SELECT content, edited_at FROM message_revisions WHERE message_id = $1 ORDER BY id",
+		uuid.UUID(messageID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	revs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.MessageRevision, error) {
+		rev := domain.MessageRevision{MessageID: messageID}
+		err := row.Scan(&rev.Content, &rev.EditedAt)
+		rev.EditedAt = rev.EditedAt.UTC()
+		return rev, err
+	})
+	if revs == nil {
+		revs = make([]domain.MessageRevision, 0)
+	}
+	return revs, err
+}
+
+func (r *MessageRepository) Thread(ctx context.Context, roomID domain.RoomID, rootID domain.MessageID, seq int64, limit int) ([]domain.Message, error) {
+	if _, err := r.seqOf(ctx, roomID, rootID); err != nil {
+		return nil, err
+	}
+	return r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE parent_id = $1 AND seq > $2 ORDER BY seq LIMIT $3",
+		uuid.UUID(rootID), seq, limit,
+	)
+}
+
+func (r *MessageRepository) LastSeqs(ctx context.Context, roomIDs []domain.RoomID) (map[domain.RoomID]int64, error) {
+	ids := make([]uuid.UUID, 0, len(roomIDs))
+	for _, id := range roomIDs {
+		ids = append(ids, uuid.UUID(id))
+	}
+	rows, err := r.pool.Query(ctx,
+		"SELECT room_id, seq FROM room_sequences WHERE room_id = ANY($1)",
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seqs := make(map[domain.RoomID]int64, len(roomIDs))
+	for rows.Next() {
+		var (
+			id  uuid.UUID
+			seq int64
+		)
+		if err := rows.Scan(&id, &seq); err != nil {
+			return nil, err
+		}
+		seqs[domain.RoomID(id)] = seq
+	}
+	return seqs, rows.Err()
+}
+
+func (r *MessageRepository) Search(ctx context.Context, q port.MessageSearch) ([]domain.Message, error) {
+	roomIDs := make([]uuid.UUID, 0, len(q.RoomIDs))
+	for _, id := range q.RoomIDs {
+		roomIDs = append(roomIDs, uuid.UUID(id))
+	}
+	where := []string{"room_id = ANY($1)", "deleted_at IS NULL"}
+	args := []any{roomIDs}
+	if len(q.Terms) > 0 {
+		// Each term is a quoted prefix query, all of them must match. The
+		// cast takes the terms as they are, like the stored words
+		match := make([]string, 0, len(q.Terms))
+		for _, term := range q.Terms {
+			match = append(match, "'"+tsqueryQuote.Replace(term)+"':*")
+		}
+		args = append(args, strings.Join(match, " & "))
+		where = append(where, fmt.Sprintf("search @@ $%d::tsquery", len(args)))
+	}
+	if q.SenderID != nil {
+		args = append(args, uuid.UUID(*q.SenderID))
+		where = append(where, fmt.Sprintf("sender_id = $%d", len(args)))
+	}
+	if !q.From.IsZero() {
+		args = append(args, q.From)
+		where = append(where, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !q.To.IsZero() {
+		args = append(args, q.To)
+		where = append(where, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	args = append(args, q.Limit)
+
+	return r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE "+strings.Join(where, " AND ")+
+			fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d", len(args)),
+		args...,
+	)
+}
+
+// searchWords is the search column of a message with content, as the
+// distinct words of domain.SearchTerms. Words too long for a tsvector are
+// left out.
+func searchWords(content string) []string {
+	words := make([]string, 0)
+	for _, word := range domain.SearchTerms(content) {
+		if len(word) <= maxLexemeLen {
+			words = append(words, word)
+		}
+	}
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+func (r *MessageRepository) seqOf(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) (int64, error) {
+	var seq int64
+	err := r.pool.QueryRow(ctx,
+		"SELECT seq FROM messages WHERE id = $1 AND room_id = $2",
+		uuid.UUID(messageID), uuid.UUID(roomID),
+	).Scan(&seq)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, domain.ErrMessageNotFound
+	}
+	return seq, err
+}
+
+func (r *MessageRepository) query(ctx context.Context, query string, args ...any) ([]domain.Message, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := pgx.CollectRows(rows, scanMessage)
+	if err != nil {
+		return nil, err
+	}
+	if msgs == nil {
+		msgs = make([]domain.Message, 0)
+	}
+	return msgs, r.withAttachments(ctx, msgs)
+}
+
+// withAttachments loads the attachments of msgs in one query.
+func (r *MessageRepository) withAttachments(ctx context.Context, msgs []domain.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(msgs))
+	pos := make(map[domain.MessageID]int, len(msgs))
+	for i, msg := range msgs {
+		ids = append(ids, uuid.UUID(msg.ID))
+		pos[msg.ID] = i
+	}
+	rows, err := r.pool.Query(ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE message_id = ANY($1) ORDER BY message_id, position",
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id, messageID uuid.UUID
+			a             domain.Attachment
+		)
+		if err := rows.Scan(&id, &messageID, &a.Name, &a.ContentType, &a.Size, &a.Key, &a.CreatedAt, &a.Width, &a.Height, &a.ThumbnailKey); err != nil {
+			return err
+		}
+		a.ID = domain.AttachmentID(id)
+		a.CreatedAt = a.CreatedAt.UTC()
+		msg := &msgs[pos[domain.MessageID(messageID)]]
+		msg.Attachments = append(msg.Attachments, a)
+	}
+	return rows.Err()
+}
+
+func scanMessage(row pgx.CollectableRow) (domain.Message, error) {
+	var (
+		id, roomID, senderID uuid.UUID
+		editedAt, deletedAt  *time.Time
+		deletedBy, parentID  *uuid.UUID
+		msg                  domain.Message
+	)
+	if err := row.Scan(&id, &roomID, &senderID, &msg.Content, &msg.Seq, &msg.CreatedAt, &editedAt, &deletedAt, &deletedBy, &parentID, &msg.ReplyCount); err != nil {
+		return msg, err
+	}
+	msg.ID = domain.MessageID(id)
+	msg.RoomID = domain.RoomID(roomID)
+	msg.SenderID = domain.UserID(senderID)
+	msg.CreatedAt = msg.CreatedAt.UTC()
+	if editedAt != nil {
+		msg.EditedAt = editedAt.UTC()
+	}
+	if deletedAt != nil && deletedBy != nil {
+		msg.DeletedAt = deletedAt.UTC()
+		msg.DeletedBy = domain.UserID(*deletedBy)
+	}
+	if parentID != nil {
+		msg.ParentID = (*domain.MessageID)(parentID)
+	}
+	return msg, nil
+}
@@ -0,0 +1,239 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/searchtest"
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+)
+
+// saveMessages stores one message per content in roomID, a second apart
+// starting at base.
+func saveMessages(t *testing.T, repo *MessageRepository, roomID domain.RoomID, sender domain.UserID, base time.Time, contents ...string) []domain.Message {
+	t.Helper()
+	out := make([]domain.Message, 0, len(contents))
+	for i, content := range contents {
+		msg, err := domain.NewMessage(sender, roomID, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		if err := repo.Save(context.Background(), msg); err != nil {
+			t.Fatalf("save %q: %v", content, err)
+		}
+		out = append(out, *msg)
+	}
+	return out
+}
+
+func seqs(msgs []domain.Message) []int64 {
+	out := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		out[i] = msg.Seq
+	}
+	return out
+}
+
+func contents(msgs []domain.Message) []string {
+	out := make([]string, len(msgs))
+	for i, msg := range msgs {
+		out[i] = msg.Content
+	}
+	return out
+}
+
+func TestMessageHistory(t *testing.T) {
+	repo := NewMessageRepository(openTestDB(t))
+	ctx := context.Background()
+	roomID, other, sender := domain.NewRoomID(), domain.NewRoomID(), domain.NewUserID()
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	msgs := saveMessages(t, repo, roomID, sender, base, "one", "two", "three", "four", "five")
+	saveMessages(t, repo, other, sender, base, "elsewhere")
+
+	if got := seqs(msgs); !slices.Equal(got, []int64{1, 2, 3, 4, 5}) {
+		t.Fatalf("seqs = %v", got)
+	}
+
+	tests := []struct {
+		name string
+		page func() ([]domain.Message, error)
+		want []int64
+	}{
+		{"latest", func() ([]domain.Message, error) { return repo.Latest(ctx, roomID, 3) }, []int64{3, 4, 5}},
+		{"before", func() ([]domain.Message, error) { return repo.Before(ctx, roomID, msgs[3].ID, 2) }, []int64{2, 3}},
+		{"after", func() ([]domain.Message, error) { return repo.After(ctx, roomID, msgs[1].ID, 2) }, []int64{3, 4}},
+		{"since", func() ([]domain.Message, error) { return repo.Since(ctx, roomID, 3, 10) }, []int64{4, 5}},
+		{"between", func() ([]domain.Message, error) {
+			return repo.Between(ctx, roomID, base.Add(time.Second), base.Add(3*time.Second), 10)
+		}, []int64{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := tt.page()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := seqs(page); !slices.Equal(got, tt.want) {
+				t.Fatalf("seqs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := repo.Before(ctx, other, msgs[0].ID, 10); !errors.Is(err, domain.ErrMessageNotFound) {
+		t.Fatalf("cursor from another room: err = %v, want ErrMessageNotFound", err)
+	}
+
+	last, err := repo.LastSeqs(ctx, []domain.RoomID{roomID, other, domain.NewRoomID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 2 || last[roomID] != 5 || last[other] != 1 {
+		t.Fatalf("last seqs = %v", last)
+	}
+}
+
+func TestMessageEditDelete(t *testing.T) {
+	repo := NewMessageRepository(openTestDB(t))
+	ctx := context.Background()
+	roomID, sender := domain.NewRoomID(), domain.NewUserID()
+	msg := saveMessages(t, repo, roomID, sender, time.Now().UTC(), "first")[0]
+
+	rev, err := msg.Edit("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Edit(ctx, msg, rev); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	stale := msg
+	got, err := repo.Get(ctx, roomID, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Content != "second" || got.EditedAt.IsZero() {
+		t.Fatalf("edited message = %+v", got)
+	}
+	revs, err := repo.Revisions(ctx, roomID, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 1 || revs[0].Content != "first" {
+		t.Fatalf("revisions = %+v", revs)
+	}
+
+	msg.Delete(sender)
+	if err := repo.Delete(ctx, msg); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	got, err = repo.Get(ctx, roomID, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Deleted() || got.Content != "" || got.DeletedBy != sender {
+		t.Fatalf("deleted message = %+v", got)
+	}
+	if revs, err := repo.Revisions(ctx, roomID, msg.ID); err != nil || len(revs) != 0 {
+		t.Fatalf("revisions after delete = %+v, %v", revs, err)
+	}
+	// An edit that raced the deletion must not bring the content back
+	rev, err = stale.Edit("third")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Edit(ctx, stale, rev); !errors.Is(err, domain.ErrMessageDeleted) {
+		t.Fatalf("edit deleted: err = %v, want ErrMessageDeleted", err)
+	}
+
+	unknown, _ := domain.NewMessage(sender, roomID, "never saved")
+	if err := repo.Edit(ctx, *unknown, domain.MessageRevision{MessageID: unknown.ID}); !errors.Is(err, domain.ErrMessageNotFound) {
+		t.Fatalf("edit unknown: err = %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestMessageSearch(t *testing.T) {
+	repo := NewMessageRepository(openTestDB(t))
+	ctx := context.Background()
+	roomID, other, hidden := domain.NewRoomID(), domain.NewRoomID(), domain.NewRoomID()
+	alice, bob := domain.NewUserID(), domain.NewUserID()
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	saveMessages(t, repo, roomID, alice, base, "Deploying the new Release tonight", "lunch?")
+	saveMessages(t, repo, other, bob, base.Add(time.Minute), "release went fine")
+	saveMessages(t, repo, hidden, bob, base, "release notes are private")
+	gone := saveMessages(t, repo, roomID, alice, base.Add(2*time.Minute), "release canceled")[0]
+	gone.Delete(alice)
+	if err := repo.Delete(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+
+	rooms := []domain.RoomID{roomID, other}
+	tests := []struct {
+		name string
+		q    port.MessageSearch
+		want []string
+	}{
+		{"prefix newest first", port.MessageSearch{Terms: []string{"rel"}, RoomIDs: rooms, Limit: 10},
+			[]string{"release went fine", "Deploying the new Release tonight"}},
+		{"all terms", port.MessageSearch{Terms: []string{"release", "tonight"}, RoomIDs: rooms, Limit: 10},
+			[]string{"Deploying the new Release tonight"}},
+		{"sender", port.MessageSearch{SenderID: &bob, RoomIDs: rooms, Limit: 10},
+			[]string{"release went fine"}},
+		{"range", port.MessageSearch{Terms: []string{"release"}, RoomIDs: rooms, To: base.Add(time.Minute), Limit: 10},
+			[]string{"Deploying the new Release tonight"}},
+		{"limit", port.MessageSearch{Terms: []string{"release"}, RoomIDs: rooms, Limit: 1},
+			[]string{"release went fine"}},
+		{"no match", port.MessageSearch{Terms: []string{"dinner"}, RoomIDs: rooms, Limit: 10},
+			[]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := repo.Search(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := contents(msgs); !slices.Equal(got, tt.want) {
+				t.Fatalf("found %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchWords(t *testing.T) {
+	searchtest.Run(t, NewMessageRepository(openTestDB(t)))
+}
+
+func TestBackfillSearch(t *testing.T) {
+	pool := openTestDB(t)
+	repo := NewMessageRepository(pool)
+	ctx := context.Background()
+	roomID, sender := domain.NewRoomID(), domain.NewUserID()
+	msgs := saveMessages(t, repo, roomID, sender, time.Now().UTC(), "release notes", "lunch?")
+	// As left by the migration for messages written before it
+	if _, err := pool.Exec(ctx, "UPDATE messages SET search = NULL"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backfillSearch(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	var missing int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM messages WHERE search IS NULL").Scan(&missing); err != nil {
+		t.Fatal(err)
+	}
+	if missing != 0 {
+		t.Fatalf("%d messages left without search words", missing)
+	}
+	found, err := repo.Search(ctx, port.MessageSearch{Terms: []string{"release"}, RoomIDs: []domain.RoomID{roomID}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != msgs[0].ID {
+		t.Fatalf("found %q, want the backfilled message", contents(found))
+	}
+}
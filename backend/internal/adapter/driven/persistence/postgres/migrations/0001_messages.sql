@@ -0,0 +1,11 @@
+CREATE TABLE messages (
+    pos        BIGINT      GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    id         UUID        NOT NULL UNIQUE,
+    room_id    UUID        NOT NULL,
+    sender_id  UUID        NOT NULL,
+    content    TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX messages_room_pos ON messages (room_id, pos);
+CREATE INDEX messages_room_created_at ON messages (room_id, created_at);
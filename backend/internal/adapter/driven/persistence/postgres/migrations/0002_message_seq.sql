@@ -0,0 +1,21 @@
+-- Per-room sequence numbers, allocated from room_sequences on insert.
+ALTER TABLE messages ADD COLUMN seq BIGINT;
+
+UPDATE messages SET seq = numbered.seq
+FROM (
+    SELECT pos, row_number() OVER (PARTITION BY room_id ORDER BY pos) AS seq
+    FROM messages
+) AS numbered
+WHERE messages.pos = numbered.pos;
+
+ALTER TABLE messages ALTER COLUMN seq SET NOT NULL;
+CREATE UNIQUE INDEX messages_room_seq ON messages (room_id, seq);
+DROP INDEX messages_room_pos;
+
+CREATE TABLE room_sequences (
+    room_id UUID   PRIMARY KEY,
+    seq     BIGINT NOT NULL
+);
+
+INSERT INTO room_sequences (room_id, seq)
+SELECT room_id, MAX(seq) FROM messages GROUP BY room_id;
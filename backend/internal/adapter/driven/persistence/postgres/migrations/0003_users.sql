@@ -0,0 +1,10 @@
+CREATE TABLE users (
+    id            UUID        PRIMARY KEY,
+    username      TEXT        NOT NULL UNIQUE,
+    display_name  TEXT        NOT NULL,
+    avatar_ref    TEXT        NOT NULL DEFAULT '',
+    status        TEXT        NOT NULL,
+    status_text   TEXT        NOT NULL DEFAULT '',
+    password_hash BYTEA,
+    created_at    TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,18 @@
+CREATE TABLE rooms (
+    id         UUID        PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    topic      TEXT        NOT NULL DEFAULT '',
+    kind       TEXT        NOT NULL,
+    created_by UUID        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE room_members (
+    room_id   UUID        NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id   UUID        NOT NULL,
+    role      TEXT        NOT NULL,
+    joined_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX room_members_user ON room_members (user_id);
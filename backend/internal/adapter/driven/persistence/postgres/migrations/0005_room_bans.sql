@@ -0,0 +1,7 @@
+CREATE TABLE room_bans (
+    room_id    UUID        NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id    UUID        NOT NULL,
+    banned_by  UUID        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (room_id, user_id)
+);
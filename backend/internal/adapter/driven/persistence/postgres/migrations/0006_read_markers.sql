@@ -0,0 +1,10 @@
+CREATE TABLE read_markers (
+    room_id    UUID        NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id    UUID        NOT NULL,
+    message_id UUID        NOT NULL,
+    seq        BIGINT      NOT NULL,
+    read_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX read_markers_user ON read_markers (user_id);
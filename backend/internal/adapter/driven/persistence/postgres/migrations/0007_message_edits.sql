@@ -0,0 +1,12 @@
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN deleted_by UUID;
+
+CREATE TABLE message_revisions (
+    id         BIGINT      GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    message_id UUID        NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    content    TEXT        NOT NULL,
+    edited_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX message_revisions_message ON message_revisions (message_id, id);
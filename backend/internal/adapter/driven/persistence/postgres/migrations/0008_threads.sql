@@ -0,0 +1,4 @@
+ALTER TABLE messages ADD COLUMN parent_id UUID REFERENCES messages (id);
+ALTER TABLE messages ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX messages_thread ON messages (parent_id, seq) WHERE parent_id IS NOT NULL;
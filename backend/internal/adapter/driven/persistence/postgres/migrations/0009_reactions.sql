@@ -0,0 +1,8 @@
+CREATE TABLE message_reactions (
+    message_id UUID        NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    room_id    UUID        NOT NULL,
+    user_id    UUID        NOT NULL,
+    emoji      TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (message_id, user_id, emoji)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE attachments (
+    id           UUID        PRIMARY KEY,
+    message_id   UUID        NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    position     INTEGER     NOT NULL, -- upload order within the message
+    name         TEXT        NOT NULL,
+    content_type TEXT        NOT NULL,
+    size         BIGINT      NOT NULL,
+    blob_key     TEXT        NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    UNIQUE (message_id, position)
+);
@@ -0,0 +1,5 @@
+-- The simple configuration lowercases words without stemming
+ALTER TABLE messages ADD COLUMN search TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+
+CREATE INDEX messages_search ON messages USING GIN (search);
@@ -0,0 +1,8 @@
+-- to_tsvector keeps e-mail addresses, URLs and file paths whole and indexes
+-- hyphenated words both whole and split, so it cannot find what
+-- domain.SearchTerms splits out of a query. The repository now writes the
+-- words itself, rows from before are filled in by Open.
+ALTER TABLE messages DROP COLUMN search;
+ALTER TABLE messages ADD COLUMN search TSVECTOR;
+
+CREATE INDEX messages_search ON messages USING GIN (search);
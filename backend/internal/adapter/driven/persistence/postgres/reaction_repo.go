@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const reactionColumns = "message_id, room_id, user_id, emoji, created_at"
+
+type ReactionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewReactionRepository(pool *pgxpool.Pool) *ReactionRepository {
+	return &ReactionRepository{pool: pool}
+}
+
+func (r *ReactionRepository) Add(ctx context.Context, reaction domain.Reaction) (bool, error) {
+	tag, err := r.pool.Exec(ctx,
+		"INSERT INTO message_reactions ("+reactionColumns+") VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING",
+		uuid.UUID(reaction.MessageID), uuid.UUID(reaction.RoomID), uuid.UUID(reaction.UserID), reaction.Emoji, reaction.CreatedAt,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return false, domain.ErrMessageNotFound
+		}
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *ReactionRepository) Remove(ctx context.Context, messageID domain.MessageID, userID domain.UserID, emoji string) (bool, error) {
+	tag, err := r.pool.Exec(ctx,
+		"DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3",
+		uuid.UUID(messageID), uuid.UUID(userID), emoji,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *ReactionRepository) ForMessages(ctx context.Context, messageIDs []domain.MessageID) (map[domain.MessageID][]domain.Reaction, error) {
+	ids := make([]uuid.UUID, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		ids = append(ids, uuid.UUID(id))
+	}
+	rows, err := r.pool.Query(ctx,
+		"SELECT "+reactionColumns+" FROM message_reactions WHERE message_id = ANY($1) ORDER BY created_at",
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[domain.MessageID][]domain.Reaction)
+	for rows.Next() {
+		var (
+			messageID, roomID, userID uuid.UUID
+			re                        domain.Reaction
+		)
+		if err := rows.Scan(&messageID, &roomID, &userID, &re.Emoji, &re.CreatedAt); err != nil {
+			return nil, err
+		}
+		re.MessageID = domain.MessageID(messageID)
+		re.RoomID = domain.RoomID(roomID)
+		re.UserID = domain.UserID(userID)
+		re.CreatedAt = re.CreatedAt.UTC()
+		out[re.MessageID] = append(out[re.MessageID], re)
+	}
+	return out, rows.Err()
+}
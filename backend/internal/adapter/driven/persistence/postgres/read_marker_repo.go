@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const readMarkerColumns = "room_id, user_id, message_id, seq, read_at"
+
+type ReadMarkerRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewReadMarkerRepository(pool *pgxpool.Pool) *ReadMarkerRepository {
+	return &ReadMarkerRepository{pool: pool}
+}
+
+func (r *ReadMarkerRepository) Advance(ctx context.Context, marker domain.ReadMarker) (bool, error) {
+	tag, err := r.pool.Exec(ctx,
+		`INSERT INTO read_markers (`+readMarkerColumns+`) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (room_id, user_id) DO UPDATE
+		SET message_id = excluded.message_id, seq = excluded.seq, read_at = excluded.read_at
+		WHERE excluded.seq > read_markers.seq`,
+		uuid.UUID(marker.RoomID), uuid.UUID(marker.UserID), uuid.UUID(marker.MessageID), marker.Seq, marker.ReadAt,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return false, domain.ErrRoomNotFound
+		}
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *ReadMarkerRepository) ForRoom(ctx context.Context, roomID domain.RoomID) ([]domain.ReadMarker, error) {
+	return r.query(ctx,
+		"SELECT "+readMarkerColumns+" FROM read_markers WHERE room_id = $1",
+		uuid.UUID(roomID),
+	)
+}
+
+func (r *ReadMarkerRepository) ForUser(ctx context.Context, userID domain.UserID) (map[domain.RoomID]domain.ReadMarker, error) {
+	markers, err := r.query(ctx,
+		"SELECT "+readMarkerColumns+" FROM read_markers WHERE user_id = $1",
+		uuid.UUID(userID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[domain.RoomID]domain.ReadMarker, len(markers))
+	for _, m := range markers {
+		out[m.RoomID] = m
+	}
+	return out, nil
+}
+
+func (r *ReadMarkerRepository) query(ctx context.Context, query string, args ...any) ([]domain.ReadMarker, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	markers, err := pgx.CollectRows(rows, scanReadMarker)
+	if markers == nil {
+		markers = make([]domain.ReadMarker, 0)
+	}
+	return markers, err
+}
+
+func scanReadMarker(row pgx.CollectableRow) (domain.ReadMarker, error) {
+	var (
+		m                         domain.ReadMarker
+		roomID, userID, messageID uuid.UUID
+	)
+	if err := row.Scan(&roomID, &userID, &messageID, &m.Seq, &m.ReadAt); err != nil {
+		return m, err
+	}
+	m.RoomID = domain.RoomID(roomID)
+	m.UserID = domain.UserID(userID)
+	m.MessageID = domain.MessageID(messageID)
+	m.ReadAt = m.ReadAt.UTC()
+	return m, nil
+}
@@ -0,0 +1,258 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const roomColumns = "id, name, topic, kind, created_by, created_at"
+
+type RoomRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRoomRepository(pool *pgxpool.Pool) *RoomRepository {
+	return &RoomRepository{pool: pool}
+}
+
+func (r *RoomRepository) Create(ctx context.Context, room domain.Room) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			"INSERT INTO rooms ("+roomColumns+") VALUES ($1, $2, $3, $4, $5, $6)",
+			uuid.UUID(room.ID), room.Name, room.Topic, string(room.Kind), uuid.UUID(room.CreatedBy), room.CreatedAt,
+		); err != nil {
+			if isUniqueViolation(err) {
+				return domain.ErrRoomExists
+			}
+			return err
+		}
+		for _, m := range room.Members {
+			if err := insertMember(ctx, tx, room.ID, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *RoomRepository) Get(ctx context.Context, id domain.RoomID) (domain.Room, error) {
+	rooms, err := r.queryRooms(ctx, "SELECT "+roomColumns+" FROM rooms WHERE id = $1", uuid.UUID(id))
+	if err != nil {
+		return domain.Room{}, err
+	}
+	if len(rooms) == 0 {
+		return domain.Room{}, domain.ErrRoomNotFound
+	}
+	return rooms[0], nil
+}
+
+func (r *RoomRepository) ListForUser(ctx context.Context, userID domain.UserID) ([]domain.Room, error) {
+	return r.queryRooms(ctx,
+		`SELECT `+roomColumns+` FROM rooms
+		WHERE id IN (SELECT room_id FROM room_members WHERE user_id = $1)
+		ORDER BY created_at`,
+		uuid.UUID(userID),
+	)
+}
+
+func (r *RoomRepository) Update(ctx context.Context, room domain.Room) error {
+	tag, err := r.pool.Exec(ctx,
+		"UPDATE rooms SET name = $1, topic = $2 WHERE id = $3",
+		room.Name, room.Topic, uuid.UUID(room.ID),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrRoomNotFound
+	}
+	return nil
+}
+
+func (r *RoomRepository) AddMember(ctx context.Context, roomID domain.RoomID, member domain.Member) error {
+	err := insertMember(ctx, r.pool, roomID, member)
+	switch {
+	case isUniqueViolation(err):
+		return domain.ErrAlreadyMember
+	case isForeignKeyViolation(err):
+		return domain.ErrRoomNotFound
+	}
+	return err
+}
+
+func (r *RoomRepository) RemoveMember(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	tag, err := r.pool.Exec(ctx,
+		"DELETE FROM room_members WHERE room_id = $1 AND user_id = $2",
+		uuid.UUID(roomID), uuid.UUID(userID),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotMember
+	}
+	return nil
+}
+
+func (r *RoomRepository) Member(ctx context.Context, roomID domain.RoomID, userID domain.UserID) (domain.Member, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT user_id, role, joined_at FROM room_members WHERE room_id = $1 AND user_id = $2",
+		uuid.UUID(roomID), uuid.UUID(userID),
+	)
+	if err != nil {
+		return domain.Member{}, err
+	}
+	m, err := pgx.CollectExactlyOneRow(rows, scanMember)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m, domain.ErrNotMember
+	}
+	return m, err
+}
+
+func (r *RoomRepository) UpdateMember(ctx context.Context, roomID domain.RoomID, member domain.Member) error {
+	tag, err := r.pool.Exec(ctx,
+		"UPDATE room_members SET role = $1 WHERE room_id = $2 AND user_id = $3",
+		string(member.Role), uuid.UUID(roomID), uuid.UUID(member.UserID),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotMember
+	}
+	return nil
+}
+
+func (r *RoomRepository) AddBan(ctx context.Context, ban domain.Ban) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO room_bans (room_id, user_id, banned_by, created_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (room_id, user_id) DO NOTHING`,
+			uuid.UUID(ban.RoomID), uuid.UUID(ban.UserID), uuid.UUID(ban.BannedBy), ban.CreatedAt,
+		); err != nil {
+			if isForeignKeyViolation(err) {
+				return domain.ErrRoomNotFound
+			}
+			return err
+		}
+		_, err := tx.Exec(ctx,
+			"DELETE FROM room_members WHERE room_id = $1 AND user_id = $2",
+			uuid.UUID(ban.RoomID), uuid.UUID(ban.UserID),
+		)
+		return err
+	})
+}
+
+func (r *RoomRepository) RemoveBan(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	_, err := r.pool.Exec(ctx,
+		"DELETE FROM room_bans WHERE room_id = $1 AND user_id = $2",
+		uuid.UUID(roomID), uuid.UUID(userID),
+	)
+	return err
+}
+
+func (r *RoomRepository) IsBanned(ctx context.Context, roomID domain.RoomID, userID domain.UserID) (bool, error) {
+	var banned bool
+	err := r.pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM room_bans WHERE room_id = $1 AND user_id = $2)",
+		uuid.UUID(roomID), uuid.UUID(userID),
+	).Scan(&banned)
+	return banned, err
+}
+
+// execer is satisfied by *pgxpool.Pool and pgx.Tx.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func insertMember(ctx context.Context, db execer, roomID domain.RoomID, m domain.Member) error {
+	_, err := db.Exec(ctx,
+		"INSERT INTO room_members (room_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)",
+		uuid.UUID(roomID), uuid.UUID(m.UserID), string(m.Role), m.JoinedAt,
+	)
+	return err
+}
+
+// queryRooms loads the selected rooms and then all of their members in a
+// single extra query.
+func (r *RoomRepository) queryRooms(ctx context.Context, query string, args ...any) ([]domain.Room, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := pgx.CollectRows(rows, scanRoom)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return []domain.Room{}, nil
+	}
+
+	index := make(map[domain.RoomID]int, len(rooms))
+	ids := make([]uuid.UUID, len(rooms))
+	for i, room := range rooms {
+		index[room.ID] = i
+		ids[i] = uuid.UUID(room.ID)
+	}
+
+	memberRows, err := r.pool.Query(ctx,
+		"SELECT room_id, user_id, role, joined_at FROM room_members WHERE room_id = ANY($1) ORDER BY joined_at",
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		roomID uuid.UUID
+		userID uuid.UUID
+		role   string
+		m      domain.Member
+	)
+	_, err = pgx.ForEachRow(memberRows, []any{&roomID, &userID, &role, &m.JoinedAt}, func() error {
+		m.UserID = domain.UserID(userID)
+		m.Role = domain.Role(role)
+		m.JoinedAt = m.JoinedAt.UTC()
+		i := index[domain.RoomID(roomID)]
+		rooms[i].Members = append(rooms[i].Members, m)
+		return nil
+	})
+	return rooms, err
+}
+
+func scanRoom(row pgx.CollectableRow) (domain.Room, error) {
+	var (
+		room          domain.Room
+		id, createdBy uuid.UUID
+		kind          string
+	)
+	if err := row.Scan(&id, &room.Name, &room.Topic, &kind, &createdBy, &room.CreatedAt); err != nil {
+		return room, err
+	}
+	room.ID = domain.RoomID(id)
+	room.CreatedBy = domain.UserID(createdBy)
+	room.Kind = domain.RoomKind(kind)
+	room.CreatedAt = room.CreatedAt.UTC()
+	room.Members = []domain.Member{}
+	return room, nil
+}
+
+func scanMember(row pgx.CollectableRow) (domain.Member, error) {
+	var (
+		m      domain.Member
+		userID uuid.UUID
+		role   string
+	)
+	if err := row.Scan(&userID, &role, &m.JoinedAt); err != nil {
+		return m, err
+	}
+	m.UserID = domain.UserID(userID)
+	m.Role = domain.Role(role)
+	m.JoinedAt = m.JoinedAt.UTC()
+	return m, nil
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const userColumns = "id, username, display_name, avatar_ref, status, status_text, created_at"
+
+type UserRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewUserRepository(pool *pgxpool.Pool) *UserRepository {
+	return &UserRepository{pool: pool}
+}
+
+func (r *UserRepository) Create(ctx context.Context, user domain.User, passwordHash []byte) error {
+	_, err := r.pool.Exec(ctx,
+		"INSERT INTO users ("+userColumns+", password_hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		uuid.UUID(user.ID), user.Username, user.DisplayName, user.AvatarRef, string(user.Status), user.StatusText, user.CreatedAt, passwordHash,
+	)
+	if isUniqueViolation(err) {
+		return domain.ErrUsernameTaken
+	}
+	return err
+}
+
+func (r *UserRepository) Get(ctx context.Context, id domain.UserID) (domain.User, error) {
+	rows, err := r.pool.Query(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", uuid.UUID(id))
+	if err != nil {
+		return domain.User{}, err
+	}
+	user, err := pgx.CollectExactlyOneRow(rows, scanUser)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return user, domain.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r *UserRepository) GetMany(ctx context.Context, ids []domain.UserID) (map[domain.UserID]domain.User, error) {
+	out := make(map[domain.UserID]domain.User, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	uuids := make([]uuid.UUID, len(ids))
+	for i, id := range ids {
+		uuids[i] = uuid.UUID(id)
+	}
+	rows, err := r.pool.Query(ctx, "SELECT "+userColumns+" FROM users WHERE id = ANY($1)", uuids)
+	if err != nil {
+		return nil, err
+	}
+	users, err := pgx.CollectRows(rows, scanUser)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		out[user.ID] = user
+	}
+	return out, nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, user domain.User) error {
+	tag, err := r.pool.Exec(ctx,
+		"UPDATE users SET display_name = $1, avatar_ref = $2, status = $3, status_text = $4 WHERE id = $5",
+		user.DisplayName, user.AvatarRef, string(user.Status), user.StatusText, uuid.UUID(user.ID),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) PasswordHash(ctx context.Context, username string) (domain.UserID, []byte, error) {
+	var (
+		id   uuid.UUID
+		hash []byte
+	)
+	err := r.pool.QueryRow(ctx, "SELECT id, password_hash FROM users WHERE username = $1", username).Scan(&id, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.UserID{}, nil, domain.ErrUserNotFound
+	}
+	return domain.UserID(id), hash, err
+}
+
+func scanUser(row pgx.CollectableRow) (domain.User, error) {
+	var (
+		user   domain.User
+		id     uuid.UUID
+		status string
+	)
+	if err := row.Scan(&id, &user.Username, &user.DisplayName, &user.AvatarRef, &status, &user.StatusText, &user.CreatedAt); err != nil {
+		return user, err
+	}
+	user.ID = domain.UserID(id)
+	user.Status = domain.UserStatus(status)
+	user.CreatedAt = user.CreatedAt.UTC()
+	return user, nil
+}
@@ -0,0 +1,83 @@
+// Package searchtest checks that a message repository splits words for
+// search like domain.SearchTerms, so every store finds the same messages.
+package searchtest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+)
+
+// messages are saved in order, a second apart, so searches list them in
+// reverse.
+var messages = []string{
+	"mail bob@example.com today",
+	"let's follow-up tomorrow",
+	"see https://docs.example.org/guide/setup.html",
+	"Café crème",
+	"ÉCOLE FERMÉE",
+	"build v2.5 of snake_case_name, ticket #42b",
+}
+
+// Run saves messages in repo and searches them the way the chat service
+// does, with the terms of a query text.
+func Run(t *testing.T, repo port.MessageRepository) {
+	t.Helper()
+	ctx := context.Background()
+	roomID, sender := domain.NewRoomID(), domain.NewUserID()
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, content := range messages {
+		msg, err := domain.NewMessage(sender, roomID, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		if err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("save %q: %v", content, err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"e-mail domain", "example", []string{messages[2], messages[0]}},
+		{"e-mail user", "bob", []string{messages[0]}},
+		{"hyphenated word", "up", []string{messages[1]}},
+		{"apostrophe", "let's", []string{messages[1]}},
+		{"URL path", "guide setup", []string{messages[2]}},
+		{"URL scheme", "https", []string{messages[2]}},
+		{"accented prefix", "caf", []string{messages[3]}},
+		{"accents are kept", "cafe", nil},
+		{"uppercase query", "CRÈME", []string{messages[3]}},
+		{"uppercase content", "école fermée", []string{messages[4]}},
+		{"version", "5", []string{messages[5]}},
+		{"underscore", "case", []string{messages[5]}},
+		{"digits", "42", []string{messages[5]}},
+		{"inside a word", "ample", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := repo.Search(ctx, port.MessageSearch{
+				Terms:   domain.SearchTerms(tt.query),
+				RoomIDs: []domain.RoomID{roomID},
+				Limit:   10,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, msg := range msgs {
+				got = append(got, msg.Content)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("%q found %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
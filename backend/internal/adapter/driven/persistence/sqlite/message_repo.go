@@ -0,0 +1,450 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/google/uuid"
+)
+
+const (
+	messageColumns    = "id, room_id, sender_id, content, seq, created_at, edited_at, deleted_at, deleted_by, parent_id, reply_count"
+	attachmentColumns = "id, message_id, name, content_type, size, blob_key, created_at, width, height, thumbnail_key"
+)
+
+type MessageRepository struct {
+	db *sql.DB
+}
+
+func NewMessageRepository(db *sql.DB) *MessageRepository {
+	return &MessageRepository{db: db}
+}
+
+func (r *MessageRepository) Save(ctx context.Context, msg *domain.Message) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullString
+	if msg.ParentID != nil {
+		parentID = sql.NullString{String: msg.ParentID.String(), Valid: true}
+		res, err := tx.ExecContext(ctx,
+			"UPDATE messages SET reply_count = reply_count + 1 WHERE id = ? AND room_id = ?",
+			parentID.String, msg.RoomID.String(),
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return domain.ErrMessageNotFound
+		}
+	}
+
+	var seq int64
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO room_sequences (room_id, seq) VALUES (?, 1)
+		ON CONFLICT (room_id) DO UPDATE SET seq = seq + 1
+		RETURNING seq`,
+		msg.RoomID.String(),
+	).Scan(&seq)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO messages (id, room_id, sender_id, content, seq, created_at, parent_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		msg.ID.String(), msg.RoomID.String(), msg.SenderID.String(), msg.Content, seq, msg.CreatedAt.UnixNano(), parentID,
+	); err != nil {
+		return err
+	}
+	for i, a := range msg.Attachments {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO attachments (id, message_id, position, name, content_type, size, blob_key, created_at, width, height, thumbnail_key) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			a.ID.String(), msg.ID.String(), i, a.Name, a.ContentType, a.Size, a.Key, a.CreatedAt.UnixNano(), a.Width, a.Height, a.ThumbnailKey,
+		); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	msg.Seq = seq
+	return nil
+}
+
+func (r *MessageRepository) Latest(ctx context.Context, roomID domain.RoomID, limit int) ([]domain.Message, error) {
+	msgs, err := r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = ? ORDER BY seq DESC LIMIT ?",
+		roomID.String(), limit,
+	)
+	slices.Reverse(msgs)
+	return msgs, err
+}
+
+func (r *MessageRepository) Before(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID, limit int) ([]domain.Message, error) {
+	seq, err := r.seqOf(ctx, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND seq < ? ORDER BY seq DESC LIMIT ?",
+		roomID.String(), seq, limit,
+	)
+	slices.Reverse(msgs)
+	return msgs, err
+}
+
+func (r *MessageRepository) After(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID, limit int) ([]domain.Message, error) {
+	seq, err := r.seqOf(ctx, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return r.Since(ctx, roomID, seq, limit)
+}
+
+func (r *MessageRepository) Since(ctx context.Context, roomID domain.RoomID, seq int64, limit int) ([]domain.Message, error) {
+	return r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND seq > ? ORDER BY seq LIMIT ?",
+		roomID.String(), seq, limit,
+	)
+}
+
+func (r *MessageRepository) Between(ctx context.Context, roomID domain.RoomID, from, to time.Time, limit int) ([]domain.Message, error) {
+	return r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND created_at >= ? AND created_at < ? ORDER BY seq LIMIT ?",
+		roomID.String(), from.UnixNano(), to.UnixNano(), limit,
+	)
+}
+
+func (r *MessageRepository) Get(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) (domain.Message, error) {
+	msgs, err := r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE id = ? AND room_id = ?",
+		messageID.String(), roomID.String(),
+	)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if len(msgs) == 0 {
+		return domain.Message{}, domain.ErrMessageNotFound
+	}
+	return msgs[0], nil
+}
+
+func (r *MessageRepository) Edit(ctx context.Context, msg domain.Message, previous domain.MessageRevision) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE messages SET content = ?, edited_at = ? WHERE id = ? AND room_id = ? AND deleted_at IS NULL",
+		msg.Content, msg.EditedAt.UnixNano(), msg.ID.String(), msg.RoomID.String(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Deleted since it was loaded, or never there
+		var exists bool
+		if err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM messages WHERE id = ? AND room_id = ?)",
+			msg.ID.String(), msg.RoomID.String(),
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return domain.ErrMessageDeleted
+		}
+		return domain.ErrMessageNotFound
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO message_revisions (message_id, content, edited_at) VALUES (?, ?, ?)",
+		previous.MessageID.String(), previous.Content, previous.EditedAt.UnixNano(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *MessageRepository) Delete(ctx context.Context, msg domain.Message) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE messages SET content = ?, deleted_at = ?, deleted_by = ? WHERE id = ? AND room_id = ?",
+		msg.Content, msg.DeletedAt.UnixNano(), msg.DeletedBy.String(), msg.ID.String(), msg.RoomID.String(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrMessageNotFound
+	}
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM message_revisions WHERE message_id = ?",
+		msg.ID.String(),
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM attachments WHERE message_id = ?",
+		msg.ID.String(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *MessageRepository) Revisions(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) ([]domain.MessageRevision, error) {
+	if _, err := r.seqOf(ctx, roomID, messageID); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT content, edited_at FROM message_revisions WHERE message_id = ? ORDER BY id",
+		messageID.String(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revs := make([]domain.MessageRevision, 0)
+	for rows.Next() {
+		rev := domain.MessageRevision{MessageID: messageID}
+		var editedAt int64
+		if err := rows.Scan(&rev.Content, &editedAt); err != nil {
+			return nil, err
+		}
+		rev.EditedAt = time.Unix(0, editedAt).UTC()
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
+
+func (r *MessageRepository) Thread(ctx context.Context, roomID domain.RoomID, rootID domain.MessageID, seq int64, limit int) ([]domain.Message, error) {
+	if _, err := r.seqOf(ctx, roomID, rootID); err != nil {
+		return nil, err
+	}
+	return r.query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE parent_id = ? AND seq > ? ORDER BY seq LIMIT ?",
+		rootID.String(), seq, limit,
+	)
+}
+
+func (r *MessageRepository) LastSeqs(ctx context.Context, roomIDs []domain.RoomID) (map[domain.RoomID]int64, error) {
+	seqs := make(map[domain.RoomID]int64, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return seqs, nil
+	}
+	args := make([]any, 0, len(roomIDs))
+	for _, id := range roomIDs {
+		args = append(args, id.String())
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT room_id, seq FROM room_sequences WHERE room_id IN ("+placeholders+")",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id  string
+			seq int64
+		)
+		if err := rows.Scan(&id, &seq); err != nil {
+			return nil, err
+		}
+		roomID, err := parseID[domain.RoomID](id)
+		if err != nil {
+			return nil, err
+		}
+		seqs[roomID] = seq
+	}
+	return seqs, rows.Err()
+}
+
+func (r *MessageRepository) Search(ctx context.Context, q port.MessageSearch) ([]domain.Message, error) {
+	if len(q.RoomIDs) == 0 {
+		return []domain.Message{}, nil
+	}
+	var (
+		from  = "messages m"
+		where []string
+		args  []any
+	)
+	if len(q.Terms) > 0 {
+		// Each term is a quoted prefix query, FTS5 ANDs them
+		match := make([]string, 0, len(q.Terms))
+		for _, term := range q.Terms {
+			match = append(match, `"`+strings.ReplaceAll(term, `"`, `""`)+`"*`)
+		}
+		from = "message_search s JOIN messages m ON m.pos = s.rowid"
+		where = append(where, "message_search MATCH ?")
+		args = append(args, strings.Join(match, " "))
+	}
+	for _, id := range q.RoomIDs {
+		args = append(args, id.String())
+	}
+	where = append(where, "m.room_id IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(q.RoomIDs)), ", ")+")", "m.deleted_at IS NULL")
+	if q.SenderID != nil {
+		where = append(where, "m.sender_id = ?")
+		args = append(args, q.SenderID.String())
+	}
+	if !q.From.IsZero() {
+		where = append(where, "m.created_at >= ?")
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "m.created_at < ?")
+		args = append(args, q.To.UnixNano())
+	}
+	args = append(args, q.Limit)
+
+	return r.query(ctx,
+		"SELECT m."+strings.ReplaceAll(messageColumns, ", ", ", m.")+" FROM "+from+
+			" WHERE "+strings.Join(where, " AND ")+" ORDER BY m.created_at DESC LIMIT ?",
+		args...,
+	)
+}
+
+func (r *MessageRepository) seqOf(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) (int64, error) {
+	var seq int64
+	err := r.db.QueryRowContext(ctx,
+		"SELECT seq FROM messages WHERE id = ? AND room_id = ?",
+		messageID.String(), roomID.String(),
+	).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, domain.ErrMessageNotFound
+	}
+	return seq, err
+}
+
+func (r *MessageRepository) query(ctx context.Context, query string, args ...any) ([]domain.Message, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := make([]domain.Message, 0)
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return msgs, r.withAttachments(ctx, msgs)
+}
+
+// withAttachments loads the attachments of msgs in one query.
+func (r *MessageRepository) withAttachments(ctx context.Context, msgs []domain.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(msgs))
+	pos := make(map[domain.MessageID]int, len(msgs))
+	for i, msg := range msgs {
+		args = append(args, msg.ID.String())
+		pos[msg.ID] = i
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE message_id IN ("+placeholders+") ORDER BY message_id, position",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id, messageID string
+			createdAt     int64
+			a             domain.Attachment
+		)
+		if err := rows.Scan(&id, &messageID, &a.Name, &a.ContentType, &a.Size, &a.Key, &createdAt, &a.Width, &a.Height, &a.ThumbnailKey); err != nil {
+			return err
+		}
+		if a.ID, err = parseID[domain.AttachmentID](id); err != nil {
+			return err
+		}
+		msgID, err := parseID[domain.MessageID](messageID)
+		if err != nil {
+			return err
+		}
+		a.CreatedAt = time.Unix(0, createdAt).UTC()
+		msg := &msgs[pos[msgID]]
+		msg.Attachments = append(msg.Attachments, a)
+	}
+	return rows.Err()
+}
+
+func scanMessage(rows *sql.Rows) (domain.Message, error) {
+	var (
+		id, roomID, senderID string
+		createdAt            int64
+		editedAt, deletedAt  sql.NullInt64
+		deletedBy, parentID  sql.NullString
+		msg                  domain.Message
+	)
+	if err := rows.Scan(&id, &roomID, &senderID, &msg.Content, &msg.Seq, &createdAt, &editedAt, &deletedAt, &deletedBy, &parentID, &msg.ReplyCount); err != nil {
+		return msg, err
+	}
+
+	var err error
+	if msg.ID, err = parseID[domain.MessageID](id); err != nil {
+		return msg, err
+	}
+	if msg.RoomID, err = parseID[domain.RoomID](roomID); err != nil {
+		return msg, err
+	}
+	if msg.SenderID, err = parseID[domain.UserID](senderID); err != nil {
+		return msg, err
+	}
+	msg.CreatedAt = time.Unix(0, createdAt).UTC()
+	if editedAt.Valid {
+		msg.EditedAt = time.Unix(0, editedAt.Int64).UTC()
+	}
+	if deletedAt.Valid {
+		msg.DeletedAt = time.Unix(0, deletedAt.Int64).UTC()
+		if msg.DeletedBy, err = parseID[domain.UserID](deletedBy.String); err != nil {
+			return msg, err
+		}
+	}
+	if parentID.Valid {
+		parent, err := parseID[domain.MessageID](parentID.String)
+		if err != nil {
+			return msg, err
+		}
+		msg.ParentID = &parent
+	}
+	return msg, nil
+}
+
+// parseID decodes a TEXT uuid column into one of the domain ID types.
+func parseID[T ~[16]byte](s string) (T, error) {
+	id, err := uuid.Parse(s)
+	return T(id), err
+}
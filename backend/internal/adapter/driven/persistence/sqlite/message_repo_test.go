@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/searchtest"
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open(context.Background(), filepath.Join(t.TempDir(), "ya.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// saveMessages stores one message per content in roomID, a second apart
+// starting at base.
+func saveMessages(t *testing.T, repo *MessageRepository, roomID domain.RoomID, sender domain.UserID, base time.Time, contents ...string) []domain.Message {
+	t.Helper()
+	out := make([]domain.Message, 0, len(contents))
+	for i, content := range contents {
+		msg, err := domain.NewMessage(sender, roomID, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		if err := repo.Save(context.Background(), msg); err != nil {
+			t.Fatalf("save %q: %v", content, err)
+		}
+		out = append(out, *msg)
+	}
+	return out
+}
+
+func contents(msgs []domain.Message) []string {
+	out := make([]string, len(msgs))
+	for i, msg := range msgs {
+		out[i] = msg.Content
+	}
+	return out
+}
+
+// checkSearchIndex fails unless the FTS index matches the messages table.
+func checkSearchIndex(t *testing.T, db *sql.DB) {
+	t.Helper()
+	if _, err := db.Exec("INSERT INTO message_search (message_search, rank) VALUES ('integrity-check', 1)"); err != nil {
+		t.Fatalf("search index out of sync: %v", err)
+	}
+}
+
+func TestMessageSearch(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMessageRepository(db)
+	ctx := context.Background()
+	roomID, other, hidden := domain.NewRoomID(), domain.NewRoomID(), domain.NewRoomID()
+	alice, bob := domain.NewUserID(), domain.NewUserID()
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	saveMessages(t, repo, roomID, alice, base, "Deploying the new Release tonight", "lunch?")
+	saveMessages(t, repo, other, bob, base.Add(time.Minute), "release went fine")
+	saveMessages(t, repo, hidden, bob, base, "release notes are private")
+	gone := saveMessages(t, repo, roomID, alice, base.Add(2*time.Minute), "release canceled")[0]
+	gone.Delete(alice)
+	if err := repo.Delete(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+	edited := saveMessages(t, repo, roomID, bob, base.Add(3*time.Minute), "dinner plans")[0]
+	rev, err := edited.Edit("breakfast plans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Edit(ctx, edited, rev); err != nil {
+		t.Fatal(err)
+	}
+	checkSearchIndex(t, db)
+
+	rooms := []domain.RoomID{roomID, other}
+	tests := []struct {
+		name string
+		q    port.MessageSearch
+		want []string
+	}{
+		{"prefix newest first", port.MessageSearch{Terms: []string{"rel"}, RoomIDs: rooms, Limit: 10},
+			[]string{"release went fine", "Deploying the new Release tonight"}},
+		{"all terms", port.MessageSearch{Terms: []string{"release", "tonight"}, RoomIDs: rooms, Limit: 10},
+			[]string{"Deploying the new Release tonight"}},
+		{"sender", port.MessageSearch{SenderID: &bob, RoomIDs: rooms, Limit: 10},
+			[]string{"breakfast plans", "release went fine"}},
+		{"range", port.MessageSearch{Terms: []string{"release"}, RoomIDs: rooms, To: base.Add(time.Minute), Limit: 10},
+			[]string{"Deploying the new Release tonight"}},
+		{"limit", port.MessageSearch{Terms: []string{"release"}, RoomIDs: rooms, Limit: 1},
+			[]string{"release went fine"}},
+		{"edited content", port.MessageSearch{Terms: []string{"breakfast"}, RoomIDs: rooms, Limit: 10},
+			[]string{"breakfast plans"}},
+		{"content before the edit", port.MessageSearch{Terms: []string{"dinner"}, RoomIDs: rooms, Limit: 10},
+			[]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := repo.Search(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := contents(msgs); !slices.Equal(got, tt.want) {
+				t.Fatalf("found %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Databases indexed by message ID keep their search results once moved to
+// the index keyed by rowid.
+func TestMigrateSearchIndex(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ya.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries[:12] {
+		script, err := migrations.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, string(script)); err != nil {
+			t.Fatalf("%s: %v", entry.Name(), err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", 12)); err != nil {
+		t.Fatal(err)
+	}
+	roomID, sender := domain.NewRoomID(), domain.NewUserID()
+	saveMessages(t, NewMessageRepository(db), roomID, sender, time.Now().UTC(), "release tonight", "lunch?")
+	db.Close()
+
+	db, err = Open(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkSearchIndex(t, db)
+	msgs, err := NewMessageRepository(db).Search(ctx, port.MessageSearch{Terms: []string{"release"}, RoomIDs: []domain.RoomID{roomID}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(msgs); !slices.Equal(got, []string{"release tonight"}) {
+		t.Fatalf("found %q after migrating", got)
+	}
+}
+
+func TestSearchWords(t *testing.T) {
+	searchtest.Run(t, NewMessageRepository(openTestDB(t)))
+}
@@ -0,0 +1,11 @@
+CREATE TABLE messages (
+    pos        INTEGER PRIMARY KEY AUTOINCREMENT,
+    id         TEXT    NOT NULL UNIQUE,
+    room_id    TEXT    NOT NULL,
+    sender_id  TEXT    NOT NULL,
+    content    TEXT    NOT NULL,
+    created_at INTEGER NOT NULL -- unix nanoseconds, UTC
+);
+
+CREATE INDEX messages_room_pos ON messages (room_id, pos);
+CREATE INDEX messages_room_created_at ON messages (room_id, created_at);
@@ -0,0 +1,18 @@
+-- Per-room sequence numbers, allocated from room_sequences on insert.
+ALTER TABLE messages ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+
+UPDATE messages SET seq = (
+    SELECT COUNT(*) FROM messages AS m
+    WHERE m.room_id = messages.room_id AND m.pos <= messages.pos
+);
+
+CREATE UNIQUE INDEX messages_room_seq ON messages (room_id, seq);
+DROP INDEX messages_room_pos;
+
+CREATE TABLE room_sequences (
+    room_id TEXT    PRIMARY KEY,
+    seq     INTEGER NOT NULL
+);
+
+INSERT INTO room_sequences (room_id, seq)
+SELECT room_id, MAX(seq) FROM messages GROUP BY room_id;
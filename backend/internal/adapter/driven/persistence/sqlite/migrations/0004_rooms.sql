@@ -0,0 +1,18 @@
+CREATE TABLE rooms (
+    id         TEXT    PRIMARY KEY,
+    name       TEXT    NOT NULL,
+    topic      TEXT    NOT NULL DEFAULT '',
+    kind       TEXT    NOT NULL,
+    created_by TEXT    NOT NULL,
+    created_at INTEGER NOT NULL -- unix nanoseconds, UTC
+);
+
+CREATE TABLE room_members (
+    room_id   TEXT    NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id   TEXT    NOT NULL,
+    role      TEXT    NOT NULL,
+    joined_at INTEGER NOT NULL, -- unix nanoseconds, UTC
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX room_members_user ON room_members (user_id);
@@ -0,0 +1,7 @@
+CREATE TABLE room_bans (
+    room_id    TEXT    NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id    TEXT    NOT NULL,
+    banned_by  TEXT    NOT NULL,
+    created_at INTEGER NOT NULL, -- unix nanoseconds, UTC
+    PRIMARY KEY (room_id, user_id)
+);
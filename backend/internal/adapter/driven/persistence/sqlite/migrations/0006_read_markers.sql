@@ -0,0 +1,10 @@
+CREATE TABLE read_markers (
+    room_id    TEXT    NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id    TEXT    NOT NULL,
+    message_id TEXT    NOT NULL,
+    seq        INTEGER NOT NULL,
+    read_at    INTEGER NOT NULL, -- unix nanoseconds, UTC
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX read_markers_user ON read_markers (user_id);
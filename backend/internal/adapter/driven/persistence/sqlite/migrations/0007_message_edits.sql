@@ -0,0 +1,12 @@
+ALTER TABLE messages ADD COLUMN edited_at INTEGER; -- unix nanoseconds, UTC
+ALTER TABLE messages ADD COLUMN deleted_at INTEGER;
+ALTER TABLE messages ADD COLUMN deleted_by TEXT;
+
+CREATE TABLE message_revisions (
+    id         INTEGER PRIMARY KEY,
+    message_id TEXT    NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    content    TEXT    NOT NULL,
+    edited_at  INTEGER NOT NULL -- unix nanoseconds, UTC
+);
+
+CREATE INDEX message_revisions_message ON message_revisions (message_id, id);
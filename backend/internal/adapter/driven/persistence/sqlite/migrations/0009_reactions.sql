@@ -0,0 +1,8 @@
+CREATE TABLE message_reactions (
+    message_id TEXT    NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    room_id    TEXT    NOT NULL,
+    user_id    TEXT    NOT NULL,
+    emoji      TEXT    NOT NULL,
+    created_at INTEGER NOT NULL, -- unix nanoseconds, UTC
+    PRIMARY KEY (message_id, user_id, emoji)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE attachments (
+    id           TEXT    PRIMARY KEY,
+    message_id   TEXT    NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    position     INTEGER NOT NULL, -- upload order within the message
+    name         TEXT    NOT NULL,
+    content_type TEXT    NOT NULL,
+    size         INTEGER NOT NULL,
+    blob_key     TEXT    NOT NULL,
+    created_at   INTEGER NOT NULL, -- unix nanoseconds, UTC
+    UNIQUE (message_id, position)
+);
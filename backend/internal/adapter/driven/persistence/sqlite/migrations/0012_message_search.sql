@@ -0,0 +1,28 @@
+-- Words are split like domain.SearchTerms: letters and digits, lowercased
+CREATE VIRTUAL TABLE message_search USING fts5 (
+    content,
+    message_id UNINDEXED,
+    tokenize = 'unicode61 remove_diacritics 0'
+);
+
+INSERT INTO message_search (content, message_id)
+SELECT content, id FROM messages WHERE content <> '';
+
+CREATE TRIGGER message_search_insert AFTER INSERT ON messages
+WHEN new.content <> ''
+BEGIN
+    INSERT INTO message_search (content, message_id) VALUES (new.content, new.id);
+END;
+
+-- Edits replace the indexed content, deletions empty it
+CREATE TRIGGER message_search_update AFTER UPDATE OF content ON messages
+BEGIN
+    DELETE FROM message_search WHERE message_id = old.id;
+    INSERT INTO message_search (content, message_id)
+    SELECT new.content, new.id WHERE new.content <> '';
+END;
+
+CREATE TRIGGER message_search_delete AFTER DELETE ON messages
+BEGIN
+    DELETE FROM message_search WHERE message_id = old.id;
+END;
@@ -0,0 +1,33 @@
+-- The index reads content from messages and is keyed by their rowid, pos,
+-- so triggers no longer scan it for a message ID
+DROP TRIGGER message_search_insert;
+DROP TRIGGER message_search_update;
+DROP TRIGGER message_search_delete;
+DROP TABLE message_search;
+
+CREATE VIRTUAL TABLE message_search USING fts5 (
+    content,
+    content = 'messages',
+    content_rowid = 'pos',
+    tokenize = 'unicode61 remove_diacritics 0'
+);
+
+INSERT INTO message_search (message_search) VALUES ('rebuild');
+
+-- Every message is indexed, deleted ones have no content and so no words.
+-- 'delete' must be given the content that was indexed.
+CREATE TRIGGER message_search_insert AFTER INSERT ON messages
+BEGIN
+    INSERT INTO message_search (rowid, content) VALUES (new.pos, new.content);
+END;
+
+CREATE TRIGGER message_search_update AFTER UPDATE OF content ON messages
+BEGIN
+    INSERT INTO message_search (message_search, rowid, content) VALUES ('delete', old.pos, old.content);
+    INSERT INTO message_search (rowid, content) VALUES (new.pos, new.content);
+END;
+
+CREATE TRIGGER message_search_delete AFTER DELETE ON messages
+BEGIN
+    INSERT INTO message_search (message_search, rowid, content) VALUES ('delete', old.pos, old.content);
+END;
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+const reactionColumns = "message_id, room_id, user_id, emoji, created_at"
+
+type ReactionRepository struct {
+	db *sql.DB
+}
+
+func NewReactionRepository(db *sql.DB) *ReactionRepository {
+	return &ReactionRepository{db: db}
+}
+
+func (r *ReactionRepository) Add(ctx context.Context, reaction domain.Reaction) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"INSERT INTO message_reactions ("+reactionColumns+") VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		reaction.MessageID.String(), reaction.RoomID.String(), reaction.UserID.String(), reaction.Emoji, reaction.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return false, domain.ErrMessageNotFound
+		}
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *ReactionRepository) Remove(ctx context.Context, messageID domain.MessageID, userID domain.UserID, emoji string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?",
+		messageID.String(), userID.String(), emoji,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *ReactionRepository) ForMessages(ctx context.Context, messageIDs []domain.MessageID) (map[domain.MessageID][]domain.Reaction, error) {
+	out := make(map[domain.MessageID][]domain.Reaction)
+	if len(messageIDs) == 0 {
+		return out, nil
+	}
+	args := make([]any, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		args = append(args, id.String())
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+reactionColumns+" FROM message_reactions WHERE message_id IN ("+placeholders+") ORDER BY created_at, rowid",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			messageID, roomID, userID string
+			createdAt                 int64
+			re                        domain.Reaction
+		)
+		if err := rows.Scan(&messageID, &roomID, &userID, &re.Emoji, &createdAt); err != nil {
+			return nil, err
+		}
+		if re.MessageID, err = parseID[domain.MessageID](messageID); err != nil {
+			return nil, err
+		}
+		if re.RoomID, err = parseID[domain.RoomID](roomID); err != nil {
+			return nil, err
+		}
+		if re.UserID, err = parseID[domain.UserID](userID); err != nil {
+			return nil, err
+		}
+		re.CreatedAt = time.Unix(0, createdAt).UTC()
+		out[re.MessageID] = append(out[re.MessageID], re)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+const readMarkerColumns = "room_id, user_id, message_id, seq, read_at"
+
+type ReadMarkerRepository struct {
+	db *sql.DB
+}
+
+func NewReadMarkerRepository(db *sql.DB) *ReadMarkerRepository {
+	return &ReadMarkerRepository{db: db}
+}
+
+func (r *ReadMarkerRepository) Advance(ctx context.Context, marker domain.ReadMarker) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO read_markers (`+readMarkerColumns+`) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (room_id, user_id) DO UPDATE
+		SET message_id = excluded.message_id, seq = excluded.seq, read_at = excluded.read_at
+		WHERE excluded.seq > read_markers.seq`,
+		marker.RoomID.String(), marker.UserID.String(), marker.MessageID.String(), marker.Seq, marker.ReadAt.UnixNano(),
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return false, domain.ErrRoomNotFound
+		}
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *ReadMarkerRepository) ForRoom(ctx context.Context, roomID domain.RoomID) ([]domain.ReadMarker, error) {
+	return r.query(ctx,
+		"SELECT "+readMarkerColumns+" FROM read_markers WHERE room_id = ?",
+		roomID.String(),
+	)
+}
+
+func (r *ReadMarkerRepository) ForUser(ctx context.Context, userID domain.UserID) (map[domain.RoomID]domain.ReadMarker, error) {
+	markers, err := r.query(ctx,
+		"SELECT "+readMarkerColumns+" FROM read_markers WHERE user_id = ?",
+		userID.String(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[domain.RoomID]domain.ReadMarker, len(markers))
+	for _, m := range markers {
+		out[m.RoomID] = m
+	}
+	return out, nil
+}
+
+func (r *ReadMarkerRepository) query(ctx context.Context, query string, args ...any) ([]domain.ReadMarker, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	markers := make([]domain.ReadMarker, 0)
+	for rows.Next() {
+		var (
+			roomID, userID, messageID string
+			readAt                    int64
+			m                         domain.ReadMarker
+		)
+		if err := rows.Scan(&roomID, &userID, &messageID, &m.Seq, &readAt); err != nil {
+			return nil, err
+		}
+		if m.RoomID, err = parseID[domain.RoomID](roomID); err != nil {
+			return nil, err
+		}
+		if m.UserID, err = parseID[domain.UserID](userID); err != nil {
+			return nil, err
+		}
+		if m.MessageID, err = parseID[domain.MessageID](messageID); err != nil {
+			return nil, err
+		}
+		m.ReadAt = time.Unix(0, readAt).UTC()
+		markers = append(markers, m)
+	}
+	return markers, rows.Err()
+}
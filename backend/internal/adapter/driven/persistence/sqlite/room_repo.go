@@ -0,0 +1,277 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+const roomColumns = "id, name, topic, kind, created_by, created_at"
+
+type RoomRepository struct {
+	db *sql.DB
+}
+
+func NewRoomRepository(db *sql.DB) *RoomRepository {
+	return &RoomRepository{db: db}
+}
+
+func (r *RoomRepository) Create(ctx context.Context, room domain.Room) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO rooms ("+roomColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		room.ID.String(), room.Name, room.Topic, string(room.Kind), room.CreatedBy.String(), room.CreatedAt.UnixNano(),
+	); err != nil {
+		if isUniqueViolation(err) {
+			return domain.ErrRoomExists
+		}
+		return err
+	}
+	for _, m := range room.Members {
+		if err := insertMember(ctx, tx, room.ID, m); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *RoomRepository) Get(ctx context.Context, id domain.RoomID) (domain.Room, error) {
+	rooms, err := r.queryRooms(ctx, "SELECT "+roomColumns+" FROM rooms WHERE id = ?", id.String())
+	if err != nil {
+		return domain.Room{}, err
+	}
+	if len(rooms) == 0 {
+		return domain.Room{}, domain.ErrRoomNotFound
+	}
+	return rooms[0], nil
+}
+
+func (r *RoomRepository) ListForUser(ctx context.Context, userID domain.UserID) ([]domain.Room, error) {
+	return r.queryRooms(ctx,
+		`SELECT `+roomColumns+` FROM rooms
+		WHERE id IN (SELECT room_id FROM room_members WHERE user_id = ?)
+		ORDER BY created_at`,
+		userID.String(),
+	)
+}
+
+func (r *RoomRepository) Update(ctx context.Context, room domain.Room) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE rooms SET name = ?, topic = ? WHERE id = ?",
+		room.Name, room.Topic, room.ID.String(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrRoomNotFound
+	}
+	return nil
+}
+
+func (r *RoomRepository) AddMember(ctx context.Context, roomID domain.RoomID, member domain.Member) error {
+	err := insertMember(ctx, r.db, roomID, member)
+	switch {
+	case isUniqueViolation(err):
+		return domain.ErrAlreadyMember
+	case isForeignKeyViolation(err):
+		return domain.ErrRoomNotFound
+	}
+	return err
+}
+
+func (r *RoomRepository) RemoveMember(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	res, err := r.db.ExecContext(ctx,
+		"DELETE FROM room_members WHERE room_id = ? AND user_id = ?",
+		roomID.String(), userID.String(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrNotMember
+	}
+	return nil
+}
+
+func (r *RoomRepository) Member(ctx context.Context, roomID domain.RoomID, userID domain.UserID) (domain.Member, error) {
+	row := r.db.QueryRowContext(ctx,
+		"SELECT user_id, role, joined_at FROM room_members WHERE room_id = ? AND user_id = ?",
+		roomID.String(), userID.String(),
+	)
+	m, err := scanMember(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, domain.ErrNotMember
+	}
+	return m, err
+}
+
+func (r *RoomRepository) UpdateMember(ctx context.Context, roomID domain.RoomID, member domain.Member) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?",
+		string(member.Role), roomID.String(), member.UserID.String(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrNotMember
+	}
+	return nil
+}
+
+func (r *RoomRepository) AddBan(ctx context.Context, ban domain.Ban) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO room_bans (room_id, user_id, banned_by, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (room_id, user_id) DO NOTHING`,
+		ban.RoomID.String(), ban.UserID.String(), ban.BannedBy.String(), ban.CreatedAt.UnixNano(),
+	); err != nil {
+		if isForeignKeyViolation(err) {
+			return domain.ErrRoomNotFound
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM room_members WHERE room_id = ? AND user_id = ?",
+		ban.RoomID.String(), ban.UserID.String(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *RoomRepository) RemoveBan(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	_, err := r.db.ExecContext(ctx,
+		"DELETE FROM room_bans WHERE room_id = ? AND user_id = ?",
+		roomID.String(), userID.String(),
+	)
+	return err
+}
+
+func (r *RoomRepository) IsBanned(ctx context.Context, roomID domain.RoomID, userID domain.UserID) (bool, error) {
+	var banned bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM room_bans WHERE room_id = ? AND user_id = ?)",
+		roomID.String(), userID.String(),
+	).Scan(&banned)
+	return banned, err
+}
+
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertMember(ctx context.Context, db execer, roomID domain.RoomID, m domain.Member) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO room_members (room_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)",
+		roomID.String(), m.UserID.String(), string(m.Role), m.JoinedAt.UnixNano(),
+	)
+	return err
+}
+
+// queryRooms loads the selected rooms and then all of their members in a
+// single extra query.
+func (r *RoomRepository) queryRooms(ctx context.Context, query string, args ...any) ([]domain.Room, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := make([]domain.Room, 0)
+	index := make(map[string]int)
+	for rows.Next() {
+		var (
+			room                domain.Room
+			id, kind, createdBy string
+			createdAt           int64
+		)
+		if err := rows.Scan(&id, &room.Name, &room.Topic, &kind, &createdBy, &createdAt); err != nil {
+			return nil, err
+		}
+		if room.ID, err = parseID[domain.RoomID](id); err != nil {
+			return nil, err
+		}
+		if room.CreatedBy, err = parseID[domain.UserID](createdBy); err != nil {
+			return nil, err
+		}
+		room.Kind = domain.RoomKind(kind)
+		room.CreatedAt = time.Unix(0, createdAt).UTC()
+		room.Members = []domain.Member{}
+		index[id] = len(rooms)
+		rooms = append(rooms, room)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Release the connection before the next query, the pool holds only one
+	rows.Close()
+	if len(rooms) == 0 {
+		return rooms, nil
+	}
+
+	ids := make([]any, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	memberRows, err := r.db.QueryContext(ctx,
+		"SELECT room_id, user_id, role, joined_at FROM room_members WHERE room_id IN ("+placeholders+") ORDER BY joined_at",
+		ids...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer memberRows.Close()
+	for memberRows.Next() {
+		var (
+			roomID       string
+			userID, role string
+			joinedAt     int64
+		)
+		if err := memberRows.Scan(&roomID, &userID, &role, &joinedAt); err != nil {
+			return nil, err
+		}
+		m := domain.Member{Role: domain.Role(role), JoinedAt: time.Unix(0, joinedAt).UTC()}
+		if m.UserID, err = parseID[domain.UserID](userID); err != nil {
+			return nil, err
+		}
+		i := index[roomID]
+		rooms[i].Members = append(rooms[i].Members, m)
+	}
+	return rooms, memberRows.Err()
+}
+
+func scanMember(row scanner) (domain.Member, error) {
+	var (
+		m            domain.Member
+		userID, role string
+		joinedAt     int64
+	)
+	if err := row.Scan(&userID, &role, &joinedAt); err != nil {
+		return m, err
+	}
+	var err error
+	if m.UserID, err = parseID[domain.UserID](userID); err != nil {
+		return m, err
+	}
+	m.Role = domain.Role(role)
+	m.JoinedAt = time.Unix(0, joinedAt).UTC()
+	return m, nil
+}
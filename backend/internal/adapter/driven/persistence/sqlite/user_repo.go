@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+const userColumns = "id, username, display_name, avatar_ref, status, status_text, created_at"
+
+type UserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+func (r *UserRepository) Create(ctx context.Context, user domain.User, passwordHash []byte) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO users ("+userColumns+", password_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		user.ID.String(), user.Username, user.DisplayName, user.AvatarRef, string(user.Status), user.StatusText, user.CreatedAt.UnixNano(), passwordHash,
+	)
+	if isUniqueViolation(err) {
+		return domain.ErrUsernameTaken
+	}
+	return err
+}
+
+func (r *UserRepository) Get(ctx context.Context, id domain.UserID) (domain.User, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id.String())
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, domain.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r *UserRepository) GetMany(ctx context.Context, ids []domain.UserID) (map[domain.UserID]domain.User, error) {
+	out := make(map[domain.UserID]domain.User, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id.String()
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[user.ID] = user
+	}
+	return out, rows.Err()
+}
+
+func (r *UserRepository) Update(ctx context.Context, user domain.User) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE users SET display_name = ?, avatar_ref = ?, status = ?, status_text = ? WHERE id = ?",
+		user.DisplayName, user.AvatarRef, string(user.Status), user.StatusText, user.ID.String(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) PasswordHash(ctx context.Context, username string) (domain.UserID, []byte, error) {
+	var (
+		id   string
+		hash []byte
+	)
+	err := r.db.QueryRowContext(ctx, "SELECT id, password_hash FROM users WHERE username = ?", username).Scan(&id, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.UserID{}, nil, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return domain.UserID{}, nil, err
+	}
+	userID, err := parseID[domain.UserID](id)
+	return userID, hash, err
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (domain.User, error) {
+	var (
+		user      domain.User
+		id        string
+		status    string
+		createdAt int64
+	)
+	if err := row.Scan(&id, &user.Username, &user.DisplayName, &user.AvatarRef, &status, &user.StatusText, &createdAt); err != nil {
+		return user, err
+	}
+	var err error
+	if user.ID, err = parseID[domain.UserID](id); err != nil {
+		return user, err
+	}
+	user.Status = domain.UserStatus(status)
+	user.CreatedAt = time.Unix(0, createdAt).UTC()
+	return user, nil
+}
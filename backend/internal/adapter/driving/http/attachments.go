@@ -0,0 +1,99 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/service"
+)
+
+const (
+	// uploadMemory is how much of a multipart form is kept in memory, the
+	// rest is spooled to temporary files
+	uploadMemory = 8 << 20
+	// uploadOverhead allows for the form fields and part headers around the
+	// files themselves
+	uploadOverhead = 1 << 20
+)
+
+// POST /rooms/{roomID}/attachments
+// multipart/form-data: one or more "file" parts, optional "content" and
+// "parent_id" fields. Sends a message carrying the files.
+func (h *Handler) UploadAttachments(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	limits := h.ChatService.AttachmentConfig()
+	r.Body = http.MaxBytesReader(w, r.Body, int64(limits.MaxFiles)*limits.MaxSize+uploadOverhead)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, domain.ErrAttachmentTooLarge.Error())
+		} else {
+			writeError(w, http.StatusBadRequest, "invalid multipart form")
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var parentID *domain.MessageID
+	if raw := r.FormValue("parent_id"); raw != "" {
+		id, err := domain.NewMessageIDFromString(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid parent_id")
+			return
+		}
+		parentID = &id
+	}
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		writeError(w, http.StatusBadRequest, "missing file")
+		return
+	}
+
+	uploads := make([]service.Upload, 0, len(files))
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		defer f.Close()
+		contentType, err := sniff(f)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		uploads = append(uploads, service.Upload{
+			Name:        fh.Filename,
+			ContentType: contentType,
+			Size:        fh.Size,
+			Body:        f,
+		})
+	}
+
+	msg, err := h.ChatService.SendFiles(r.Context(), userID, roomID, parentID, r.FormValue("content"), uploads)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newMessageDTO(msg))
+}
+
+// sniff detects the content type of f from its first bytes, whatever the
+// client claims, and rewinds it.
+func sniff(f multipart.File) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
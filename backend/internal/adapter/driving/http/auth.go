@@ -0,0 +1,136 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/rs/zerolog/log"
+)
+
+// AuthConfig plugs authentication providers into the handler.
+type AuthConfig struct {
+	// Verifier checks bearer tokens. When nil authentication is disabled and
+	// every connection gets an anonymous identity: development only.
+	Verifier port.TokenVerifier
+	// Passwords and Issuer together enable POST /auth/login.
+	Passwords port.PasswordAuthenticator
+	Issuer    port.TokenIssuer
+}
+
+type contextKey int
+
+const userIDKey contextKey = iota
+
+func withUserID(ctx context.Context, userID domain.UserID) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// userIDFromContext returns the authenticated user of a request. ok is false
+// when authentication is disabled.
+func userIDFromContext(ctx context.Context) (userID domain.UserID, ok bool) {
+	userID, ok = ctx.Value(userIDKey).(domain.UserID)
+	return userID, ok
+}
+
+// authenticate rejects requests without a valid bearer token and stores the
+// authenticated user in the request context.
+func (h *Handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.auth.Verifier == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := bearerToken(r)
+		if token == "" {
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		identity, err := h.auth.Verifier.VerifyToken(r.Context(), token)
+		if err != nil {
+			log.Debug().Err(err).Msg("Rejected bearer token")
+			writeError(w, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+		if err := h.UserService.Provision(r.Context(), identity); err != nil {
+			log.Error().Err(err).Msg("Failed to provision user")
+			writeError(w, http.StatusInternalServerError, "failed to provision user")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), identity.UserID)))
+	})
+}
+
+// requireUser returns the authenticated user, answering 401 when the request
+// is anonymous.
+func requireUser(w http.ResponseWriter, r *http.Request) (domain.UserID, bool) {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+	}
+	return userID, ok
+}
+
+// bearerToken reads the Authorization header. Browsers cannot set headers on
+// a WebSocket upgrade, so the token may also be offered as a
+// "ya.bearer.<token>" subprotocol or, as a last resort, the access_token query
+// parameter.
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if token := protocolCredential(r, bearerProtocolPrefix); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// POST /auth/login {"username": "...", "password": "..."}
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	if h.auth.Passwords == nil || h.auth.Issuer == nil {
+		writeError(w, http.StatusNotFound, "password login is not enabled")
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, err := h.auth.Passwords.Authenticate(r.Context(), req.Username, req.Password)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	// Users of a users file have no profile until their first login
+	if err := h.UserService.Provision(r.Context(), domain.Identity{UserID: userID, Username: req.Username, DisplayName: req.Username}); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	token, expiresAt, err := h.auth.Issuer.IssueToken(r.Context(), userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to issue token")
+		writeError(w, http.StatusInternalServerError, "failed to issue token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+		UserID    string    `json:"user_id"`
+	}{token, expiresAt, userID.String()})
+}
@@ -0,0 +1,271 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+// OverflowPolicy decides what happens when a client does not read fast
+// enough and its outbound queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest discards the oldest queued frame to make room
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowDisconnect closes the connection of the slow consumer
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case OverflowDropOldest, OverflowDisconnect:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q", s)
+}
+
+type WSConfig struct {
+	// QueueSize is the number of frames buffered per client
+	QueueSize    int
+	Overflow     OverflowPolicy
+	WriteTimeout time.Duration
+	// PingInterval is how often the server pings each client. A client that
+	// sends nothing, not even a pong, for PongTimeout is disconnected.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+}
+
+func DefaultWSConfig() WSConfig {
+	return WSConfig{
+		QueueSize:    256,
+		Overflow:     OverflowDropOldest,
+		WriteTimeout: 10 * time.Second,
+		PingInterval: 25 * time.Second,
+		PongTimeout:  60 * time.Second,
+	}
+}
+
+func (c WSConfig) Validate() error {
+	if c.QueueSize < 1 {
+		return errors.New("queue size must be positive")
+	}
+	if c.PingInterval <= 0 || c.PingInterval >= c.PongTimeout {
+		return errors.New("ping interval must be positive and shorter than the pong timeout")
+	}
+	return nil
+}
+
+var errSlowConsumer = errors.New("client too slow, outbound queue full")
+
+var wsMetrics = expvar.NewMap("ws")
+
+// WSClient is one WebSocket connection. Frames are queued by any goroutine
+// and written by the client's own write pump, so a slow client never blocks
+// the hub or the SFU.
+type WSClient struct {
+	id   domain.UserID
+	conn *websocket.Conn
+	cfg  WSConfig
+
+	// enqueueMu makes drop-oldest and enqueue a single step
+	enqueueMu sync.Mutex
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// Live messages buffered per room while its backlog is being replayed
+	holdMu sync.Mutex
+	held   map[domain.RoomID][]heldEvent
+}
+
+// heldEvent is a live message, or an update to one, waiting for the replay
+// of its room to finish.
+type heldEvent struct {
+	typ string
+	msg domain.Message
+}
+
+func newWSClient(id domain.UserID, conn *websocket.Conn, cfg WSConfig) *WSClient {
+	c := &WSClient{
+		id:   id,
+		conn: conn,
+		cfg:  cfg,
+		send: make(chan []byte, cfg.QueueSize),
+		done: make(chan struct{}),
+		held: make(map[domain.RoomID][]heldEvent),
+	}
+	go c.writePump()
+	return c
+}
+
+func (c *WSClient) ID() string {
+	return c.id.String()
+}
+
+func (c *WSClient) SendText(msg domain.Message) error {
+	return c.pushMessage(typeMessage, msg)
+}
+
+// SendUpdate is held like SendText so an edit or deletion never overtakes
+// the replay of the message it changes.
+func (c *WSClient) SendUpdate(msg domain.Message) error {
+	return c.pushMessage(typeMessageUpdate, msg)
+}
+
+func (c *WSClient) pushMessage(typ string, msg domain.Message) error {
+	c.holdMu.Lock()
+	if buf, ok := c.held[msg.RoomID]; ok {
+		c.held[msg.RoomID] = append(buf, heldEvent{typ: typ, msg: msg})
+		c.holdMu.Unlock()
+		return nil
+	}
+	c.holdMu.Unlock()
+
+	return c.push(typ, newMessageDTO(msg))
+}
+
+// Close stops the write pump and closes the connection, which in turn ends
+// the read loop of ServeWS. Safe to call more than once.
+func (c *WSClient) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *WSClient) SendSignal(signal domain.Signal) error {
+	return c.push(typeSignal, newSignalDTO(signal))
+}
+
+func (c *WSClient) SendCallEnded(roomID domain.RoomID) error {
+	return c.push(typeCallEnded, callEndedDTO{RoomID: roomID.String()})
+}
+
+func (c *WSClient) SendReceipt(m domain.ReadMarker) error {
+	return c.push(typeReceipt, newReceiptDTO(m))
+}
+
+func (c *WSClient) SendReaction(r domain.ReactionChange) error {
+	return c.push(typeReaction, newReactionDTO(r))
+}
+
+func (c *WSClient) SendTyping(t domain.Typing) error {
+	return c.push(typeTyping, newTypingDTO(t))
+}
+
+func (c *WSClient) SendPresence(p domain.Presence) error {
+	return c.push(typePresence, newPresenceDTO(p))
+}
+
+// hold starts buffering live messages of roomID instead of writing them.
+func (c *WSClient) hold(roomID domain.RoomID) {
+	c.holdMu.Lock()
+	defer c.holdMu.Unlock()
+	c.held[roomID] = []heldEvent{}
+}
+
+// release writes the events buffered since hold, skipping messages already
+// covered by the replay, and resumes live delivery for roomID. Updates are
+// always written, after the replay they apply to.
+func (c *WSClient) release(roomID domain.RoomID, replayedSeq int64) error {
+	c.holdMu.Lock()
+	defer c.holdMu.Unlock()
+
+	buf := c.held[roomID]
+	delete(c.held, roomID)
+	for _, ev := range buf {
+		if ev.typ == typeMessage && ev.msg.Seq <= replayedSeq {
+			continue
+		}
+		if err := c.push(ev.typ, newMessageDTO(ev.msg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// push sends an event the client did not ask for.
+func (c *WSClient) push(typ string, payload any) error {
+	return c.writeJSON(outboundEnvelope{V: protocolVersion, Type: typ, Payload: payload})
+}
+
+// reply answers the request identified by id.
+func (c *WSClient) reply(id, typ string, payload any) error {
+	return c.writeJSON(outboundEnvelope{V: protocolVersion, Type: typ, ID: id, Payload: payload})
+}
+
+func (c *WSClient) writeJSON(v any) error {
+	frame, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.enqueue(frame)
+}
+
+// enqueue queues a frame for the write pump, applying the overflow policy
+// when the queue is full.
+func (c *WSClient) enqueue(frame []byte) error {
+	c.enqueueMu.Lock()
+	defer c.enqueueMu.Unlock()
+
+	for {
+		select {
+		case <-c.done:
+			return websocket.ErrCloseSent
+		case c.send <- frame:
+			return nil
+		default:
+		}
+
+		if c.cfg.Overflow == OverflowDisconnect {
+			wsMetrics.Add("slow_consumers_disconnected", 1)
+			log.Warn().Str("client_id", c.ID()).Msg("Disconnecting slow client")
+			c.Close()
+			return errSlowConsumer
+		}
+		select {
+		case <-c.send:
+			wsMetrics.Add("frames_dropped", 1)
+		default:
+		}
+	}
+}
+
+// writePump is the only goroutine writing to the connection. It also pings
+// the client so that dead peers are noticed by the read deadline.
+func (c *WSClient) writePump() {
+	ping := time.NewTicker(c.cfg.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				wsMetrics.Add("write_errors", 1)
+				c.Close()
+				return
+			}
+		case frame := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+				wsMetrics.Add("write_errors", 1)
+				c.Close()
+				return
+			}
+			wsMetrics.Add("frames_sent", 1)
+		}
+	}
+}
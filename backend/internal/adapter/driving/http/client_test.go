@@ -0,0 +1,192 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/gorilla/websocket"
+)
+
+// wsPair returns both ends of a WebSocket connection.
+func wsPair(t *testing.T) (server, client *websocket.Conn) {
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-conns
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return server, client
+}
+
+// stalledClient is a WSClient whose write pump has not started, so frames
+// pile up in its queue.
+func stalledClient(t *testing.T, cfg WSConfig) (*WSClient, *websocket.Conn) {
+	server, peer := wsPair(t)
+	c := &WSClient{
+		id:   domain.NewUserID(),
+		conn: server,
+		cfg:  cfg,
+		send: make(chan []byte, cfg.QueueSize),
+		done: make(chan struct{}),
+		held: make(map[domain.RoomID][]heldEvent),
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, peer
+}
+
+// readFrames reads n frames from peer, describing each as its type followed
+// by the content of the messages it carries.
+func readFrames(t *testing.T, peer *websocket.Conn, n int) []string {
+	t.Helper()
+	peer.SetReadDeadline(time.Now().Add(frameTimeout))
+	var got []string
+	for range n {
+		var f frame
+		if err := peer.ReadJSON(&f); err != nil {
+			t.Fatalf("after %q: %v", got, err)
+		}
+		desc := f.Type
+		switch f.Type {
+		case typeMessage, typeMessageUpdate:
+			var msg messageDTO
+			f.decode(t, &msg)
+			desc += " " + msg.Content
+		case typeHistory:
+			var page historyDTO
+			f.decode(t, &page)
+			for _, msg := range page.Messages {
+				desc += " " + msg.Content
+			}
+		default:
+			desc += " " + string(f.Payload)
+		}
+		got = append(got, desc)
+	}
+	return got
+}
+
+func TestHoldRelease(t *testing.T) {
+	server, peer := wsPair(t)
+	c := newWSClient(domain.NewUserID(), server, DefaultWSConfig())
+	t.Cleanup(func() { c.Close() })
+
+	roomID, otherRoom := domain.NewRoomID(), domain.NewRoomID()
+	message := func(roomID domain.RoomID, seq int64, content string) domain.Message {
+		msg, err := domain.NewMessage(domain.NewUserID(), roomID, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Seq = seq
+		return *msg
+	}
+
+	// Messages two and four arrive live while the backlog after one is
+	// replayed, the replay catching up to three
+	c.hold(roomID)
+	if err := c.SendText(message(roomID, 2, "two")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendText(message(otherRoom, 7, "elsewhere")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendText(message(roomID, 4, "four")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendUpdate(message(roomID, 2, "two edited")); err != nil {
+		t.Fatal(err)
+	}
+	replay := []domain.Message{message(roomID, 2, "two"), message(roomID, 3, "three")}
+	if err := c.push(typeHistory, historyDTO{RoomID: roomID.String(), Messages: newMessageDTOs(replay)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.release(roomID, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendText(message(roomID, 5, "five")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"message elsewhere",
+		"history two three",
+		"message four",
+		"message_update two edited",
+		"message five",
+	}
+	if got := readFrames(t, peer, len(want)); !slices.Equal(got, want) {
+		t.Fatalf("frames = %q, want %q", got, want)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	cfg := DefaultWSConfig()
+	cfg.QueueSize = 2
+
+	t.Run("drop oldest", func(t *testing.T) {
+		cfg.Overflow = OverflowDropOldest
+		c, peer := stalledClient(t, cfg)
+		before := wsMetric("frames_dropped")
+		for _, n := range []string{"1", "2", "3", "4"} {
+			if err := c.push(typeSignal, json.RawMessage(n)); err != nil {
+				t.Fatalf("push %s: %v", n, err)
+			}
+		}
+		if got := wsMetric("frames_dropped") - before; got != 2 {
+			t.Fatalf("frames_dropped grew by %d, want 2", got)
+		}
+
+		go c.writePump()
+		if got, want := readFrames(t, peer, 2), []string{"signal 3", "signal 4"}; !slices.Equal(got, want) {
+			t.Fatalf("frames = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		cfg.Overflow = OverflowDisconnect
+		c, peer := stalledClient(t, cfg)
+		before := wsMetric("slow_consumers_disconnected")
+		for _, n := range []string{"1", "2"} {
+			if err := c.push(typeSignal, json.RawMessage(n)); err != nil {
+				t.Fatalf("push %s: %v", n, err)
+			}
+		}
+		if err := c.push(typeSignal, json.RawMessage("3")); !errors.Is(err, errSlowConsumer) {
+			t.Fatalf("push into a full queue: %v, want errSlowConsumer", err)
+		}
+		if got := wsMetric("slow_consumers_disconnected") - before; got != 1 {
+			t.Fatalf("slow_consumers_disconnected grew by %d, want 1", got)
+		}
+		if err := c.push(typeSignal, json.RawMessage("4")); !errors.Is(err, websocket.ErrCloseSent) {
+			t.Fatalf("push after disconnecting: %v, want ErrCloseSent", err)
+		}
+
+		peer.SetReadDeadline(time.Now().Add(frameTimeout))
+		_, _, err := peer.ReadMessage()
+		var netErr net.Error
+		if err == nil || errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatalf("read from a disconnected client: %v, want the connection closed", err)
+		}
+	})
+}
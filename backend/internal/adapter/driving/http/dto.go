@@ -0,0 +1,381 @@
+package http
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+type senderDTO struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarRef   string `json:"avatar_ref,omitempty"`
+}
+
+type messageDTO struct {
+	ID        string     `json:"id"`
+	RoomID    string     `json:"room_id"`
+	SenderID  string     `json:"sender_id"`
+	Sender    *senderDTO `json:"sender,omitempty"`
+	Content   string     `json:"content"`
+	Seq       int64      `json:"seq"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+	// ParentID is set on replies, ReplyCount on thread roots
+	ParentID    string               `json:"parent_id,omitempty"`
+	ReplyCount  int                  `json:"reply_count,omitempty"`
+	Reactions   []reactionSummaryDTO `json:"reactions,omitempty"`
+	Attachments []attachmentDTO      `json:"attachments,omitempty"`
+}
+
+func newMessageDTO(msg domain.Message) messageDTO {
+	dto := messageDTO{
+		ID:         msg.ID.String(),
+		RoomID:     msg.RoomID.String(),
+		SenderID:   msg.SenderID.String(),
+		Content:    msg.Content,
+		Seq:        msg.Seq,
+		CreatedAt:  msg.CreatedAt,
+		ReplyCount: msg.ReplyCount,
+	}
+	if msg.ParentID != nil {
+		dto.ParentID = msg.ParentID.String()
+	}
+	if !msg.EditedAt.IsZero() {
+		dto.EditedAt = &msg.EditedAt
+	}
+	if msg.Deleted() {
+		dto.Deleted = true
+		dto.DeletedBy = msg.DeletedBy.String()
+	}
+	for _, r := range msg.Reactions {
+		dto.Reactions = append(dto.Reactions, newReactionSummaryDTO(r))
+	}
+	for _, a := range msg.Attachments {
+		dto.Attachments = append(dto.Attachments, newAttachmentDTO(a))
+	}
+	if msg.Sender != nil {
+		dto.Sender = &senderDTO{
+			ID:          msg.Sender.ID.String(),
+			Username:    msg.Sender.Username,
+			DisplayName: msg.Sender.DisplayName,
+			AvatarRef:   msg.Sender.AvatarRef,
+		}
+	}
+	return dto
+}
+
+func newMessageDTOs(msgs []domain.Message) []messageDTO {
+	dtos := make([]messageDTO, 0, len(msgs))
+	for _, msg := range msgs {
+		dtos = append(dtos, newMessageDTO(msg))
+	}
+	return dtos
+}
+
+// attachmentDTO carries a download URL that expires, clients fetch the
+// message again for a fresh one.
+type attachmentDTO struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+	// Images the server could decode also have dimensions and a thumbnail
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+func newAttachmentDTO(a domain.Attachment) attachmentDTO {
+	return attachmentDTO{
+		ID:           a.ID.String(),
+		Name:         a.Name,
+		ContentType:  a.ContentType,
+		Size:         a.Size,
+		URL:          a.URL,
+		Width:        a.Width,
+		Height:       a.Height,
+		ThumbnailURL: a.ThumbnailURL,
+	}
+}
+
+type reactionSummaryDTO struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"user_ids"`
+}
+
+func newReactionSummaryDTO(r domain.ReactionSummary) reactionSummaryDTO {
+	ids := make([]string, 0, len(r.UserIDs))
+	for _, id := range r.UserIDs {
+		ids = append(ids, id.String())
+	}
+	return reactionSummaryDTO{Emoji: r.Emoji, Count: len(ids), UserIDs: ids}
+}
+
+// reactionDTO is a reaction added to or removed from a message.
+type reactionDTO struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+	UserID    string `json:"user_id"`
+	Emoji     string `json:"emoji"`
+	Added     bool   `json:"added"`
+}
+
+func newReactionDTO(r domain.ReactionChange) reactionDTO {
+	return reactionDTO{
+		RoomID:    r.RoomID.String(),
+		MessageID: r.MessageID.String(),
+		UserID:    r.UserID.String(),
+		Emoji:     r.Emoji,
+		Added:     r.Added,
+	}
+}
+
+type revisionDTO struct {
+	Content  string    `json:"content"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+type revisionsDTO struct {
+	MessageID string        `json:"message_id"`
+	Revisions []revisionDTO `json:"revisions"`
+}
+
+func newRevisionsDTO(messageID domain.MessageID, revs []domain.MessageRevision) revisionsDTO {
+	dtos := make([]revisionDTO, 0, len(revs))
+	for _, rev := range revs {
+		dtos = append(dtos, revisionDTO{Content: rev.Content, EditedAt: rev.EditedAt})
+	}
+	return revisionsDTO{MessageID: messageID.String(), Revisions: dtos}
+}
+
+type historyDTO struct {
+	RoomID   string       `json:"room_id"`
+	Messages []messageDTO `json:"messages"`
+}
+
+type threadDTO struct {
+	RoomID   string       `json:"room_id"`
+	Root     messageDTO   `json:"root"`
+	Messages []messageDTO `json:"messages"`
+}
+
+func newThreadDTO(root domain.Message, replies []domain.Message) threadDTO {
+	return threadDTO{
+		RoomID:   root.RoomID.String(),
+		Root:     newMessageDTO(root),
+		Messages: newMessageDTOs(replies),
+	}
+}
+
+type sessionDTO struct {
+	Token   string `json:"token"`
+	UserID  string `json:"user_id"`
+	Resumed bool   `json:"resumed"`
+}
+
+type userDTO struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarRef   string    `json:"avatar_ref"`
+	Status      string    `json:"status"`
+	StatusText  string    `json:"status_text"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newUserDTO(user domain.User) userDTO {
+	return userDTO{
+		ID:          user.ID.String(),
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarRef:   user.AvatarRef,
+		Status:      string(user.Status),
+		StatusText:  user.StatusText,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+type memberDTO struct {
+	UserID   string    `json:"user_id"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+func newMemberDTO(m domain.Member) memberDTO {
+	return memberDTO{
+		UserID:   m.UserID.String(),
+		Role:     string(m.Role),
+		JoinedAt: m.JoinedAt,
+	}
+}
+
+type roomDTO struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Topic     string      `json:"topic"`
+	Kind      string      `json:"kind"`
+	CreatedBy string      `json:"created_by"`
+	CreatedAt time.Time   `json:"created_at"`
+	Members   []memberDTO `json:"members"`
+	// Unread is only set in room listings
+	Unread *int64 `json:"unread,omitempty"`
+}
+
+func newRoomDTO(room domain.Room) roomDTO {
+	members := make([]memberDTO, 0, len(room.Members))
+	for _, m := range room.Members {
+		members = append(members, newMemberDTO(m))
+	}
+	return roomDTO{
+		ID:        room.ID.String(),
+		Name:      room.Name,
+		Topic:     room.Topic,
+		Kind:      string(room.Kind),
+		CreatedBy: room.CreatedBy.String(),
+		CreatedAt: room.CreatedAt,
+		Members:   members,
+	}
+}
+
+func newRoomDTOs(rooms []domain.Room) []roomDTO {
+	dtos := make([]roomDTO, 0, len(rooms))
+	for _, room := range rooms {
+		dtos = append(dtos, newRoomDTO(room))
+	}
+	return dtos
+}
+
+type presenceDTO struct {
+	RoomID string    `json:"room_id"`
+	UserID string    `json:"user_id"`
+	Kind   string    `json:"kind"`
+	At     time.Time `json:"at"`
+}
+
+func newPresenceDTO(p domain.Presence) presenceDTO {
+	return presenceDTO{
+		RoomID: p.RoomID.String(),
+		UserID: p.UserID.String(),
+		Kind:   string(p.Kind),
+		At:     p.At,
+	}
+}
+
+type receiptDTO struct {
+	RoomID    string    `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	MessageID string    `json:"message_id"`
+	Seq       int64     `json:"seq"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+func newReceiptDTO(m domain.ReadMarker) receiptDTO {
+	return receiptDTO{
+		RoomID:    m.RoomID.String(),
+		UserID:    m.UserID.String(),
+		MessageID: m.MessageID.String(),
+		Seq:       m.Seq,
+		ReadAt:    m.ReadAt,
+	}
+}
+
+type receiptsDTO struct {
+	RoomID   string       `json:"room_id"`
+	Receipts []receiptDTO `json:"receipts"`
+}
+
+func newReceiptsDTO(roomID domain.RoomID, markers []domain.ReadMarker) receiptsDTO {
+	receipts := make([]receiptDTO, 0, len(markers))
+	for _, m := range markers {
+		receipts = append(receipts, newReceiptDTO(m))
+	}
+	return receiptsDTO{RoomID: roomID.String(), Receipts: receipts}
+}
+
+type typingDTO struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id"`
+	Typing bool   `json:"typing"`
+}
+
+func newTypingDTO(t domain.Typing) typingDTO {
+	return typingDTO{
+		RoomID: t.RoomID.String(),
+		UserID: t.UserID.String(),
+		Typing: t.Typing,
+	}
+}
+
+type rosterEntryDTO struct {
+	memberDTO
+	Online bool `json:"online"`
+}
+
+type rosterDTO struct {
+	RoomID  string           `json:"room_id"`
+	Members []rosterEntryDTO `json:"members"`
+}
+
+func newRosterDTO(roomID domain.RoomID, roster []domain.RosterEntry) rosterDTO {
+	members := make([]rosterEntryDTO, 0, len(roster))
+	for _, e := range roster {
+		members = append(members, rosterEntryDTO{
+			memberDTO: newMemberDTO(e.Member),
+			Online:    e.Online,
+		})
+	}
+	return rosterDTO{RoomID: roomID.String(), Members: members}
+}
+
+type roomsDTO struct {
+	Rooms []roomDTO `json:"rooms"`
+}
+
+type errorDTO struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Permission string `json:"permission,omitempty"`
+}
+
+// signalDTO carries SDP as a string and ICE candidates as the JSON object
+// produced by RTCIceCandidate.toJSON().
+type signalDTO struct {
+	Type      string          `json:"type"`
+	SDP       string          `json:"sdp,omitempty"`
+	Candidate json.RawMessage `json:"candidate,omitempty"`
+}
+
+func newSignalDTO(sig domain.Signal) signalDTO {
+	dto := signalDTO{Type: string(sig.Type)}
+	if sig.Type == domain.SignalCandidate {
+		dto.Candidate = json.RawMessage(sig.Payload)
+	} else {
+		dto.SDP = sig.Payload
+	}
+	return dto
+}
+
+func (dto signalDTO) toSignal() (domain.Signal, error) {
+	switch t := domain.SignalType(dto.Type); t {
+	case domain.SignalOffer, domain.SignalAnswer:
+		return domain.NewSignal(t, dto.SDP), nil
+	case domain.SignalCandidate:
+		if !json.Valid(dto.Candidate) {
+			return domain.Signal{}, invalidRequest("invalid ice candidate")
+		}
+		return domain.NewSignal(t, string(dto.Candidate)), nil
+	}
+	return domain.Signal{}, invalidRequest("invalid signal type")
+}
+
+// callEndedDTO tells a client it was removed from the call of a room.
+type callEndedDTO struct {
+	RoomID string `json:"room_id"`
+}
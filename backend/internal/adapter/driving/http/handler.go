@@ -1,37 +1,247 @@
 package http
 
 import (
+	"encoding/json"
+	"errors"
+	stdlog "log"
 	"net/http"
+	"os"
 
 	"github.com/Wyydra/ya/backend/internal/adapter/driven/gateway/ws"
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
 	"github.com/Wyydra/ya/backend/internal/core/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
 )
 
 type Handler struct {
 	ChatService *service.ChatService
 	CallService *service.CallService
+	UserService *service.UserService
+	RoomService *service.RoomService
 	Hub         *ws.Hub
+	// Blobs serves the blob store's signed URLs, nil when the store serves
+	// them itself
+	Blobs http.Handler
+
+	auth     AuthConfig
+	ws       WSConfig
+	sessions *sessionStore
 }
 
-func NewHandler(chatService *service.ChatService, callService *service.CallService, hub *ws.Hub) *Handler {
+func NewHandler(chatService *service.ChatService, callService *service.CallService, userService *service.UserService, roomService *service.RoomService, hub *ws.Hub, blobs http.Handler, auth AuthConfig, wsConfig WSConfig) *Handler {
 	return &Handler{
 		ChatService: chatService,
 		CallService: callService,
+		UserService: userService,
+		RoomService: roomService,
 		Hub:         hub,
+		Blobs:       blobs,
+		auth:        auth,
+		ws:          wsConfig,
+		sessions:    newSessionStore(),
 	}
 }
 
+// NewAdminRouter serves operator endpoints. It carries no authentication and
+// is meant for a listener that is not exposed publicly.
+func NewAdminRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Get("/metrics", Metrics)
+	return r
+}
+
 func (h *Handler) NewRouter() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(middleware.RequestLogger(redactingLogFormatter{
+		&middleware.DefaultLogFormatter{Logger: stdlog.New(os.Stdout, "", stdlog.LstdFlags)},
+	}))
 	r.Use(middleware.Recoverer)
 
 	fs := http.FileServer(http.Dir("./static"))
 	r.Handle("/*", fs)
 
-	r.Get("/ws", h.ServeWS)
+	r.Post("/auth/login", h.Login)
+	r.Post("/users", h.Register)
+	// Signed URLs are their own credentials
+	if h.Blobs != nil {
+		r.Handle("/blobs/*", h.Blobs)
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.authenticate)
+
+		r.Get("/ws", h.ServeWS)
+		r.Get("/rooms/{roomID}/ws", h.ServeWS)
+		r.Get("/rooms/{roomID}/messages", h.GetHistory)
+		r.Post("/rooms/{roomID}/attachments", h.UploadAttachments)
+		r.Patch("/rooms/{roomID}/messages/{messageID}", h.EditMessage)
+		r.Delete("/rooms/{roomID}/messages/{messageID}", h.DeleteMessage)
+		r.Get("/rooms/{roomID}/messages/{messageID}/revisions", h.GetRevisions)
+		r.Get("/rooms/{roomID}/messages/{messageID}/thread", h.GetThread)
+		r.Put("/rooms/{roomID}/messages/{messageID}/reactions/{emoji}", h.React)
+		r.Delete("/rooms/{roomID}/messages/{messageID}/reactions/{emoji}", h.Unreact)
+		r.Post("/rooms/{roomID}/read", h.MarkRead)
+		r.Get("/rooms/{roomID}/receipts", h.GetReceipts)
+		r.Get("/search", h.Search)
+
+		r.Post("/rooms", h.CreateRoom)
+		r.Post("/direct/{userID}", h.OpenDirect)
+		r.Get("/rooms", h.ListRooms)
+		r.Get("/rooms/{roomID}", h.GetRoom)
+		r.Get("/rooms/{roomID}/presence", h.GetPresence)
+		r.Post("/rooms/{roomID}/join", h.JoinRoom)
+		r.Post("/rooms/{roomID}/leave", h.LeaveRoom)
+		r.Post("/rooms/{roomID}/invite", h.InviteToRoom)
+		r.Patch("/rooms/{roomID}", h.UpdateRoom)
+		r.Post("/rooms/{roomID}/kick", h.KickFromRoom)
+		r.Post("/rooms/{roomID}/bans", h.BanFromRoom)
+		r.Delete("/rooms/{roomID}/bans/{userID}", h.UnbanFromRoom)
+		r.Put("/rooms/{roomID}/members/{userID}/role", h.SetMemberRole)
+		r.Post("/rooms/{roomID}/call/mute", h.MuteInCall)
+
+		r.Get("/users/me", h.GetMe)
+		r.Patch("/users/me", h.UpdateMe)
+		r.Get("/users/{userID}", h.GetUser)
+	})
 
 	return r
 }
+
+// credentialParams are query parameters carrying credentials, masked in the
+// request log.
+var credentialParams = []string{"access_token", "session", "signature"}
+
+// redactingLogFormatter keeps credentials passed in the query string out of
+// the request log.
+type redactingLogFormatter struct {
+	middleware.LogFormatter
+}
+
+func (f redactingLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	query := r.URL.Query()
+	redacted := false
+	for _, name := range credentialParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if redacted {
+		// The formatter logs RequestURI, handlers keep reading r.URL
+		u := *r.URL
+		u.RawQuery = query.Encode()
+		r = r.WithContext(r.Context())
+		r.RequestURI = u.RequestURI()
+	}
+	return f.LogFormatter.NewLogEntry(r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// requestError is a malformed request detected by the adapter itself.
+type requestError struct{ msg string }
+
+func (e *requestError) Error() string { return e.msg }
+
+func invalidRequest(msg string) error {
+	return &requestError{msg: msg}
+}
+
+// writeServiceError writes the response for an error returned by the core
+// services.
+func writeServiceError(w http.ResponseWriter, err error) {
+	status := serviceErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Error().Err(err).Msg("Request failed")
+		writeError(w, status, "internal error")
+		return
+	}
+	writeError(w, status, err.Error())
+}
+
+// serviceErrorStatus maps errors returned by the core services to a status.
+func serviceErrorStatus(err error) int {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrMessageNotFound),
+		errors.Is(err, domain.ErrUserNotFound),
+		errors.Is(err, domain.ErrRoomNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrUsernameTaken),
+		errors.Is(err, domain.ErrAlreadyMember),
+		errors.Is(err, domain.ErrNotInCall),
+		errors.Is(err, domain.ErrMessageDeleted),
+		errors.Is(err, domain.ErrCallRoom):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrInvalidRoomName),
+		errors.Is(err, domain.ErrInvalidTopic),
+		errors.Is(err, domain.ErrInvalidRoomKind),
+		errors.Is(err, domain.ErrInvalidPeer),
+		errors.Is(err, domain.ErrInvalidRole),
+		errors.Is(err, domain.ErrEmptyContent),
+		errors.Is(err, domain.ErrInvalidEmoji),
+		errors.Is(err, domain.ErrEmptySearch),
+		errors.Is(err, domain.ErrInvalidAttachment),
+		errors.Is(err, domain.ErrTooManyAttachments),
+		errors.Is(err, domain.ErrInvalidUsername),
+		errors.Is(err, domain.ErrInvalidDisplayName),
+		errors.Is(err, domain.ErrInvalidStatus),
+		errors.Is(err, domain.ErrInvalidAvatarRef),
+		errors.Is(err, domain.ErrInvalidStatusText),
+		errors.Is(err, domain.ErrWeakPassword),
+		errors.Is(err, domain.ErrPasswordTooLong):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrAttachmentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, domain.ErrAttachmentType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, domain.ErrUnauthenticated),
+		errors.Is(err, domain.ErrInvalidCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrRegistrationDisabled),
+		errors.Is(err, domain.ErrForbidden),
+		errors.Is(err, domain.ErrBanned),
+		errors.Is(err, domain.ErrNotMember),
+		errors.Is(err, domain.ErrRoomClosed),
+		errors.Is(err, domain.ErrDirectRoom):
+		return http.StatusForbidden
+	case errors.Is(err, port.ErrGatewayUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorCode is the machine readable code sent with WebSocket errors.
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request"
+	case http.StatusUnauthorized:
+		return "unauthenticated"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	default:
+		return "internal"
+	}
+}
@@ -0,0 +1,70 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/Wyydra/ya/backend/internal/core/service"
+)
+
+func TestServiceErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{invalidRequest("room_id is required"), http.StatusBadRequest, "invalid_request"},
+		{domain.ErrEmptyContent, http.StatusBadRequest, "invalid_request"},
+		{fmt.Errorf("saving: %w", domain.ErrInvalidEmoji), http.StatusBadRequest, "invalid_request"},
+		{domain.ErrUnauthenticated, http.StatusUnauthorized, "unauthenticated"},
+		{domain.ErrNotMember, http.StatusForbidden, "forbidden"},
+		{service.ErrRegistrationDisabled, http.StatusForbidden, "forbidden"},
+		{&domain.PermissionError{Permission: domain.PermBan, Role: domain.RoleMember}, http.StatusForbidden, "forbidden"},
+		{domain.ErrRoomNotFound, http.StatusNotFound, "not_found"},
+		{domain.ErrMessageDeleted, http.StatusConflict, "conflict"},
+		{domain.ErrCallRoom, http.StatusConflict, "conflict"},
+		{domain.ErrAttachmentTooLarge, http.StatusRequestEntityTooLarge, "internal"},
+		{port.ErrGatewayUnavailable, http.StatusServiceUnavailable, "unavailable"},
+		{errors.New("disk on fire"), http.StatusInternalServerError, "internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			status := serviceErrorStatus(tt.err)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d", status, tt.status)
+			}
+			if code := errorCode(status); code != tt.code {
+				t.Fatalf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestNewErrorDTO(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorDTO
+	}{
+		{"unknown type", errUnknownType, errorDTO{Code: "unknown_type", Message: errUnknownType.Error()}},
+		{"unsupported version", errUnsupportedVersion, errorDTO{Code: "unsupported_version", Message: errUnsupportedVersion.Error()}},
+		{"service error", domain.ErrRoomNotFound, errorDTO{Code: "not_found", Message: domain.ErrRoomNotFound.Error()}},
+		{
+			"permission",
+			fmt.Errorf("kick: %w", &domain.PermissionError{Permission: domain.PermKick, Role: domain.RoleAdmin, Over: domain.RoleOwner}),
+			errorDTO{Code: "forbidden", Message: "kick: role admin cannot kick a member with role owner", Permission: "kick"},
+		},
+		{"internal detail hidden", errors.New("password=hunter2"), errorDTO{Code: "internal", Message: "internal error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newErrorDTO(tt.err); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
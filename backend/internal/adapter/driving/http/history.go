@@ -0,0 +1,123 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// historyParams are the raw parameters shared by the REST endpoint and the
+// WebSocket "history" request. Times are RFC 3339.
+type historyParams struct {
+	Before   string `json:"before"`
+	After    string `json:"after"`
+	AfterSeq *int64 `json:"after_seq"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Limit    int    `json:"limit"`
+}
+
+func parseHistoryQuery(p historyParams) (service.HistoryQuery, error) {
+	q := service.HistoryQuery{Limit: p.Limit, AfterSeq: p.AfterSeq}
+
+	if p.Before != "" {
+		id, err := domain.NewMessageIDFromString(p.Before)
+		if err != nil {
+			return q, errors.New("invalid before message id")
+		}
+		q.Before = &id
+	}
+	if p.After != "" {
+		id, err := domain.NewMessageIDFromString(p.After)
+		if err != nil {
+			return q, errors.New("invalid after message id")
+		}
+		q.After = &id
+	}
+	if q.AfterSeq != nil && *q.AfterSeq < 0 {
+		return q, errors.New("invalid after_seq")
+	}
+	if p.From != "" {
+		t, err := time.Parse(time.RFC3339, p.From)
+		if err != nil {
+			return q, errors.New("invalid from time")
+		}
+		q.From = t
+	}
+	if p.To != "" {
+		t, err := time.Parse(time.RFC3339, p.To)
+		if err != nil {
+			return q, errors.New("invalid to time")
+		}
+		q.To = t
+	}
+
+	// from and to together are a single range selector
+	cursors := 0
+	for _, set := range []bool{q.Before != nil, q.After != nil, q.AfterSeq != nil, !q.From.IsZero() || !q.To.IsZero()} {
+		if set {
+			cursors++
+		}
+	}
+	if cursors > 1 {
+		return q, errors.New("before, after, after_seq and from/to are mutually exclusive")
+	}
+	return q, nil
+}
+
+// GET /rooms/{roomID}/messages?before=&after=&after_seq=&from=&to=&limit=
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	roomID, err := domain.NewRoomIDFromString(chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+
+	query := r.URL.Query()
+	params := historyParams{
+		Before: query.Get("before"),
+		After:  query.Get("after"),
+		From:   query.Get("from"),
+		To:     query.Get("to"),
+	}
+	if raw := query.Get("limit"); raw != "" {
+		if params.Limit, err = strconv.Atoi(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+	if raw := query.Get("after_seq"); raw != "" {
+		seq, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid after_seq")
+			return
+		}
+		params.AfterSeq = &seq
+	}
+
+	q, err := parseHistoryQuery(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	msgs, err := h.ChatService.History(r.Context(), userID, roomID, q)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, historyDTO{
+		RoomID:   roomID.String(),
+		Messages: newMessageDTOs(msgs),
+	})
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+func TestParseHistoryQuery(t *testing.T) {
+	messageID := domain.NewMessageID().String()
+	seq := func(n int64) *int64 { return &n }
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		p    historyParams
+		// err is a substring of the expected error, if any
+		err string
+	}{
+		{name: "latest", p: historyParams{Limit: 20}},
+		{name: "before", p: historyParams{Before: messageID}},
+		{name: "after", p: historyParams{After: messageID}},
+		{name: "after_seq", p: historyParams{AfterSeq: seq(0)}},
+		{name: "time range", p: historyParams{From: from.Format(time.RFC3339), To: from.Add(time.Hour).Format(time.RFC3339)}},
+		{name: "open range", p: historyParams{From: from.Format(time.RFC3339)}},
+		{name: "invalid before", p: historyParams{Before: "nope"}, err: "invalid before"},
+		{name: "invalid after", p: historyParams{After: "nope"}, err: "invalid after"},
+		{name: "negative after_seq", p: historyParams{AfterSeq: seq(-1)}, err: "invalid after_seq"},
+		{name: "invalid from", p: historyParams{From: "yesterday"}, err: "invalid from"},
+		{name: "invalid to", p: historyParams{To: "2026-01-01"}, err: "invalid to"},
+		{name: "before and after", p: historyParams{Before: messageID, After: messageID}, err: "mutually exclusive"},
+		{name: "before and after_seq", p: historyParams{Before: messageID, AfterSeq: seq(3)}, err: "mutually exclusive"},
+		{name: "after_seq and range", p: historyParams{AfterSeq: seq(3), To: from.Format(time.RFC3339)}, err: "mutually exclusive"},
+		{name: "after and range", p: historyParams{After: messageID, From: from.Format(time.RFC3339)}, err: "mutually exclusive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseHistoryQuery(tt.p)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Limit != tt.p.Limit ||
+				(q.Before != nil) != (tt.p.Before != "") ||
+				(q.After != nil) != (tt.p.After != "") ||
+				q.AfterSeq != tt.p.AfterSeq ||
+				q.From.IsZero() != (tt.p.From == "") ||
+				q.To.IsZero() != (tt.p.To == "") {
+				t.Fatalf("parsed %+v from %+v", q, tt.p)
+			}
+		})
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	ts := newTestServer(t, DefaultWSConfig())
+	alice := ts.user("alice")
+	roomID := ts.room(alice)
+	for _, content := range []string{"one", "two", "three"} {
+		ts.send(alice, roomID, content)
+	}
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		status int
+		want   []string
+	}{
+		{"latest", nil, http.StatusOK, []string{"one", "two", "three"}},
+		{"after_seq", url.Values{"after_seq": {"1"}}, http.StatusOK, []string{"two", "three"}},
+		{"invalid limit", url.Values{"limit": {"many"}}, http.StatusBadRequest, nil},
+		{"combined cursors", url.Values{"after_seq": {"1"}, "from": {"2026-01-01T00:00:00Z"}}, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.srv.URL+"/rooms/"+roomID.String()+"/messages?"+tt.query.Encode(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header = ts.authorization(alice)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var page historyDTO
+			if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, msg := range page.Messages {
+				got = append(got, msg.Content)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("messages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// PATCH /rooms/{roomID}/messages/{messageID} {"content": "..."}
+func (h *Handler) EditMessage(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, messageID, ok := messageRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	msg, err := h.ChatService.EditMessage(r.Context(), userID, roomID, messageID, req.Content)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newMessageDTO(msg))
+}
+
+// DELETE /rooms/{roomID}/messages/{messageID}
+func (h *Handler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, messageID, ok := messageRequest(w, r)
+	if !ok {
+		return
+	}
+	msg, err := h.ChatService.DeleteMessage(r.Context(), userID, roomID, messageID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newMessageDTO(msg))
+}
+
+// GET /rooms/{roomID}/messages/{messageID}/revisions
+func (h *Handler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, messageID, ok := messageRequest(w, r)
+	if !ok {
+		return
+	}
+	revs, err := h.ChatService.Revisions(r.Context(), userID, roomID, messageID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRevisionsDTO(messageID, revs))
+}
+
+// GET /rooms/{roomID}/messages/{messageID}/thread?after_seq=&limit=
+func (h *Handler) GetThread(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, messageID, ok := messageRequest(w, r)
+	if !ok {
+		return
+	}
+	var (
+		q     service.ThreadQuery
+		err   error
+		query = r.URL.Query()
+	)
+	if raw := query.Get("after_seq"); raw != "" {
+		if q.AfterSeq, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid after_seq")
+			return
+		}
+	}
+	if raw := query.Get("limit"); raw != "" {
+		if q.Limit, err = strconv.Atoi(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+	root, replies, err := h.ChatService.Thread(r.Context(), userID, roomID, messageID, q)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newThreadDTO(root, replies))
+}
+
+// PUT /rooms/{roomID}/messages/{messageID}/reactions/{emoji}
+func (h *Handler) React(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, messageID, emoji, ok := reactionRequest(w, r)
+	if !ok {
+		return
+	}
+	msg, err := h.ChatService.React(r.Context(), userID, roomID, messageID, emoji)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newMessageDTO(msg))
+}
+
+// DELETE /rooms/{roomID}/messages/{messageID}/reactions/{emoji}
+func (h *Handler) Unreact(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, messageID, emoji, ok := reactionRequest(w, r)
+	if !ok {
+		return
+	}
+	msg, err := h.ChatService.Unreact(r.Context(), userID, roomID, messageID, emoji)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newMessageDTO(msg))
+}
+
+// reactionRequest is messageRequest for routes that also carry a
+// percent-encoded {emoji}.
+func reactionRequest(w http.ResponseWriter, r *http.Request) (domain.UserID, domain.RoomID, domain.MessageID, string, bool) {
+	userID, roomID, messageID, ok := messageRequest(w, r)
+	if !ok {
+		return userID, roomID, messageID, "", false
+	}
+	emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid emoji")
+		return userID, roomID, messageID, "", false
+	}
+	return userID, roomID, messageID, emoji, true
+}
+
+// messageRequest is roomRequest for routes that also carry {messageID}.
+func messageRequest(w http.ResponseWriter, r *http.Request) (domain.UserID, domain.RoomID, domain.MessageID, bool) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return userID, roomID, domain.MessageID{}, false
+	}
+	messageID, err := domain.NewMessageIDFromString(chi.URLParam(r, "messageID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid message id")
+		return userID, roomID, messageID, false
+	}
+	return userID, roomID, messageID, true
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+)
+
+// GET /metrics serves the expvar counters published by the server. Unlike
+// expvar.Handler it leaves out memstats and the command line, which may
+// carry secrets.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, "{")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "memstats" || kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			fmt.Fprint(w, ",")
+		}
+		first = false
+		fmt.Fprintf(w, "\n%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprint(w, "\n}\n")
+}
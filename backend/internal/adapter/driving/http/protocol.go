@@ -0,0 +1,152 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/gorilla/websocket"
+)
+
+// Version 1 of the WebSocket protocol, see PROTOCOL.md. Clients negotiate it
+// through Sec-WebSocket-Protocol; clients offering no subprotocol get the
+// latest version.
+const (
+	protocolV1      = "ya.v1"
+	protocolVersion = 1
+)
+
+var supportedProtocols = []string{protocolV1}
+
+// Credentials a browser cannot send as headers ride along the offered
+// subprotocols instead of the URL, which ends up in access logs. They are
+// never selected, clients offer a version next to them.
+const (
+	bearerProtocolPrefix  = "ya.bearer."
+	sessionProtocolPrefix = "ya.session."
+)
+
+// protocolCredential returns the value of the first offered subprotocol
+// starting with prefix.
+func protocolCredential(r *http.Request, prefix string) string {
+	for _, p := range websocket.Subprotocols(r) {
+		if value, ok := strings.CutPrefix(p, prefix); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// inboundEnvelope is every frame a client sends.
+type inboundEnvelope struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// outboundEnvelope is every frame the server sends. ID echoes the request a
+// reply answers and is empty on pushed events.
+type outboundEnvelope struct {
+	V       int    `json:"v"`
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Payload any    `json:"payload,omitempty"`
+}
+
+// Server to client frame types
+const (
+	typeAck       = "ack"
+	typeError     = "error"
+	typeSession   = "session"
+	typeMessage   = "message"
+	typeHistory   = "history"
+	typeRoom      = "room"
+	typeSignal    = "signal"
+	typePresence  = "presence"
+	typeTyping    = "typing"
+	typeReceipt   = "receipt"
+	typeReaction  = "reaction"
+	typeCallEnded = "call_ended"
+
+	typeMessageUpdate = "message_update"
+)
+
+var (
+	errUnknownType        = errors.New("unknown message type")
+	errUnsupportedVersion = errors.New("unsupported protocol version")
+)
+
+// wsHandler serves one request type. The returned value becomes the payload
+// of the ack, nil acks without payload.
+type wsHandler func(c *wsConn, payload json.RawMessage) (any, error)
+
+var wsHandlers = map[string]wsHandler{
+	"resume":            (*wsConn).handleResume,
+	"create_room":       (*wsConn).handleCreateRoom,
+	"open_direct":       (*wsConn).handleOpenDirect,
+	"list_rooms":        (*wsConn).handleListRooms,
+	"presence":          (*wsConn).handlePresence,
+	"join":              (*wsConn).handleJoin,
+	"leave":             (*wsConn).handleLeave,
+	"set_topic":         (*wsConn).handleSetTopic,
+	"invite":            (*wsConn).handleInvite,
+	"kick":              (*wsConn).handleKick,
+	"ban":               (*wsConn).handleBan,
+	"unban":             (*wsConn).handleUnban,
+	"set_role":          (*wsConn).handleSetRole,
+	"send_message":      (*wsConn).handleSendMessage,
+	"edit_message":      (*wsConn).handleEditMessage,
+	"delete_message":    (*wsConn).handleDeleteMessage,
+	"message_revisions": (*wsConn).handleRevisions,
+	"react":             (*wsConn).handleReact,
+	"unreact":           (*wsConn).handleUnreact,
+	"typing":            (*wsConn).handleTyping,
+	"mark_read":         (*wsConn).handleMarkRead,
+	"receipts":          (*wsConn).handleReceipts,
+	"history":           (*wsConn).handleHistory,
+	"thread":            (*wsConn).handleThread,
+	"search":            (*wsConn).handleSearch,
+	"follow_thread":     (*wsConn).handleFollowThread,
+	"unfollow_thread":   (*wsConn).handleUnfollowThread,
+	"join_call":         (*wsConn).handleJoinCall,
+	"leave_call":        (*wsConn).handleLeaveCall,
+	"signal":            (*wsConn).handleSignal,
+	"mute":              (*wsConn).handleMute,
+}
+
+// decodePayload unmarshals a request payload, a missing payload leaves v
+// untouched.
+func decodePayload(raw json.RawMessage, v any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return invalidRequest("invalid payload")
+	}
+	return nil
+}
+
+// newErrorDTO turns an error into the payload of an error frame. Unexpected
+// errors are reported without detail.
+func newErrorDTO(err error) errorDTO {
+	switch {
+	case errors.Is(err, errUnknownType):
+		return errorDTO{Code: "unknown_type", Message: err.Error()}
+	case errors.Is(err, errUnsupportedVersion):
+		return errorDTO{Code: "unsupported_version", Message: err.Error()}
+	}
+
+	status := serviceErrorStatus(err)
+	dto := errorDTO{Code: errorCode(status), Message: err.Error()}
+	var perr *domain.PermissionError
+	if errors.As(err, &perr) {
+		dto.Permission = string(perr.Permission)
+	}
+	if status == http.StatusInternalServerError {
+		dto.Message = "internal error"
+	}
+	return dto
+}
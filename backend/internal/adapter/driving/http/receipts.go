@@ -0,0 +1,47 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+// POST /rooms/{roomID}/read {"message_id": "..."}
+func (h *Handler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	messageID, err := domain.NewMessageIDFromString(req.MessageID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid message id")
+		return
+	}
+	if err := h.ChatService.MarkRead(r.Context(), userID, roomID, messageID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /rooms/{roomID}/receipts
+func (h *Handler) GetReceipts(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	markers, err := h.ChatService.Receipts(r.Context(), userID, roomID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newReceiptsDTO(roomID, markers))
+}
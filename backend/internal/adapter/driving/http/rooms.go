@@ -0,0 +1,329 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/go-chi/chi/v5"
+)
+
+// POST /rooms {"name": "...", "topic": "...", "kind": "group|direct|call"}
+func (h *Handler) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name  string `json:"name"`
+		Topic string `json:"topic"`
+		Kind  string `json:"kind"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = string(domain.RoomGroup)
+	}
+
+	room, err := h.RoomService.Create(r.Context(), userID, req.Name, req.Topic, domain.RoomKind(req.Kind))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newRoomDTO(room))
+}
+
+// POST /direct/{userID} opens the direct conversation with userID
+func (h *Handler) OpenDirect(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	peer, err := domain.NewUserIDFromString(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	room, err := h.RoomService.OpenDirect(r.Context(), userID, peer)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoomDTO(room))
+}
+
+// GET /rooms
+func (h *Handler) ListRooms(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	rooms, err := h.listRooms(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rooms)
+}
+
+// listRooms returns userID's rooms with their unread counts.
+func (h *Handler) listRooms(ctx context.Context, userID domain.UserID) ([]roomDTO, error) {
+	rooms, err := h.RoomService.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]domain.RoomID, 0, len(rooms))
+	for _, room := range rooms {
+		ids = append(ids, room.ID)
+	}
+	unread, err := h.ChatService.UnreadCounts(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	dtos := newRoomDTOs(rooms)
+	for i := range dtos {
+		n := unread[rooms[i].ID]
+		dtos[i].Unread = &n
+	}
+	return dtos, nil
+}
+
+// GET /rooms/{roomID}
+func (h *Handler) GetRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	room, err := h.RoomService.Get(r.Context(), userID, roomID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoomDTO(room))
+}
+
+// GET /rooms/{roomID}/presence
+func (h *Handler) GetPresence(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	roster, err := h.RoomService.Roster(r.Context(), userID, roomID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRosterDTO(roomID, roster))
+}
+
+// POST /rooms/{roomID}/join
+func (h *Handler) JoinRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	room, err := h.RoomService.Join(r.Context(), userID, roomID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoomDTO(room))
+}
+
+// POST /rooms/{roomID}/leave
+func (h *Handler) LeaveRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.RoomService.Leave(r.Context(), userID, roomID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /rooms/{roomID}/invite {"user_id": "..."}
+func (h *Handler) InviteToRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	invitee, ok := decodeTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := h.RoomService.Invite(r.Context(), userID, roomID, invitee); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PATCH /rooms/{roomID} {"topic": "..."}
+func (h *Handler) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Topic *string `json:"topic"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Topic == nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	room, err := h.RoomService.SetTopic(r.Context(), userID, roomID, *req.Topic)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoomDTO(room))
+}
+
+// POST /rooms/{roomID}/kick {"user_id": "..."}
+func (h *Handler) KickFromRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	target, ok := decodeTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := h.RoomService.Kick(r.Context(), userID, roomID, target); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /rooms/{roomID}/bans {"user_id": "..."}
+func (h *Handler) BanFromRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	target, ok := decodeTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := h.RoomService.Ban(r.Context(), userID, roomID, target); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /rooms/{roomID}/bans/{userID}
+func (h *Handler) UnbanFromRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	target, err := domain.NewUserIDFromString(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if err := h.RoomService.Unban(r.Context(), userID, roomID, target); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /rooms/{roomID}/members/{userID}/role {"role": "admin|member|guest"}
+func (h *Handler) SetMemberRole(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+	target, err := domain.NewUserIDFromString(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.RoomService.SetRole(r.Context(), userID, roomID, target, domain.Role(req.Role)); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /rooms/{roomID}/call/mute {"user_id": "...", "muted": true}
+func (h *Handler) MuteInCall(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := roomRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+		Muted  *bool  `json:"muted"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	target, err := domain.NewUserIDFromString(req.UserID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	muted := req.Muted == nil || *req.Muted
+
+	if err := h.CallService.Mute(r.Context(), userID, roomID, target, muted); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeTarget reads a {"user_id": "..."} body, writing the error response
+// if it is malformed.
+func decodeTarget(w http.ResponseWriter, r *http.Request) (domain.UserID, bool) {
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return domain.UserID{}, false
+	}
+	target, err := domain.NewUserIDFromString(req.UserID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return target, false
+	}
+	return target, true
+}
+
+// roomRequest extracts the caller and the {roomID} path parameter, writing
+// the error response if either is missing.
+func roomRequest(w http.ResponseWriter, r *http.Request) (domain.UserID, domain.RoomID, bool) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return userID, domain.RoomID{}, false
+	}
+	roomID, err := domain.NewRoomIDFromString(chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid room id")
+		return userID, roomID, false
+	}
+	return userID, roomID, true
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/service"
+)
+
+// searchParams are the raw parameters shared by the REST endpoint and the
+// WebSocket "search" request. Times are RFC 3339.
+type searchParams struct {
+	Text     string `json:"text"`
+	RoomID   string `json:"room_id"`
+	SenderID string `json:"sender_id"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Limit    int    `json:"limit"`
+}
+
+func parseSearchQuery(p searchParams) (service.SearchQuery, error) {
+	q := service.SearchQuery{Text: p.Text, Limit: p.Limit}
+
+	if p.RoomID != "" {
+		id, err := domain.NewRoomIDFromString(p.RoomID)
+		if err != nil {
+			return q, errors.New("invalid room id")
+		}
+		q.RoomID = &id
+	}
+	if p.SenderID != "" {
+		id, err := domain.NewUserIDFromString(p.SenderID)
+		if err != nil {
+			return q, errors.New("invalid sender id")
+		}
+		q.SenderID = &id
+	}
+	if p.From != "" {
+		t, err := time.Parse(time.RFC3339, p.From)
+		if err != nil {
+			return q, errors.New("invalid from time")
+		}
+		q.From = t
+	}
+	if p.To != "" {
+		t, err := time.Parse(time.RFC3339, p.To)
+		if err != nil {
+			return q, errors.New("invalid to time")
+		}
+		q.To = t
+	}
+	return q, nil
+}
+
+// searchDTO lists matching messages of any room, newest first.
+type searchDTO struct {
+	Messages []messageDTO `json:"messages"`
+}
+
+// GET /search?text=&room_id=&sender_id=&from=&to=&limit=
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	params := searchParams{
+		Text:     query.Get("text"),
+		RoomID:   query.Get("room_id"),
+		SenderID: query.Get("sender_id"),
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+	}
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		if params.Limit, err = strconv.Atoi(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	q, err := parseSearchQuery(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	msgs, err := h.ChatService.Search(r.Context(), userID, q)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, searchDTO{Messages: newMessageDTOs(msgs)})
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+// sessionTTL is how long a session survives without any connection attached,
+// i.e. the window a client has to reconnect and resume.
+const sessionTTL = 5 * time.Minute
+
+// wsSession is the server side of a resumable WebSocket session: the identity
+// and the followed threads of a client, kept across reconnects. Rooms come
+// from the user's memberships instead, so joins made elsewhere count too.
+type wsSession struct {
+	token  string
+	userID domain.UserID
+
+	mu       sync.Mutex
+	threads  map[domain.MessageID]domain.RoomID // followed root -> its room
+	attached int
+	detached time.Time
+}
+
+// removeRoom forgets the threads followed in a room the user left.
+func (s *wsSession) removeRoom(roomID domain.RoomID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for rootID, threadRoom := range s.threads {
+		if threadRoom == roomID {
+			delete(s.threads, rootID)
+		}
+	}
+}
+
+func (s *wsSession) addThread(roomID domain.RoomID, rootID domain.MessageID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.threads[rootID] = roomID
+}
+
+func (s *wsSession) removeThread(rootID domain.MessageID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.threads, rootID)
+}
+
+// threadIDs returns the followed thread roots and their rooms.
+func (s *wsSession) threadIDs() map[domain.MessageID]domain.RoomID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.threads)
+}
+
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*wsSession
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{
+		sessions: make(map[string]*wsSession),
+	}
+}
+
+// attach returns the live session for token, or a fresh one for userID if the
+// token is unknown, expired or belongs to someone else. With adopt set the
+// caller has no identity of its own and takes over the session's user. The
+// session stays alive until every attached connection has called detach and
+// sessionTTL has elapsed.
+func (st *sessionStore) attach(token string, userID domain.UserID, adopt bool) (sess *wsSession, resumed bool, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	st.prune(now)
+
+	if sess, ok := st.sessions[token]; ok && token != "" && (adopt || sess.userID == userID) {
+		sess.mu.Lock()
+		sess.attached++
+		sess.mu.Unlock()
+		return sess, true, nil
+	}
+
+	token, err = newSessionToken()
+	if err != nil {
+		return nil, false, err
+	}
+	sess = &wsSession{
+		token:    token,
+		userID:   userID,
+		threads:  make(map[domain.MessageID]domain.RoomID),
+		attached: 1,
+	}
+	st.sessions[token] = sess
+	return sess, false, nil
+}
+
+func (st *sessionStore) detach(sess *wsSession) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.attached--
+	if sess.attached == 0 {
+		sess.detached = time.Now()
+	}
+}
+
+// prune drops sessions detached for longer than sessionTTL.
+// Must be called with st.mu held.
+func (st *sessionStore) prune(now time.Time) {
+	for token, sess := range st.sessions {
+		sess.mu.Lock()
+		expired := sess.attached == 0 && now.Sub(sess.detached) > sessionTTL
+		sess.mu.Unlock()
+		if expired {
+			delete(st.sessions, token)
+		}
+	}
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// POST /users {"username": "...", "password": "...", "display_name": "..."}
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.UserService.Register(r.Context(), req.Username, req.Password, req.DisplayName)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newUserDTO(*user))
+}
+
+// GET /users/me
+func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.UserService.Get(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newUserDTO(user))
+}
+
+// PATCH /users/me {"display_name": "...", "avatar_ref": "...", "status": "...", "status_text": "..."}
+func (h *Handler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DisplayName *string `json:"display_name"`
+		AvatarRef   *string `json:"avatar_ref"`
+		Status      *string `json:"status"`
+		StatusText  *string `json:"status_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	upd := service.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		AvatarRef:   req.AvatarRef,
+		StatusText:  req.StatusText,
+	}
+	if req.Status != nil {
+		status := domain.UserStatus(*req.Status)
+		upd.Status = &status
+	}
+
+	user, err := h.UserService.UpdateProfile(r.Context(), userID, upd)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newUserDTO(user))
+}
+
+// GET /users/{userID}
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := domain.NewUserIDFromString(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	user, err := h.UserService.Get(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newUserDTO(user))
+}
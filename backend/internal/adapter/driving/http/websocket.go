@@ -1,143 +1,887 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/service"
+	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-const DemoRoomID = "db31e952-84dd-40c4-9bed-b7ddd35ba5b8"
-
-var upgrader = websocket.Upgrader {
-	ReadBufferSize: 4096,
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
 	WriteBufferSize: 4096,
+	Subprotocols:    supportedProtocols,
 	// TODO: only for dev
-	CheckOrigin: func(r *http.Request) bool {return true},
-}
-
-type WSClient struct {
-	id domain.UserID
-	conn *websocket.Conn
+	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-func (c *WSClient) ID() string {
-	return c.id.String()
+// wsConn is the server side of a single connection. Only touched from the
+// ServeWS read loop. Followed threads live in the session so they survive
+// reconnects.
+type wsConn struct {
+	h       *Handler
+	ctx     context.Context
+	client  *WSClient
+	session *wsSession
+	calls   map[domain.RoomID]struct{}
+	l       zerolog.Logger
 }
 
-func (c *WSClient) SendText(msg domain.Message) error {
-	type messageDTO struct {
-		SenderID string `json:"sender_id"`
-		Content string `json:"content"`
+// HTTP handler
+func (h *Handler) ServeWS(w http.ResponseWriter, r *http.Request) {
+	// Optional initial room from /rooms/{roomID}/ws
+	var initialRoom *domain.RoomID
+	if raw := chi.URLParam(r, "roomID"); raw != "" {
+		roomID, err := domain.NewRoomIDFromString(raw)
+		if err != nil {
+			http.Error(w, "invalid room id", http.StatusBadRequest)
+			return
+		}
+		initialRoom = &roomID
 	}
 
-	dto := messageDTO {
-		SenderID: msg.SenderID.String(),
-		Content: msg.Content,
+	// Refuse clients that only speak protocol versions we do not
+	if offered := websocket.Subprotocols(r); len(offered) > 0 &&
+		!slices.ContainsFunc(offered, func(p string) bool { return slices.Contains(supportedProtocols, p) }) {
+		http.Error(w, "unsupported protocol, expected "+protocolV1, http.StatusBadRequest)
+		return
 	}
 
-	return c.conn.WriteJSON(dto)
-}
-
-func (c *WSClient) Close() error {
-	return c.conn.Close()
-}
-
-func (c* WSClient) SendSignal(signal domain.Signal) error {
-	return c.conn.WriteJSON(map[string]interface{}{
-		"type":    "signal",
-		"payload": signal,
-	})
-}
-
-// HTTP handler
-func (h *Handler) ServeWS(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Error().Err(err).Msg("Error while upgrading ws")
 		return
 	}
 
-	clientID := domain.NewUserID()
-	
-	client := &WSClient{
-		id:   clientID,
-		conn: conn,
+	// Without authentication the connection is anonymous and may adopt the
+	// identity of the session it resumes
+	userID, authenticated := userIDFromContext(r.Context())
+	if !authenticated {
+		userID = domain.NewUserID()
+	}
+
+	// Reconnecting clients present their previous session token to keep
+	// their rooms
+	token := protocolCredential(r, sessionProtocolPrefix)
+	if token == "" {
+		token = r.URL.Query().Get("session")
+	}
+	session, resumed, err := h.sessions.attach(token, userID, !authenticated)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create session")
+		conn.Close()
+		return
 	}
+	clientID := session.userID
 
-	l := log.With().Str("client_id", clientID.String()).Logger()
-	l.Info().Msg("New client connected")
+	client := newWSClient(clientID, conn, h.ws)
+
+	c := &wsConn{
+		h:       h,
+		ctx:     r.Context(),
+		client:  client,
+		session: session,
+		calls:   make(map[domain.RoomID]struct{}),
+		l:       log.With().Str("client_id", clientID.String()).Logger(),
+	}
+	c.l.Info().Bool("resumed", resumed).Msg("New client connected")
 
 	h.Hub.Register(client)
 
 	defer func() {
-		l.Info().Msg("Client disconnected")
+		c.l.Info().Msg("Client disconnected")
+		// Cleanup SFU peers for every call this connection is still in,
+		// before unregistering drops the connection from the hub
+		for roomID := range c.calls {
+			if !h.Hub.ReleaseCall(roomID, client) {
+				continue
+			}
+			if err := h.CallService.LeaveCall(r.Context(), roomID, client.id); err != nil {
+				// benign error
+			}
+		}
 		h.Hub.Unregister(client)
-		
-		// Cleanup SFU peer
-		// Using the same hardcoded RoomID as below
-		roomID, _ := domain.NewRoomIDFromString(DemoRoomID)
-		if err := h.CallService.LeaveCall(r.Context(), roomID, client.id); err != nil {
-             // benign error
-        }
-		
-		conn.Close()
+		h.sessions.detach(session)
+
+		client.Close()
 	}()
 
-	// TODO: Parse RoomID from request or context
-	// For now, use a constant RoomID so everyone joins the same room
-	roomID, _ := domain.NewRoomIDFromString(DemoRoomID) // Use a fixed UUID for testing
-	
+	if err := client.push(typeSession, sessionDTO{
+		Token:   session.token,
+		UserID:  clientID.String(),
+		Resumed: resumed,
+	}); err != nil {
+		c.l.Error().Err(err).Msg("Failed to send session")
+		return
+	}
+
+	// A resumed session subscribes with its resume request, which says what
+	// to replay first
+	if !resumed {
+		h.subscribe(c.ctx, client, session, nil)
+	}
+
+	if initialRoom != nil && !resumed {
+		room, err := c.join(*initialRoom)
+		if err != nil {
+			client.push(typeError, newErrorDTO(err))
+		} else if err := client.push(typeRoom, room); err != nil {
+			c.l.Error().Err(err).Msg("Failed to send room")
+		}
+	}
+
+	// Any frame, pongs included, proves the client is alive
+	alive := func() { conn.SetReadDeadline(time.Now().Add(h.ws.PongTimeout)) }
+	alive()
+	conn.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+
 	// listening for browser
 	for {
-		type incomingDTO struct {
-			Type    string `json:"type"`
-			Content string `json:"content"`
-			Intent  string `json:"intent"`
-			Payload string `json:"payload"`
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				wsMetrics.Add("heartbeat_timeouts", 1)
+				c.l.Info().Msg("Client stopped answering pings")
+			case websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure):
+				c.l.Error().Err(err).Msg("Unexpected close error")
+			}
+			break
 		}
+		alive()
+		c.dispatch(data)
+	}
+}
 
-		var req incomingDTO
-		err := conn.ReadJSON(&req)
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
-				l.Error().Err(err).Msg("Unexpected close error")
+// dispatch decodes one frame, runs its handler and acks or rejects it.
+func (c *wsConn) dispatch(data []byte) {
+	var env inboundEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		c.reject("", "", invalidRequest("malformed frame"))
+		return
+	}
+	if env.V != 0 && env.V != protocolVersion {
+		c.reject(env.ID, env.Type, errUnsupportedVersion)
+		return
+	}
+	handle, ok := wsHandlers[env.Type]
+	if !ok {
+		c.reject(env.ID, env.Type, errUnknownType)
+		return
+	}
+
+	result, err := handle(c, env.Payload)
+	if err != nil {
+		c.reject(env.ID, env.Type, err)
+		return
+	}
+	if err := c.client.reply(env.ID, typeAck, result); err != nil {
+		c.l.Error().Err(err).Str("request", env.Type).Msg("Failed to send ack")
+	}
+}
+
+// reject tells the client why a request failed.
+func (c *wsConn) reject(id, request string, err error) {
+	dto := newErrorDTO(err)
+	if dto.Code == "internal" {
+		c.l.Error().Err(err).Str("request", request).Msg("Request failed")
+	} else {
+		c.l.Debug().Err(err).Str("request", request).Msg("Request refused")
+	}
+	if err := c.client.reply(id, typeError, dto); err != nil {
+		c.l.Error().Err(err).Msg("Failed to send error")
+	}
+}
+
+// roomPayload is the payload of every request addressing a single room.
+type roomPayload struct {
+	RoomID string `json:"room_id"`
+}
+
+func (p roomPayload) roomID() (domain.RoomID, error) {
+	if p.RoomID == "" {
+		return domain.RoomID{}, invalidRequest("room_id is required")
+	}
+	id, err := domain.NewRoomIDFromString(p.RoomID)
+	if err != nil {
+		return id, invalidRequest("invalid room id")
+	}
+	return id, nil
+}
+
+func parseUserID(raw string) (domain.UserID, error) {
+	id, err := domain.NewUserIDFromString(raw)
+	if err != nil {
+		return id, invalidRequest("invalid user id")
+	}
+	return id, nil
+}
+
+type messagePayload struct {
+	roomPayload
+	MessageID string `json:"message_id"`
+}
+
+func (p messagePayload) ids() (domain.RoomID, domain.MessageID, error) {
+	roomID, err := p.roomID()
+	if err != nil {
+		return roomID, domain.MessageID{}, err
+	}
+	messageID, err := domain.NewMessageIDFromString(p.MessageID)
+	if err != nil {
+		return roomID, messageID, invalidRequest("invalid message id")
+	}
+	return roomID, messageID, nil
+}
+
+func (c *wsConn) join(roomID domain.RoomID) (roomDTO, error) {
+	room, err := c.h.RoomService.Join(c.ctx, c.client.id, roomID)
+	if err != nil {
+		return roomDTO{}, err
+	}
+	c.l.Info().Str("room_id", roomID.String()).Msg("Joined room")
+	return newRoomDTO(room), nil
+}
+
+func (c *wsConn) handleResume(payload json.RawMessage) (any, error) {
+	var p struct {
+		// RoomID -> last sequence number the client has seen
+		LastSeq map[string]int64 `json:"last_seq"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	c.h.subscribe(c.ctx, c.client, c.session, p.LastSeq)
+	return nil, nil
+}
+
+func (c *wsConn) handleCreateRoom(payload json.RawMessage) (any, error) {
+	var p struct {
+		Name  string `json:"name"`
+		Topic string `json:"topic"`
+		Kind  string `json:"kind"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	kind := domain.RoomKind(p.Kind)
+	if kind == "" {
+		kind = domain.RoomGroup
+	}
+	room, err := c.h.RoomService.Create(c.ctx, c.client.id, p.Name, p.Topic, kind)
+	if err != nil {
+		return nil, err
+	}
+	c.l.Info().Str("room_id", room.ID.String()).Msg("Created room")
+	return newRoomDTO(room), nil
+}
+
+func (c *wsConn) handleOpenDirect(payload json.RawMessage) (any, error) {
+	var p struct {
+		UserID string `json:"user_id"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	peer, err := parseUserID(p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	room, err := c.h.RoomService.OpenDirect(c.ctx, c.client.id, peer)
+	if err != nil {
+		return nil, err
+	}
+	return newRoomDTO(room), nil
+}
+
+func (c *wsConn) handleListRooms(payload json.RawMessage) (any, error) {
+	rooms, err := c.h.listRooms(c.ctx, c.client.id)
+	if err != nil {
+		return nil, err
+	}
+	return roomsDTO{Rooms: rooms}, nil
+}
+
+func (c *wsConn) handleJoin(payload json.RawMessage) (any, error) {
+	var p roomPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	return c.join(roomID)
+}
+
+func (c *wsConn) handlePresence(payload json.RawMessage) (any, error) {
+	var p roomPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	roster, err := c.h.RoomService.Roster(c.ctx, c.client.id, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return newRosterDTO(roomID, roster), nil
+}
+
+func (c *wsConn) handleLeave(payload json.RawMessage) (any, error) {
+	var p roomPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.h.RoomService.Leave(c.ctx, c.client.id, roomID); err != nil {
+		return nil, err
+	}
+	c.session.removeRoom(roomID)
+	if _, ok := c.calls[roomID]; ok {
+		delete(c.calls, roomID)
+		if c.h.Hub.ReleaseCall(roomID, c.client) {
+			if err := c.h.CallService.LeaveCall(c.ctx, roomID, c.client.id); err != nil {
+				c.l.Error().Err(err).Msg("Failed to leave call")
 			}
-			break 
 		}
+	}
+	c.l.Info().Str("room_id", roomID.String()).Msg("Left room")
+	return nil, nil
+}
+
+func (c *wsConn) handleSetTopic(payload json.RawMessage) (any, error) {
+	var p struct {
+		roomPayload
+		Topic string `json:"topic"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	room, err := c.h.RoomService.SetTopic(c.ctx, c.client.id, roomID, p.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return newRoomDTO(room), nil
+}
 
-		type incomingSignalDTO struct {
-			Type    string `json:"type"`    // "offer", "answer", "candidate"
-			Payload string `json:"payload"` // The opaque SDP/ICE string
+// targetPayload is the payload of requests acting on another user of a room.
+type targetPayload struct {
+	roomPayload
+	UserID string `json:"user_id"`
+}
+
+func (p targetPayload) ids() (domain.RoomID, domain.UserID, error) {
+	roomID, err := p.roomID()
+	if err != nil {
+		return roomID, domain.UserID{}, err
+	}
+	target, err := parseUserID(p.UserID)
+	return roomID, target, err
+}
+
+func (c *wsConn) handleInvite(payload json.RawMessage) (any, error) {
+	var p targetPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, target, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.h.RoomService.Invite(c.ctx, c.client.id, roomID, target)
+}
+
+func (c *wsConn) handleKick(payload json.RawMessage) (any, error) {
+	var p targetPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, target, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.h.RoomService.Kick(c.ctx, c.client.id, roomID, target)
+}
+
+func (c *wsConn) handleBan(payload json.RawMessage) (any, error) {
+	var p targetPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, target, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.h.RoomService.Ban(c.ctx, c.client.id, roomID, target)
+}
+
+func (c *wsConn) handleUnban(payload json.RawMessage) (any, error) {
+	var p targetPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, target, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.h.RoomService.Unban(c.ctx, c.client.id, roomID, target)
+}
+
+func (c *wsConn) handleSetRole(payload json.RawMessage) (any, error) {
+	var p struct {
+		targetPayload
+		Role string `json:"role"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, target, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.h.RoomService.SetRole(c.ctx, c.client.id, roomID, target, domain.Role(p.Role))
+}
+
+func (c *wsConn) handleMute(payload json.RawMessage) (any, error) {
+	var p struct {
+		targetPayload
+		Muted *bool `json:"muted"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, target, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	muted := p.Muted == nil || *p.Muted
+	return nil, c.h.CallService.Mute(c.ctx, c.client.id, roomID, target, muted)
+}
+
+func (c *wsConn) handleTyping(payload json.RawMessage) (any, error) {
+	var p struct {
+		roomPayload
+		Typing *bool `json:"typing"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	typing := p.Typing == nil || *p.Typing
+	return nil, c.h.ChatService.SetTyping(c.ctx, c.client.id, roomID, typing)
+}
+
+func (c *wsConn) handleEditMessage(payload json.RawMessage) (any, error) {
+	var p struct {
+		messagePayload
+		Content string `json:"content"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.h.ChatService.EditMessage(c.ctx, c.client.id, roomID, messageID, p.Content)
+	if err != nil {
+		return nil, err
+	}
+	return newMessageDTO(msg), nil
+}
+
+func (c *wsConn) handleDeleteMessage(payload json.RawMessage) (any, error) {
+	var p messagePayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.h.ChatService.DeleteMessage(c.ctx, c.client.id, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return newMessageDTO(msg), nil
+}
+
+func (c *wsConn) handleRevisions(payload json.RawMessage) (any, error) {
+	var p messagePayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	revs, err := c.h.ChatService.Revisions(c.ctx, c.client.id, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return newRevisionsDTO(messageID, revs), nil
+}
+
+// reactionPayload names a reaction of the caller to a message.
+type reactionPayload struct {
+	messagePayload
+	Emoji string `json:"emoji"`
+}
+
+func (c *wsConn) handleReact(payload json.RawMessage) (any, error) {
+	var p reactionPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.h.ChatService.React(c.ctx, c.client.id, roomID, messageID, p.Emoji)
+	if err != nil {
+		return nil, err
+	}
+	return newMessageDTO(msg), nil
+}
+
+func (c *wsConn) handleUnreact(payload json.RawMessage) (any, error) {
+	var p reactionPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.h.ChatService.Unreact(c.ctx, c.client.id, roomID, messageID, p.Emoji)
+	if err != nil {
+		return nil, err
+	}
+	return newMessageDTO(msg), nil
+}
+
+func (c *wsConn) handleMarkRead(payload json.RawMessage) (any, error) {
+	var p messagePayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.h.ChatService.MarkRead(c.ctx, c.client.id, roomID, messageID)
+}
+
+func (c *wsConn) handleReceipts(payload json.RawMessage) (any, error) {
+	var p roomPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	markers, err := c.h.ChatService.Receipts(c.ctx, c.client.id, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return newReceiptsDTO(roomID, markers), nil
+}
+
+func (c *wsConn) handleSendMessage(payload json.RawMessage) (any, error) {
+	var p struct {
+		roomPayload
+		Content  string `json:"content"`
+		ParentID string `json:"parent_id"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	if p.ParentID == "" {
+		msg, err := c.h.ChatService.SendMessage(c.ctx, c.client.id, roomID, p.Content)
+		if err != nil {
+			return nil, err
 		}
+		return newMessageDTO(msg), nil
+	}
+	parentID, err := domain.NewMessageIDFromString(p.ParentID)
+	if err != nil {
+		return nil, invalidRequest("invalid parent message id")
+	}
+	msg, err := c.h.ChatService.Reply(c.ctx, c.client.id, roomID, parentID, p.Content)
+	if err != nil {
+		return nil, err
+	}
+	return newMessageDTO(msg), nil
+}
 
-		if req.Type == "signal" {
-			var sigDTO incomingSignalDTO
-			if err := json.Unmarshal([]byte(req.Payload), &sigDTO); err != nil {
-				l.Error().Err(err).Msg("Invalid signal payload")
-				continue
-			}
+func (c *wsConn) handleThread(payload json.RawMessage) (any, error) {
+	var p struct {
+		messagePayload
+		AfterSeq int64 `json:"after_seq"`
+		Limit    int   `json:"limit"`
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	root, replies, err := c.h.ChatService.Thread(c.ctx, c.client.id, roomID, messageID, service.ThreadQuery{AfterSeq: p.AfterSeq, Limit: p.Limit})
+	if err != nil {
+		return nil, err
+	}
+	return newThreadDTO(root, replies), nil
+}
 
-			sig := domain.NewSignal(domain.SignalType(sigDTO.Type), sigDTO.Payload)
+func (c *wsConn) handleFollowThread(payload json.RawMessage) (any, error) {
+	var p messagePayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.h.ChatService.FollowThread(c.ctx, c.client.id, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	c.session.addThread(roomID, root.ID)
+	return newMessageDTO(root), nil
+}
 
-			if err := h.CallService.HandleSignal(r.Context(), client.id, roomID, sig); err != nil {
-				l.Error().Err(err).Msg("Failed to handle signal")
-			}
+func (c *wsConn) handleUnfollowThread(payload json.RawMessage) (any, error) {
+	var p messagePayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, messageID, err := p.ids()
+	if err != nil {
+		return nil, err
+	}
+	rootID, err := c.h.ChatService.UnfollowThread(c.ctx, c.client.id, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	c.session.removeThread(rootID)
+	return nil, nil
+}
 
-		} else if req.Type == "join_call" {
-			// Trigger the JoinCall flow (Server will create Offer)
-			if err := h.CallService.JoinCall(r.Context(), roomID, client.id); err != nil {
-				l.Error().Err(err).Msg("Failed to join call")
-			}
-		} else {
-			// Default to chat
-			err = h.ChatService.SendMessage(r.Context(), client.id, roomID, req.Content)
-			if err != nil {
-				l.Error().Err(err).Msg("Failed to process message")
-				continue
-			}
+func (c *wsConn) handleHistory(payload json.RawMessage) (any, error) {
+	var p struct {
+		roomPayload
+		historyParams
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	q, err := parseHistoryQuery(p.historyParams)
+	if err != nil {
+		return nil, invalidRequest(err.Error())
+	}
+	msgs, err := c.h.ChatService.History(c.ctx, c.client.id, roomID, q)
+	if err != nil {
+		return nil, err
+	}
+	return historyDTO{
+		RoomID:   roomID.String(),
+		Messages: newMessageDTOs(msgs),
+	}, nil
+}
+
+func (c *wsConn) handleSearch(payload json.RawMessage) (any, error) {
+	var p searchParams
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	q, err := parseSearchQuery(p)
+	if err != nil {
+		return nil, invalidRequest(err.Error())
+	}
+	msgs, err := c.h.ChatService.Search(c.ctx, c.client.id, q)
+	if err != nil {
+		return nil, err
+	}
+	return searchDTO{Messages: newMessageDTOs(msgs)}, nil
+}
+
+// handleJoinCall adds the client to the room's call, the server then sends
+// its offer as a signal event.
+func (c *wsConn) handleJoinCall(payload json.RawMessage) (any, error) {
+	var p roomPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	// Claimed first so the offer is signalled to this connection
+	c.h.Hub.ClaimCall(roomID, c.client)
+	if err := c.h.CallService.JoinCall(c.ctx, roomID, c.client.id); err != nil {
+		c.h.Hub.ReleaseCall(roomID, c.client)
+		return nil, err
+	}
+	c.calls[roomID] = struct{}{}
+	return nil, nil
+}
+
+func (c *wsConn) handleLeaveCall(payload json.RawMessage) (any, error) {
+	var p roomPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	delete(c.calls, roomID)
+	if !c.h.Hub.ReleaseCall(roomID, c.client) {
+		return nil, nil
+	}
+	return nil, c.h.CallService.LeaveCall(c.ctx, roomID, c.client.id)
+}
+
+func (c *wsConn) handleSignal(payload json.RawMessage) (any, error) {
+	var p struct {
+		roomPayload
+		signalDTO
+	}
+	if err := decodePayload(payload, &p); err != nil {
+		return nil, err
+	}
+	roomID, err := p.roomID()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := p.toSignal()
+	if err != nil {
+		return nil, err
+	}
+	if !c.h.Hub.InCall(roomID, c.client) {
+		return nil, domain.ErrNotInCall
+	}
+	return nil, c.h.CallService.HandleSignal(c.ctx, c.client.id, roomID, sig)
+}
+
+// subscribe subscribes client to every room its user is a member of, however
+// they joined, and refollows the threads of its session. Rooms listed in
+// lastSeq get the messages the client missed replayed before live delivery
+// continues; live messages arriving meanwhile are held back and deduplicated
+// by seq.
+func (h *Handler) subscribe(ctx context.Context, client *WSClient, session *wsSession, lastSeq map[string]int64) {
+	l := log.With().Str("client_id", client.ID()).Logger()
+
+	rooms, err := h.RoomService.List(ctx, client.id)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to list rooms to subscribe")
+		return
+	}
+
+	seqs := make(map[domain.RoomID]int64, len(lastSeq))
+	for raw, seq := range lastSeq {
+		roomID, err := domain.NewRoomIDFromString(raw)
+		if err != nil {
+			l.Error().Err(err).Msg("Invalid room in resume request")
+			continue
+		}
+		seqs[roomID] = seq
+	}
+
+	for _, room := range rooms {
+		roomID := room.ID
+		seq, replay := seqs[roomID]
+		if replay {
+			client.hold(roomID)
+		}
+		if err := h.RoomService.Subscribe(ctx, client.id, roomID); err != nil {
+			l.Error().Err(err).Str("room_id", roomID.String()).Msg("Failed to rejoin room")
+			client.release(roomID, seq)
+			session.removeRoom(roomID)
+			continue
+		}
+		if !replay {
+			continue
+		}
+
+		replayed, err := h.replay(ctx, client, roomID, seq)
+		if err != nil {
+			l.Error().Err(err).Str("room_id", roomID.String()).Msg("Failed to replay missed messages")
+		}
+		if err := client.release(roomID, replayed); err != nil {
+			l.Error().Err(err).Str("room_id", roomID.String()).Msg("Failed to flush held messages")
+		}
+		l.Info().Str("room_id", roomID.String()).Int64("from_seq", seq).Int64("to_seq", replayed).Msg("Resumed room")
+	}
+
+	// Missed replies were replayed with their room, or are fetched with a
+	// "thread" request by clients that only follow the thread
+	for rootID, roomID := range session.threadIDs() {
+		if _, err := h.ChatService.FollowThread(ctx, client.id, roomID, rootID); err != nil {
+			l.Error().Err(err).Str("message_id", rootID.String()).Msg("Failed to refollow thread")
+			session.removeThread(rootID)
+		}
+	}
+}
+
+// replay pushes every message of roomID after seq as history pages and
+// returns the sequence number of the last message sent.
+func (h *Handler) replay(ctx context.Context, client *WSClient, roomID domain.RoomID, seq int64) (int64, error) {
+	for {
+		after := seq
+		msgs, err := h.ChatService.History(ctx, client.id, roomID, service.HistoryQuery{AfterSeq: &after, Limit: service.MaxHistoryLimit})
+		if err != nil {
+			return seq, err
+		}
+		if len(msgs) == 0 {
+			return seq, nil
+		}
+		if err := client.push(typeHistory, historyDTO{
+			RoomID:   roomID.String(),
+			Messages: newMessageDTOs(msgs),
+		}); err != nil {
+			return seq, err
+		}
+		seq = msgs[len(msgs)-1].Seq
+		if len(msgs) < service.MaxHistoryLimit {
+			return seq, nil
 		}
 	}
 }
@@ -0,0 +1,559 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/auth/jwt"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/gateway/ws"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/media/pion"
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/memory"
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/service"
+	"github.com/gorilla/websocket"
+)
+
+// frameTimeout bounds every wait for a frame the server should send.
+const frameTimeout = 2 * time.Second
+
+// testServer serves the router over the memory adapters, authenticating
+// tokens of a local issuer.
+type testServer struct {
+	t      *testing.T
+	ctx    context.Context
+	srv    *httptest.Server
+	h      *Handler
+	issuer *jwt.Issuer
+}
+
+func newTestServer(t *testing.T, cfg WSConfig) *testServer {
+	keys := jwt.NewKeySet()
+	keys.AddSecret("test", []byte("test-secret"))
+
+	users, rooms := memory.NewUserRepository(), memory.NewRoomRepository()
+	hub := ws.NewHub(ws.DefaultHubConfig(), nil)
+	go hub.Run()
+
+	callService := service.NewCallService(pion.NewPionAdapter(), rooms, hub)
+	chatService := service.NewChatService(memory.NewMessageRepository(), users, rooms, memory.NewReadMarkerRepository(), memory.NewReactionRepository(), nil, nil, hub, service.DefaultAttachmentConfig())
+	userService := service.NewUserService(users, nil)
+	roomService := service.NewRoomService(rooms, users, hub, callService)
+	auth := AuthConfig{Verifier: jwt.NewVerifier(keys, jwt.Config{})}
+	h := NewHandler(chatService, callService, userService, roomService, hub, nil, auth, cfg)
+
+	ts := &testServer{
+		t:      t,
+		ctx:    context.Background(),
+		srv:    httptest.NewServer(h.NewRouter()),
+		h:      h,
+		issuer: jwt.NewIssuer("test", []byte("test-secret"), "", time.Hour),
+	}
+	t.Cleanup(func() {
+		ts.srv.Close()
+		hub.Stop()
+	})
+	return ts
+}
+
+// user provisions a user called name.
+func (ts *testServer) user(name string) domain.UserID {
+	ts.t.Helper()
+	id := domain.NewUserID()
+	if err := ts.h.UserService.Provision(ts.ctx, domain.Identity{UserID: id, Username: name, DisplayName: name}); err != nil {
+		ts.t.Fatal(err)
+	}
+	return id
+}
+
+func (ts *testServer) token(userID domain.UserID) string {
+	ts.t.Helper()
+	token, _, err := ts.issuer.IssueToken(ts.ctx, userID)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return token
+}
+
+// room creates a group room owned by owner, which the others join.
+func (ts *testServer) room(owner domain.UserID, others ...domain.UserID) domain.RoomID {
+	ts.t.Helper()
+	room, err := ts.h.RoomService.Create(ts.ctx, owner, "room", "", domain.RoomGroup)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	for _, userID := range others {
+		if _, err := ts.h.RoomService.Join(ts.ctx, userID, room.ID); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	return room.ID
+}
+
+func (ts *testServer) send(sender domain.UserID, roomID domain.RoomID, content string) domain.Message {
+	ts.t.Helper()
+	msg, err := ts.h.ChatService.SendMessage(ts.ctx, sender, roomID, content)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return msg
+}
+
+// waitOffline waits until the hub has dropped every connection of userID
+// from roomID.
+func (ts *testServer) waitOffline(roomID domain.RoomID, userID domain.UserID) {
+	ts.t.Helper()
+	deadline := time.Now().Add(frameTimeout)
+	for {
+		online, err := ts.h.Hub.OnlineUsers(ts.ctx, roomID)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		if !slices.Contains(online, userID) {
+			return
+		}
+		if time.Now().After(deadline) {
+			ts.t.Fatal("user still online")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// dial opens a WebSocket on path, returning the handshake response when it
+// is refused. setup runs before the connection starts reading.
+func (ts *testServer) dial(path string, header http.Header, setup func(*websocket.Conn), protocols ...string) (*testConn, *http.Response, error) {
+	dialer := websocket.Dialer{Subprotocols: protocols, HandshakeTimeout: frameTimeout}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(ts.srv.URL, "http")+path, header)
+	if err != nil {
+		return nil, resp, err
+	}
+	if setup != nil {
+		setup(conn)
+	}
+	c := newTestConn(ts.t, conn)
+	c.expect(typeSession).decode(ts.t, &c.session)
+	return c, resp, nil
+}
+
+func (ts *testServer) authorization(userID domain.UserID) http.Header {
+	return http.Header{"Authorization": {"Bearer " + ts.token(userID)}}
+}
+
+// connect opens a WebSocket authenticated as userID.
+func (ts *testServer) connect(userID domain.UserID, protocols ...string) *testConn {
+	ts.t.Helper()
+	c, _, err := ts.dial("/ws", ts.authorization(userID), nil, protocols...)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return c
+}
+
+type frame struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (f frame) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(f.Payload, v); err != nil {
+		t.Fatalf("decode %s payload %s: %v", f.Type, f.Payload, err)
+	}
+}
+
+// testConn is the client side of a connection. A reader goroutine keeps
+// answering pings while the test waits for frames.
+type testConn struct {
+	t       *testing.T
+	conn    *websocket.Conn
+	session sessionDTO
+
+	frames  chan frame
+	err     error // why frames was closed
+	pending []frame
+	nextID  int
+}
+
+func newTestConn(t *testing.T, conn *websocket.Conn) *testConn {
+	c := &testConn{t: t, conn: conn, frames: make(chan frame, 256)}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		defer close(c.frames)
+		for {
+			var f frame
+			if c.err = conn.ReadJSON(&f); c.err != nil {
+				return
+			}
+			c.frames <- f
+		}
+	}()
+	return c
+}
+
+// read returns the next frame. Presence frames depend on who else is
+// connected and are skipped.
+func (c *testConn) read() frame {
+	c.t.Helper()
+	if len(c.pending) > 0 {
+		f := c.pending[0]
+		c.pending = c.pending[1:]
+		return f
+	}
+	timeout := time.After(frameTimeout)
+	for {
+		select {
+		case f, ok := <-c.frames:
+			if !ok {
+				c.t.Fatalf("connection closed: %v", c.err)
+			}
+			if f.Type != typePresence {
+				return f
+			}
+		case <-timeout:
+			c.t.Fatal("no frame received")
+		}
+	}
+}
+
+func (c *testConn) expect(typ string) frame {
+	c.t.Helper()
+	f := c.read()
+	if f.Type != typ {
+		c.t.Fatalf("got %s frame %s, want %s", f.Type, f.Payload, typ)
+	}
+	return f
+}
+
+// expectClosed waits for the server to close the connection.
+func (c *testConn) expectClosed() {
+	c.t.Helper()
+	timeout := time.After(frameTimeout)
+	for {
+		select {
+		case _, ok := <-c.frames:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			c.t.Fatal("connection still open")
+		}
+	}
+}
+
+func (c *testConn) write(raw string) {
+	c.t.Helper()
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(raw)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// request sends a request and returns the frame answering it. Events
+// pushed meanwhile are kept for read.
+func (c *testConn) request(typ string, payload any) frame {
+	c.t.Helper()
+	c.nextID++
+	id := fmt.Sprint(c.nextID)
+	if err := c.conn.WriteJSON(inboundEnvelope{V: protocolVersion, Type: typ, ID: id, Payload: mustJSON(payload)}); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var events []frame
+	defer func() { c.pending = append(c.pending, events...) }()
+	for {
+		f := c.read()
+		if f.ID == id {
+			return f
+		}
+		events = append(events, f)
+	}
+}
+
+// ack sends a request that must succeed and decodes the payload of its ack
+// into v, if not nil.
+func (c *testConn) ack(typ string, payload, v any) {
+	c.t.Helper()
+	f := c.request(typ, payload)
+	if f.Type != typeAck {
+		c.t.Fatalf("%s: got %s frame %s, want an ack", typ, f.Type, f.Payload)
+	}
+	if v != nil {
+		f.decode(c.t, v)
+	}
+}
+
+// refused sends a request that must fail and returns the error.
+func (c *testConn) refused(typ string, payload any) errorDTO {
+	c.t.Helper()
+	f := c.request(typ, payload)
+	if f.Type != typeError {
+		c.t.Fatalf("%s: got %s frame %s, want an error", typ, f.Type, f.Payload)
+	}
+	var dto errorDTO
+	f.decode(c.t, &dto)
+	return dto
+}
+
+func mustJSON(v any) json.RawMessage {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+func TestDispatch(t *testing.T) {
+	ts := newTestServer(t, DefaultWSConfig())
+	alice := ts.user("alice")
+	roomID := ts.room(alice)
+	c := ts.connect(alice)
+
+	tests := []struct {
+		name  string
+		frame string
+		// typ and code of the answer, whose ID must echo the request's
+		typ, code, id string
+	}{
+		{"malformed frame", `{"type":`, typeError, "invalid_request", ""},
+		{"unsupported version", `{"v":2,"type":"list_rooms","id":"a"}`, typeError, "unsupported_version", "a"},
+		{"unknown type", `{"v":1,"type":"fly","id":"b"}`, typeError, "unknown_type", "b"},
+		{"malformed payload", `{"v":1,"type":"join","id":"c","payload":[]}`, typeError, "invalid_request", "c"},
+		{"missing room", `{"v":1,"type":"join","id":"d"}`, typeError, "invalid_request", "d"},
+		{"acked", `{"v":1,"type":"list_rooms","id":"e"}`, typeAck, "", "e"},
+		{"version defaults to the latest", `{"type":"list_rooms","id":"f"}`, typeAck, "", "f"},
+		{"without id", `{"v":1,"type":"list_rooms"}`, typeAck, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.t = t
+			c.write(tt.frame)
+			f := c.read()
+			if f.Type != tt.typ || f.ID != tt.id || f.V != protocolVersion {
+				t.Fatalf("got v%d %s frame %q %s, want %s %q", f.V, f.Type, f.ID, f.Payload, tt.typ, tt.id)
+			}
+			if tt.typ == typeError {
+				var dto errorDTO
+				f.decode(t, &dto)
+				if dto.Code != tt.code {
+					t.Fatalf("code = %q (%s), want %q", dto.Code, dto.Message, tt.code)
+				}
+			}
+		})
+	}
+
+	t.Run("ack payload", func(t *testing.T) {
+		c.t = t
+		var rooms roomsDTO
+		c.ack("list_rooms", nil, &rooms)
+		if len(rooms.Rooms) != 1 || rooms.Rooms[0].ID != roomID.String() {
+			t.Fatalf("rooms = %+v, want %v", rooms.Rooms, roomID)
+		}
+
+		var msg messageDTO
+		c.ack("send_message", map[string]string{"room_id": roomID.String(), "content": "hello"}, &msg)
+		if msg.Content != "hello" || msg.Seq != 1 {
+			t.Fatalf("sent %+v", msg)
+		}
+		// The sender receives its own message as an event too
+		var event messageDTO
+		c.expect(typeMessage).decode(t, &event)
+		if event.ID != msg.ID {
+			t.Fatalf("event %+v, want message %s", event, msg.ID)
+		}
+	})
+}
+
+func TestErrorCodes(t *testing.T) {
+	ts := newTestServer(t, DefaultWSConfig())
+	owner, member, outsider := ts.user("owner"), ts.user("member"), ts.user("outsider")
+	roomID := ts.room(owner, member)
+	msg := ts.send(member, roomID, "oops")
+	if _, err := ts.h.ChatService.DeleteMessage(ts.ctx, member, roomID, msg.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	c := ts.connect(member)
+	room := map[string]string{"room_id": roomID.String()}
+	tests := []struct {
+		name       string
+		typ        string
+		payload    any
+		code       string
+		permission string
+	}{
+		{"bad room id", "join", map[string]string{"room_id": "nope"}, "invalid_request", ""},
+		{"empty content", "send_message", map[string]string{"room_id": roomID.String(), "content": ""}, "invalid_request", ""},
+		{"combined cursors", "history", map[string]any{"room_id": roomID.String(), "before": msg.ID.String(), "after_seq": 0}, "invalid_request", ""},
+		{"unknown room", "join", map[string]string{"room_id": domain.NewRoomID().String()}, "not_found", ""},
+		{"tombstoned message", "edit_message", map[string]string{"room_id": roomID.String(), "message_id": msg.ID.String(), "content": "fixed"}, "conflict", ""},
+		{"missing permission", "kick", map[string]string{"room_id": roomID.String(), "user_id": owner.String()}, "forbidden", string(domain.PermKick)},
+		{"not in call", "mute", map[string]any{"room_id": roomID.String(), "user_id": member.String(), "muted": true}, "conflict", ""},
+		{"acked", "history", room, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.t = t
+			if tt.code == "" {
+				c.ack(tt.typ, tt.payload, nil)
+				return
+			}
+			dto := c.refused(tt.typ, tt.payload)
+			if dto.Code != tt.code || dto.Permission != tt.permission {
+				t.Fatalf("error %+v, want code %q permission %q", dto, tt.code, tt.permission)
+			}
+		})
+	}
+
+	t.Run("not a member", func(t *testing.T) {
+		c := ts.connect(outsider)
+		if dto := c.refused("send_message", map[string]string{"room_id": roomID.String(), "content": "hi"}); dto.Code != "forbidden" {
+			t.Fatalf("error %+v, want forbidden", dto)
+		}
+	})
+}
+
+func TestProtocolCredentials(t *testing.T) {
+	ts := newTestServer(t, DefaultWSConfig())
+	alice, bob := ts.user("alice"), ts.user("bob")
+	aliceToken := ts.token(alice)
+
+	first, resp, err := ts.dial("/ws", nil, nil, protocolV1, bearerProtocolPrefix+aliceToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != protocolV1 {
+		t.Fatalf("selected subprotocol %q, want %q", got, protocolV1)
+	}
+	if first.session.UserID != alice.String() || first.session.Resumed {
+		t.Fatalf("session %+v, want a new session of %v", first.session, alice)
+	}
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		protocols []string
+		// status of a refused handshake
+		status  int
+		user    domain.UserID
+		resumed bool
+	}{
+		{"no credential", nil, []string{protocolV1}, http.StatusUnauthorized, domain.UserID{}, false},
+		{"invalid bearer", nil, []string{protocolV1, bearerProtocolPrefix + "garbage"}, http.StatusUnauthorized, domain.UserID{}, false},
+		{"header wins", http.Header{"Authorization": {"Basic xyz"}}, []string{protocolV1, bearerProtocolPrefix + aliceToken}, http.StatusUnauthorized, domain.UserID{}, false},
+		{"unsupported version", nil, []string{"ya.v2", bearerProtocolPrefix + aliceToken}, http.StatusBadRequest, domain.UserID{}, false},
+		{"header", http.Header{"Authorization": {"Bearer " + aliceToken}}, nil, 0, alice, false},
+		{"session", nil, []string{protocolV1, bearerProtocolPrefix + aliceToken, sessionProtocolPrefix + first.session.Token}, 0, alice, true},
+		{"session of another user", nil, []string{protocolV1, bearerProtocolPrefix + ts.token(bob), sessionProtocolPrefix + first.session.Token}, 0, bob, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, resp, err := ts.dial("/ws", tt.header, nil, tt.protocols...)
+			if tt.status != 0 {
+				if err == nil || resp == nil || resp.StatusCode != tt.status {
+					t.Fatalf("handshake %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.session.UserID != tt.user.String() || c.session.Resumed != tt.resumed {
+				t.Fatalf("session %+v, want user %v resumed %t", c.session, tt.user, tt.resumed)
+			}
+			if tt.resumed != (c.session.Token == first.session.Token) {
+				t.Fatalf("session token %q, first %q", c.session.Token, first.session.Token)
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	ts := newTestServer(t, DefaultWSConfig())
+	alice, bob := ts.user("alice"), ts.user("bob")
+	roomID := ts.room(bob, alice)
+
+	// A new session receives the rooms the user already belongs to
+	first := ts.connect(alice)
+	ts.send(bob, roomID, "one")
+	var msg messageDTO
+	first.expect(typeMessage).decode(t, &msg)
+	if msg.Content != "one" || msg.Seq != 1 {
+		t.Fatalf("got %+v, want message one", msg)
+	}
+	first.conn.Close()
+	ts.waitOffline(roomID, alice)
+
+	ts.send(bob, roomID, "two")
+	ts.send(bob, roomID, "three")
+
+	c := ts.connect(alice, protocolV1, sessionProtocolPrefix+first.session.Token)
+	if !c.session.Resumed {
+		t.Fatal("session not resumed")
+	}
+	c.write(string(mustJSON(inboundEnvelope{Type: "resume", ID: "r", Payload: mustJSON(map[string]any{
+		"last_seq": map[string]int64{roomID.String(): 1},
+	})})))
+	var replayed historyDTO
+	c.expect(typeHistory).decode(t, &replayed)
+	var got []string
+	for _, m := range replayed.Messages {
+		got = append(got, m.Content)
+	}
+	if replayed.RoomID != roomID.String() || !slices.Equal(got, []string{"two", "three"}) {
+		t.Fatalf("replayed %q of %s, want two and three", got, replayed.RoomID)
+	}
+	if f := c.expect(typeAck); f.ID != "r" {
+		t.Fatalf("ack of %q, want the resume request", f.ID)
+	}
+
+	ts.send(bob, roomID, "four")
+	c.expect(typeMessage).decode(t, &msg)
+	if msg.Content != "four" || msg.Seq != 4 {
+		t.Fatalf("got %+v after the replay, want message four", msg)
+	}
+}
+
+func TestPongDeadline(t *testing.T) {
+	cfg := DefaultWSConfig()
+	cfg.PingInterval = 20 * time.Millisecond
+	cfg.PongTimeout = 100 * time.Millisecond
+	ts := newTestServer(t, cfg)
+	alice := ts.user("alice")
+
+	t.Run("answering pings", func(t *testing.T) {
+		c := ts.connect(alice)
+		c.t = t
+		time.Sleep(5 * cfg.PongTimeout)
+		c.ack("list_rooms", nil, nil)
+	})
+
+	t.Run("silent client", func(t *testing.T) {
+		before := wsMetric("heartbeat_timeouts")
+		ignorePings := func(conn *websocket.Conn) { conn.SetPingHandler(func(string) error { return nil }) }
+		c, _, err := ts.dial("/ws", ts.authorization(alice), ignorePings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.t = t
+		c.expectClosed()
+		if got := wsMetric("heartbeat_timeouts") - before; got != 1 {
+			t.Fatalf("heartbeat_timeouts grew by %d, want 1", got)
+		}
+	})
+}
+
+// wsMetric reads a counter of the package's expvar map.
+func wsMetric(name string) int64 {
+	if v, ok := wsMetrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
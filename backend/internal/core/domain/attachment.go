@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidAttachment  = errors.New("invalid attachment")
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+	ErrAttachmentType     = errors.New("attachment type not allowed")
+	ErrTooManyAttachments = errors.New("too many attachments")
+)
+
+const maxFileNameLength = 255
+
+// Attachment is a file shared in a message. The content lives in the blob
+// store under Key.
+type Attachment struct {
+	ID   AttachmentID
+	Name string
+	// ContentType is detected from the content, not taken from the client
+	ContentType string
+	Size        int64
+	Key         string
+	CreatedAt   time.Time
+	// Width and Height are set on images the server could decode, in
+	// display orientation
+	Width  int
+	Height int
+	// ThumbnailKey holds a small preview of images, empty when there is none
+	ThumbnailKey string
+
+	// URL downloads the content without credentials until it expires,
+	// filled in by ChatService like Message.Sender, as is ThumbnailURL. Not
+	// persisted.
+	URL          string
+	ThumbnailURL string
+}
+
+func NewAttachment(roomID RoomID, name, contentType string, size int64) (Attachment, error) {
+	name = cleanFileName(name)
+	if name == "" || contentType == "" || size <= 0 {
+		return Attachment{}, ErrInvalidAttachment
+	}
+	id := NewAttachmentID()
+	return Attachment{
+		ID:          id,
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+		Key:         roomID.String() + "/" + id.String() + "/" + name,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// IsImage reports whether browsers may display the attachment inline.
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
+
+// cleanFileName keeps the last element of a client supplied path, without
+// control characters, so that it is safe in a blob key.
+func cleanFileName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == ".." {
+		return ""
+	}
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "errors"
+
+var (
+	ErrUnauthenticated    = errors.New("unauthenticated")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
+	ErrPasswordTooLong    = errors.New("password must be at most 72 bytes")
+)
+
+const (
+	MinPasswordLength = 8
+	// MaxPasswordLength is the most bcrypt hashes, in bytes
+	MaxPasswordLength = 72
+)
+
+// Identity is a user as an authentication provider knows them. Username and
+// DisplayName are hints for the profile created when the user first signs
+// in, either may be empty.
+type Identity struct {
+	UserID      UserID
+	Username    string
+	DisplayName string
+}
@@ -24,6 +24,14 @@ func NewRoomIDFromString(s string) (RoomID, error) {
 	return RoomID(id), nil
 }
 
+func NewUserIDFromString(s string) (UserID, error) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return UserID{}, err
+	}
+	return UserID(id), nil
+}
+
 func (id UserID) String() string {
 	return uuid.UUID(id).String()
 }
@@ -41,3 +49,21 @@ func NewMessageID() MessageID {
 func (id MessageID) String() string {
 	return uuid.UUID(id).String()
 }
+
+func NewMessageIDFromString(s string) (MessageID, error) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return MessageID{}, err
+	}
+	return MessageID(id), nil
+}
+
+type AttachmentID uuid.UUID
+
+func NewAttachmentID() AttachmentID {
+	return AttachmentID(uuid.New())
+}
+
+func (id AttachmentID) String() string {
+	return uuid.UUID(id).String()
+}
@@ -2,6 +2,15 @@ package domain
 
 import (
 	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrEmptyContent    = errors.New("message content cannot be empty")
+	ErrMessageDeleted  = errors.New("message was deleted")
+	ErrNotAuthor       = fmt.Errorf("%w: not the author of this message", ErrForbidden)
 )
 
 type Message struct {
@@ -9,17 +18,106 @@ type Message struct {
 	RoomID   RoomID
 	SenderID UserID
 	Content  string
-	// CreatedAt time.Time
+	// Seq is assigned by the repository on save: strictly increasing within
+	// a room, starting at 1, without gaps.
+	Seq       int64
+	CreatedAt time.Time
+	// EditedAt is zero until the first edit
+	EditedAt time.Time
+	// A deleted message stays in its room as a tombstone, without content
+	DeletedAt time.Time
+	DeletedBy UserID
+	// ParentID is the root of the thread a reply belongs to, nil for
+	// messages of the room's main stream. Threads are one level deep.
+	ParentID *MessageID
+	// ReplyCount is the number of replies in the thread of a root message,
+	// maintained by the repository
+	ReplyCount int
+	// Attachments keep their upload order, a message with attachments may
+	// have no content
+	Attachments []Attachment
+
+	// Sender is the author's profile, filled in by ChatService before the
+	// message leaves the core. Not persisted; nil for unknown users.
+	Sender *User
+	// Reactions are filled in by ChatService like Sender, tombstones have none
+	Reactions []ReactionSummary
 }
 
-func NewMessage(senderID UserID, roomID RoomID, content string) (*Message, error) {
-	if content == "" {
-		return nil, errors.New("message content cannot be empty")
+func NewMessage(senderID UserID, roomID RoomID, content string, attachments ...Attachment) (*Message, error) {
+	if content == "" && len(attachments) == 0 {
+		return nil, ErrEmptyContent
 	}
 	return &Message{
-		ID:       NewMessageID(),
-		RoomID:   roomID,
-		SenderID: senderID,
-		Content:  content,
+		ID:          NewMessageID(),
+		RoomID:      roomID,
+		SenderID:    senderID,
+		Content:     content,
+		Attachments: attachments,
+		CreatedAt:   time.Now().UTC(),
 	}, nil
 }
+
+// NewReply creates a reply in the thread of parent. Replying to a reply
+// answers its root.
+func NewReply(senderID UserID, parent Message, content string, attachments ...Attachment) (*Message, error) {
+	if parent.Deleted() {
+		return nil, ErrMessageDeleted
+	}
+	msg, err := NewMessage(senderID, parent.RoomID, content, attachments...)
+	if err != nil {
+		return nil, err
+	}
+	root := parent.ThreadID()
+	msg.ParentID = &root
+	return msg, nil
+}
+
+// ThreadID returns the ID of the root of the thread m belongs to, m's own ID
+// for messages of the main stream.
+func (m Message) ThreadID() MessageID {
+	if m.ParentID != nil {
+		return *m.ParentID
+	}
+	return m.ID
+}
+
+// MessageRevision is the content a message had before one of its edits.
+type MessageRevision struct {
+	MessageID MessageID
+	Content   string
+	// EditedAt is when this content was replaced
+	EditedAt time.Time
+}
+
+func (m Message) Deleted() bool {
+	return !m.DeletedAt.IsZero()
+}
+
+// Edit replaces the content and returns the revision holding the previous one.
+func (m *Message) Edit(content string) (MessageRevision, error) {
+	if m.Deleted() {
+		return MessageRevision{}, ErrMessageDeleted
+	}
+	if content == "" && len(m.Attachments) == 0 {
+		return MessageRevision{}, ErrEmptyContent
+	}
+	now := time.Now().UTC()
+	rev := MessageRevision{
+		MessageID: m.ID,
+		Content:   m.Content,
+		EditedAt:  now,
+	}
+	m.Content = content
+	m.EditedAt = now
+	return rev, nil
+}
+
+// Delete turns the message into a tombstone, the caller removes the content
+// of its attachments.
+func (m *Message) Delete(by UserID) {
+	m.Content = ""
+	m.Attachments = nil
+	m.DeletedAt = time.Now().UTC()
+	m.DeletedBy = by
+}
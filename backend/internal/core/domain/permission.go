@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrForbidden matches every *PermissionError.
+	ErrForbidden   = errors.New("forbidden")
+	ErrBanned      = errors.New("banned from this room")
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+type Permission string
+
+const (
+	PermSendMessage Permission = "send_message"
+	PermJoinCall    Permission = "join_call"
+	PermInvite      Permission = "invite"
+	PermKick        Permission = "kick"
+	PermBan         Permission = "ban"
+	PermChangeTopic Permission = "change_topic"
+	PermMuteInCall  Permission = "mute_in_call"
+	PermManageRoles Permission = "manage_roles"
+	// PermDeleteMessage allows deleting other members' messages
+	PermDeleteMessage Permission = "delete_message"
+	PermReact         Permission = "react"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner: {
+		PermSendMessage, PermJoinCall, PermInvite, PermKick, PermBan,
+		PermChangeTopic, PermMuteInCall, PermManageRoles, PermDeleteMessage,
+		PermReact,
+	},
+	RoleAdmin: {
+		PermSendMessage, PermJoinCall, PermInvite, PermKick, PermBan,
+		PermChangeTopic, PermMuteInCall, PermDeleteMessage, PermReact,
+	},
+	RoleMember: {PermSendMessage, PermJoinCall, PermInvite, PermReact},
+	// Guests may read and listen in on calls
+	RoleGuest: {PermJoinCall},
+}
+
+var roleRanks = map[Role]int{
+	RoleGuest:  1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks reports whether r may act on a member holding other, e.g. an
+// admin can kick members and guests but not another admin.
+func (r Role) Outranks(other Role) bool {
+	return roleRanks[r] > roleRanks[other]
+}
+
+// PermissionError is returned when a member's role does not allow an action,
+// or does not outrank the member it targets.
+type PermissionError struct {
+	Permission Permission
+	Role       Role
+	// Over is the target's role when Role does not outrank it
+	Over Role
+}
+
+func (e *PermissionError) Error() string {
+	if e.Over != "" {
+		return fmt.Sprintf("role %s cannot %s a member with role %s", e.Role, e.Permission, e.Over)
+	}
+	return fmt.Sprintf("role %s lacks permission %s", e.Role, e.Permission)
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// Authorize returns a *PermissionError unless m's role grants p.
+func (m Member) Authorize(p Permission) error {
+	if !m.Role.Can(p) {
+		return &PermissionError{Permission: p, Role: m.Role}
+	}
+	return nil
+}
+
+// Ban keeps a user out of a room until lifted.
+type Ban struct {
+	RoomID    RoomID
+	UserID    UserID
+	BannedBy  UserID
+	CreatedAt time.Time
+}
+
+func NewBan(roomID RoomID, userID, bannedBy UserID) Ban {
+	return Ban{
+		RoomID:    roomID,
+		UserID:    userID,
+		BannedBy:  bannedBy,
+		CreatedAt: time.Now().UTC(),
+	}
+}
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+	all := []Permission{
+		PermSendMessage, PermJoinCall, PermInvite, PermKick, PermBan,
+		PermChangeTopic, PermMuteInCall, PermManageRoles, PermDeleteMessage,
+		PermReact,
+	}
+	granted := map[Role][]Permission{
+		RoleOwner: all,
+		RoleAdmin: {
+			PermSendMessage, PermJoinCall, PermInvite, PermKick, PermBan,
+			PermChangeTopic, PermMuteInCall, PermDeleteMessage, PermReact,
+		},
+		RoleMember: {PermSendMessage, PermJoinCall, PermInvite, PermReact},
+		RoleGuest:  {PermJoinCall},
+	}
+	for role, perms := range granted {
+		for _, p := range all {
+			t.Run(string(role)+"/"+string(p), func(t *testing.T) {
+				want := false
+				for _, g := range perms {
+					want = want || g == p
+				}
+				if got := role.Can(p); got != want {
+					t.Fatalf("Can = %v, want %v", got, want)
+				}
+				err := NewMember(NewUserID(), role).Authorize(p)
+				if want != (err == nil) {
+					t.Fatalf("Authorize = %v, want allowed %v", err, want)
+				}
+				var perr *PermissionError
+				if err != nil && (!errors.Is(err, ErrForbidden) || !errors.As(err, &perr) || perr.Permission != p || perr.Role != role) {
+					t.Fatalf("Authorize = %#v, want a forbidden PermissionError", err)
+				}
+			})
+		}
+	}
+	if Role("root").Can(PermSendMessage) || Role("root").Valid() {
+		t.Fatal("unknown role is granted permissions")
+	}
+}
+
+func TestRoleOutranks(t *testing.T) {
+	order := []Role{RoleGuest, RoleMember, RoleAdmin, RoleOwner}
+	for i, r := range order {
+		for j, other := range order {
+			if got, want := r.Outranks(other), i > j; got != want {
+				t.Fatalf("%s.Outranks(%s) = %v, want %v", r, other, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+type PresenceKind string
+
+const (
+	// PresenceJoin and PresenceLeave follow room membership
+	PresenceJoin  PresenceKind = "join"
+	PresenceLeave PresenceKind = "leave"
+	// PresenceOnline and PresenceOffline follow connections: a member is
+	// online in a room while at least one of their devices is attached to it
+	PresenceOnline  PresenceKind = "online"
+	PresenceOffline PresenceKind = "offline"
+)
+
+type Presence struct {
+	RoomID RoomID
+	UserID UserID
+	Kind   PresenceKind
+	At     time.Time
+}
+
+func NewPresence(roomID RoomID, userID UserID, kind PresenceKind) Presence {
+	return Presence{
+		RoomID: roomID,
+		UserID: userID,
+		Kind:   kind,
+		At:     time.Now(),
+	}
+}
+
+// RosterEntry is a room member and whether they are online in the room.
+type RosterEntry struct {
+	Member
+	Online bool
+}
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"errors"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrInvalidEmoji = errors.New("invalid emoji")
+
+// maxEmojiLength leaves room for ZWJ sequences and :shortcodes:
+const maxEmojiLength = 64
+
+// Reaction is one user's emoji on a message. A user reacts at most once with
+// the same emoji to a message.
+type Reaction struct {
+	MessageID MessageID
+	RoomID    RoomID
+	UserID    UserID
+	Emoji     string
+	CreatedAt time.Time
+}
+
+func NewReaction(userID UserID, msg Message, emoji string) (Reaction, error) {
+	if msg.Deleted() {
+		return Reaction{}, ErrMessageDeleted
+	}
+	if err := ValidateEmoji(emoji); err != nil {
+		return Reaction{}, err
+	}
+	return Reaction{
+		MessageID: msg.ID,
+		RoomID:    msg.RoomID,
+		UserID:    userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// ValidateEmoji accepts any short text without spaces or control characters,
+// the server does not keep a list of emoji.
+func ValidateEmoji(emoji string) error {
+	if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+		return ErrInvalidEmoji
+	}
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return ErrInvalidEmoji
+		}
+	}
+	return nil
+}
+
+// ReactionSummary is every reaction to a message with one emoji.
+type ReactionSummary struct {
+	Emoji string
+	// UserIDs are the users who reacted, earliest first
+	UserIDs []UserID
+}
+
+// SummarizeReactions groups reactions by emoji, in the order each emoji was
+// first used. reactions must be ordered oldest first.
+func SummarizeReactions(reactions []Reaction) []ReactionSummary {
+	var summaries []ReactionSummary
+	index := make(map[string]int)
+	for _, r := range reactions {
+		i, ok := index[r.Emoji]
+		if !ok {
+			i = len(summaries)
+			index[r.Emoji] = i
+			summaries = append(summaries, ReactionSummary{Emoji: r.Emoji})
+		}
+		summaries[i].UserIDs = append(summaries[i].UserIDs, r.UserID)
+	}
+	return summaries
+}
+
+// ReactionChange tells a room that a reaction was added or removed.
+type ReactionChange struct {
+	Reaction
+	Added bool
+	// ThreadID is the root of the thread the message belongs to
+	ThreadID MessageID
+}
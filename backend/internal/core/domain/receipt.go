@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// ReadMarker is the last message a user has read in a room. Markers only
+// move forward, everything up to Seq counts as read.
+type ReadMarker struct {
+	RoomID    RoomID
+	UserID    UserID
+	MessageID MessageID
+	Seq       int64
+	ReadAt    time.Time
+}
+
+func NewReadMarker(userID UserID, msg Message) ReadMarker {
+	return ReadMarker{
+		RoomID:    msg.RoomID,
+		UserID:    userID,
+		MessageID: msg.ID,
+		Seq:       msg.Seq,
+		ReadAt:    time.Now(),
+	}
+}
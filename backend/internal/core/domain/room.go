@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"bytes"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRoomNotFound    = errors.New("room not found")
+	ErrNotMember       = errors.New("not a member of this room")
+	ErrAlreadyMember   = errors.New("already a member of this room")
+	ErrInvalidRoomName = errors.New("room name must be 1-100 characters")
+	ErrInvalidTopic    = errors.New("room topic must be at most 500 characters")
+	ErrInvalidRoomKind = errors.New("invalid room kind")
+	ErrRoomClosed      = errors.New("room is invite only")
+	ErrRoomExists      = errors.New("room already exists")
+	ErrInvalidPeer     = errors.New("a direct conversation needs two distinct users")
+	ErrDirectRoom      = errors.New("members of a direct conversation cannot change")
+	ErrCallRoom        = errors.New("call rooms carry no messages")
+)
+
+// directNamespace seeds the deterministic IDs of direct rooms.
+var directNamespace = uuid.MustParse("4f1c7d0e-2a5b-5c3e-9d8f-6b7a1e0c2d94")
+
+type RoomKind string
+
+const (
+	RoomGroup  RoomKind = "group"
+	RoomDirect RoomKind = "direct"
+	// RoomCall rooms exist only to host a call, they carry no chat history
+	RoomCall RoomKind = "call"
+)
+
+func (k RoomKind) Valid() bool {
+	switch k {
+	case RoomGroup, RoomDirect, RoomCall:
+		return true
+	}
+	return false
+}
+
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleGuest  Role = "guest"
+)
+
+type Member struct {
+	UserID   UserID
+	Role     Role
+	JoinedAt time.Time
+}
+
+func NewMember(userID UserID, role Role) Member {
+	return Member{
+		UserID:   userID,
+		Role:     role,
+		JoinedAt: time.Now().UTC(),
+	}
+}
+
+type Room struct {
+	ID        RoomID
+	Name      string
+	Topic     string
+	Kind      RoomKind
+	CreatedBy UserID
+	CreatedAt time.Time
+	Members   []Member
+}
+
+// NewRoom creates a room whose creator is its owner and only member.
+func NewRoom(name, topic string, kind RoomKind, createdBy UserID) (*Room, error) {
+	if !kind.Valid() {
+		return nil, ErrInvalidRoomKind
+	}
+	if err := ValidateRoomName(name); err != nil {
+		return nil, err
+	}
+	if err := ValidateTopic(topic); err != nil {
+		return nil, err
+	}
+	return &Room{
+		ID:        NewRoomID(),
+		Name:      name,
+		Topic:     topic,
+		Kind:      kind,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+		Members:   []Member{NewMember(createdBy, RoleOwner)},
+	}, nil
+}
+
+// DirectRoomID returns the ID of the direct room between a and b, the same
+// whichever of the two asks.
+func DirectRoomID(a, b UserID) RoomID {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return RoomID(uuid.NewSHA1(directNamespace, append(a[:], b[:]...)))
+}
+
+// NewDirectRoom creates the one-to-one room of a and b. Both are plain
+// members and nobody else can ever join.
+func NewDirectRoom(a, b UserID) (*Room, error) {
+	if a == b {
+		return nil, ErrInvalidPeer
+	}
+	return &Room{
+		ID:        DirectRoomID(a, b),
+		Kind:      RoomDirect,
+		CreatedBy: a,
+		CreatedAt: time.Now().UTC(),
+		Members:   []Member{NewMember(a, RoleMember), NewMember(b, RoleMember)},
+	}, nil
+}
+
+func (r *Room) Member(userID UserID) (Member, bool) {
+	for _, m := range r.Members {
+		if m.UserID == userID {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+// Open reports whether anyone may join without an invitation.
+func (r *Room) Open() bool {
+	return r.Kind != RoomDirect
+}
+
+// Chat reports whether messages may be posted in the room.
+func (r *Room) Chat() bool {
+	return r.Kind != RoomCall
+}
+
+// MemberIDs returns the user IDs of every member.
+func (r *Room) MemberIDs() []UserID {
+	ids := make([]UserID, 0, len(r.Members))
+	for _, m := range r.Members {
+		ids = append(ids, m.UserID)
+	}
+	return ids
+}
+
+func ValidateRoomName(name string) error {
+	if n := utf8.RuneCountInString(name); n < 1 || n > 100 {
+		return ErrInvalidRoomName
+	}
+	return nil
+}
+
+func ValidateTopic(topic string) error {
+	if utf8.RuneCountInString(topic) > 500 {
+		return ErrInvalidTopic
+	}
+	return nil
+}
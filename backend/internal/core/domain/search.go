@@ -0,0 +1,18 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptySearch = errors.New("search needs text or a sender")
+
+// SearchTerms splits text into lowercase words. A search matches the
+// messages in which every term starts a word, indexes split content the
+// same way.
+func SearchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,17 @@
+package domain
+
+// Typing tells a room that a member started or stopped typing. It is never
+// stored.
+type Typing struct {
+	RoomID RoomID
+	UserID UserID
+	Typing bool
+}
+
+func NewTyping(roomID RoomID, userID UserID, typing bool) Typing {
+	return Typing{
+		RoomID: roomID,
+		UserID: userID,
+		Typing: typing,
+	}
+}
@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUsernameTaken      = errors.New("username already taken")
+	ErrInvalidUsername    = errors.New("username must be 3-32 characters of a-z, 0-9, '.', '_' or '-'")
+	ErrInvalidDisplayName = errors.New("display name must be 1-64 characters")
+	ErrInvalidStatus      = errors.New("invalid status")
+	ErrInvalidAvatarRef   = errors.New("avatar reference must be at most 2048 bytes")
+	ErrInvalidStatusText  = errors.New("status text must be at most 140 characters")
+)
+
+const (
+	MaxAvatarRefLength  = 2048 // bytes
+	MaxStatusTextLength = 140  // characters
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,32}$`)
+
+type UserStatus string
+
+const (
+	StatusAvailable UserStatus = "available"
+	StatusAway      UserStatus = "away"
+	StatusBusy      UserStatus = "busy"
+)
+
+func (s UserStatus) Valid() bool {
+	switch s {
+	case StatusAvailable, StatusAway, StatusBusy:
+		return true
+	}
+	return false
+}
+
+type User struct {
+	ID          UserID
+	Username    string
+	DisplayName string
+	// AvatarRef points at the avatar image (URL or blob key), empty if unset
+	AvatarRef  string
+	Status     UserStatus
+	StatusText string
+	CreatedAt  time.Time
+}
+
+func NewUser(username, displayName string) (*User, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if displayName == "" {
+		displayName = username
+	}
+	if err := ValidateDisplayName(displayName); err != nil {
+		return nil, err
+	}
+	return &User{
+		ID:          NewUserID(),
+		Username:    username,
+		DisplayName: displayName,
+		Status:      StatusAvailable,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+func ValidateDisplayName(name string) error {
+	if n := utf8.RuneCountInString(name); n < 1 || n > 64 {
+		return ErrInvalidDisplayName
+	}
+	return nil
+}
+
+func ValidateAvatarRef(ref string) error {
+	if len(ref) > MaxAvatarRefLength {
+		return ErrInvalidAvatarRef
+	}
+	return nil
+}
+
+func ValidateStatusText(text string) error {
+	if utf8.RuneCountInString(text) > MaxStatusTextLength {
+		return ErrInvalidStatusText
+	}
+	return nil
+}
+
+// NewUserFromIdentity creates the profile of a user first seen through an
+// authentication provider. Hints breaking the profile rules are adapted, or
+// replaced with a name derived from the user ID.
+func NewUserFromIdentity(id Identity) *User {
+	username := strings.ToLower(id.Username)
+	// An email address makes a fine username once its domain is gone
+	username, _, _ = strings.Cut(username, "@")
+	username = strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, username)
+	if len(username) > 32 {
+		username = username[:32]
+	}
+	if !usernamePattern.MatchString(username) {
+		username = FallbackUsername(id.UserID)
+	}
+
+	displayName := strings.TrimSpace(id.DisplayName)
+	if displayName == "" {
+		displayName = username
+	}
+	if utf8.RuneCountInString(displayName) > 64 {
+		displayName = string([]rune(displayName)[:64])
+	}
+
+	return &User{
+		ID:          id.UserID,
+		Username:    username,
+		DisplayName: displayName,
+		Status:      StatusAvailable,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// FallbackUsername is the username of a provisioned user whose provider
+// suggested none that could be used.
+func FallbackUsername(id UserID) string {
+	return "user-" + strings.ReplaceAll(id.String(), "-", "")[:12]
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewUserFromIdentity(t *testing.T) {
+	id := NewUserID()
+	tests := []struct {
+		name        string
+		identity    Identity
+		username    string
+		displayName string
+	}{
+		{"hints", Identity{UserID: id, Username: "alice", DisplayName: "Alice"}, "alice", "Alice"},
+		{"email", Identity{UserID: id, Username: "Alice.Smith@example.com"}, "alice.smith", "alice.smith"},
+		{"invalid characters", Identity{UserID: id, Username: "Zoë Müller"}, "zomller", "zomller"},
+		{"too short", Identity{UserID: id, Username: "é", DisplayName: "Élise"}, FallbackUsername(id), "Élise"},
+		{"no hints", Identity{UserID: id}, FallbackUsername(id), FallbackUsername(id)},
+		{"long", Identity{UserID: id, Username: strings.Repeat("a", 40), DisplayName: strings.Repeat("é", 70)},
+			strings.Repeat("a", 32), strings.Repeat("é", 64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := NewUserFromIdentity(tt.identity)
+			if user.ID != id || user.Username != tt.username || user.DisplayName != tt.displayName {
+				t.Fatalf("got %q (%q), want %q (%q)", user.Username, user.DisplayName, tt.username, tt.displayName)
+			}
+			if !usernamePattern.MatchString(user.Username) || ValidateDisplayName(user.DisplayName) != nil {
+				t.Fatalf("profile %q (%q) breaks the profile rules", user.Username, user.DisplayName)
+			}
+		})
+	}
+}
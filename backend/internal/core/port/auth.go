@@ -0,0 +1,28 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+// TokenVerifier resolves a bearer token to the user it was issued for.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (domain.Identity, error)
+}
+
+// TokenIssuer mints bearer tokens accepted by the matching TokenVerifier.
+type TokenIssuer interface {
+	IssueToken(ctx context.Context, userID domain.UserID) (token string, expiresAt time.Time, err error)
+}
+
+// PasswordAuthenticator checks username/password credentials.
+type PasswordAuthenticator interface {
+	Authenticate(ctx context.Context, username, password string) (domain.UserID, error)
+}
+
+// PasswordHasher hashes passwords for the matching PasswordAuthenticator.
+type PasswordHasher interface {
+	HashPassword(password string) ([]byte, error)
+}
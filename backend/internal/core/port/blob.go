@@ -0,0 +1,31 @@
+package port
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobInfo describes the content of a blob.
+type BlobInfo struct {
+	Size        int64
+	ContentType string
+	// ContentDisposition is sent along with the content on download
+	ContentDisposition string
+}
+
+// BlobStore keeps the content of attachments under opaque keys.
+type BlobStore interface {
+	// Put stores exactly info.Size bytes of body under key.
+	Put(ctx context.Context, key string, body io.Reader, info BlobInfo) error
+	// Get fails with ErrBlobNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds when there is nothing to delete.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads key without credentials until
+	// expires.
+	SignedURL(ctx context.Context, key string, expires time.Time) (string, error)
+}
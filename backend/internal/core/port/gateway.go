@@ -2,12 +2,48 @@ package port
 
 import (
 	"context"
+	"errors"
 
 	"github.com/Wyydra/ya/backend/internal/core/domain"
 )
 
+// ErrGatewayUnavailable is returned when the gateway cannot accept a message
+// for delivery, e.g. because it is overloaded.
+var ErrGatewayUnavailable = errors.New("real-time delivery unavailable")
+
 type RealTimeGateway interface {
 	BroadcastMessage(ctx context.Context, msg domain.Message) error
-	SendSignal(ctx context.Context, userID domain.UserID, signal domain.Signal) error
+	// SendMessage delivers msg to every connection of the given users only,
+	// whatever rooms they are subscribed to.
+	SendMessage(ctx context.Context, userIDs []domain.UserID, msg domain.Message) error
+	// BroadcastUpdate and SendUpdate deliver an edited or deleted message
+	// the way BroadcastMessage and SendMessage delivered the original.
+	BroadcastUpdate(ctx context.Context, msg domain.Message) error
+	SendUpdate(ctx context.Context, userIDs []domain.UserID, msg domain.Message) error
+	// SendSignal reaches the connection userID joined the call of roomID from.
+	SendSignal(ctx context.Context, roomID domain.RoomID, userID domain.UserID, signal domain.Signal) error
+	// EndCall tells userID they were removed from the call of roomID.
+	EndCall(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error
+	// SendTyping tells the other connections subscribed to the room.
+	SendTyping(ctx context.Context, typing domain.Typing) error
+	// SendReceipt tells every connection subscribed to the room, the
+	// reader's other devices included.
+	SendReceipt(ctx context.Context, marker domain.ReadMarker) error
+	// SendReaction tells every connection subscribed to the room, and the
+	// followers of the message's thread.
+	SendReaction(ctx context.Context, change domain.ReactionChange) error
+	// NotifyUserJoined and NotifyUserLeft tell the other members of a room
+	// about a membership change.
 	NotifyUserJoined(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error
+	NotifyUserLeft(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error
+	// OnlineUsers returns the users with a connection attached to roomID.
+	OnlineUsers(ctx context.Context, roomID domain.RoomID) ([]domain.UserID, error)
+	// JoinRoom subscribes every connection of userID to messages of roomID.
+	JoinRoom(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error
+	LeaveRoom(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error
+	// FollowThread subscribes every connection of userID to the root and
+	// replies of a thread, without subscribing them to the rest of the
+	// room. Leaving the room drops the threads followed in it.
+	FollowThread(ctx context.Context, roomID domain.RoomID, rootID domain.MessageID, userID domain.UserID) error
+	UnfollowThread(ctx context.Context, rootID domain.MessageID, userID domain.UserID) error
 }
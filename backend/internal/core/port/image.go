@@ -0,0 +1,27 @@
+package port
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// ProcessedImage is an uploaded image made ready for storage.
+type ProcessedImage struct {
+	// Data is the original encoding without location metadata
+	Data []byte
+	// Width and Height are in display orientation
+	Width  int
+	Height int
+	// Thumbnail is a small preview, nil when the image is too large to
+	// decode safely
+	Thumbnail            []byte
+	ThumbnailContentType string
+}
+
+// ImageProcessor prepares uploaded images before they are stored.
+type ImageProcessor interface {
+	// Process fails with ErrUnsupportedImage for formats it does not know.
+	Process(ctx context.Context, contentType string, data []byte) (ProcessedImage, error)
+}
@@ -5,6 +5,9 @@ import "github.com/Wyydra/ya/backend/internal/core/domain"
 type MediaEngine interface {
 	AddPeer(sessionID domain.SessionID, userID domain.UserID) (offer domain.Signal, err error)
 	HandleSignal(sessionID domain.SessionID, userID domain.UserID, signal domain.Signal) error
-	RemovePeer(sessionID domain.SessionID,userID domain.UserID)
+	// RemovePeer reports whether the user was in the call.
+	RemovePeer(sessionID domain.SessionID,userID domain.UserID) bool
+	// SetMuted stops or resumes relaying a peer's audio to the others.
+	SetMuted(sessionID domain.SessionID, userID domain.UserID, muted bool) error
 	SetSignalCallback(cb func(sessionID domain.SessionID, userID domain.UserID, signal domain.Signal)) //TODO: investigate if its needed
 }
@@ -2,10 +2,118 @@ package port
 
 import (
 	"context"
+	"time"
 
 	"github.com/Wyydra/ya/backend/internal/core/domain"
 )
 
+// MessageRepository stores chat messages. Every history query returns
+// messages oldest first and at most limit of them.
 type MessageRepository interface {
-	Save(ctx context.Context, msg domain.Message) error
+	// Save persists msg and assigns its per-room sequence number. Saving a
+	// reply also counts it on its root.
+	Save(ctx context.Context, msg *domain.Message) error
+	// Latest returns the most recent messages of a room.
+	Latest(ctx context.Context, roomID domain.RoomID, limit int) ([]domain.Message, error)
+	// Before returns the messages immediately preceding messageID.
+	Before(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID, limit int) ([]domain.Message, error)
+	// After returns the messages immediately following messageID.
+	After(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID, limit int) ([]domain.Message, error)
+	// Since returns the messages whose sequence number is greater than seq.
+	Since(ctx context.Context, roomID domain.RoomID, seq int64, limit int) ([]domain.Message, error)
+	// Between returns the first messages created in [from, to).
+	Between(ctx context.Context, roomID domain.RoomID, from, to time.Time, limit int) ([]domain.Message, error)
+	// Get returns a single message of a room, or domain.ErrMessageNotFound.
+	Get(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) (domain.Message, error)
+	// Edit saves msg's new content and keeps previous as one of its revisions.
+	Edit(ctx context.Context, msg domain.Message, previous domain.MessageRevision) error
+	// Delete saves msg as a tombstone and drops its revisions.
+	Delete(ctx context.Context, msg domain.Message) error
+	// Revisions returns the previous contents of a message, oldest first.
+	Revisions(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) ([]domain.MessageRevision, error)
+	// Thread returns the replies to rootID whose sequence number is greater
+	// than seq.
+	Thread(ctx context.Context, roomID domain.RoomID, rootID domain.MessageID, seq int64, limit int) ([]domain.Message, error)
+	// LastSeqs returns the sequence number of the latest message of each
+	// room, rooms without messages are left out.
+	LastSeqs(ctx context.Context, roomIDs []domain.RoomID) (map[domain.RoomID]int64, error)
+	// Search returns the messages matching q, newest first. Deleted
+	// messages never match.
+	Search(ctx context.Context, q MessageSearch) ([]domain.Message, error)
+}
+
+// MessageSearch selects messages across rooms.
+type MessageSearch struct {
+	// Terms, from domain.SearchTerms, must each start a word of the
+	// content. Without terms every message matches.
+	Terms    []string
+	RoomIDs  []domain.RoomID
+	SenderID *domain.UserID
+	// From and To bound the creation time to [From, To) when set
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// ReadMarkerRepository stores how far each user has read in each room.
+type ReadMarkerRepository interface {
+	// Advance saves marker unless the stored one is at the same or a later
+	// message, and reports whether it moved.
+	Advance(ctx context.Context, marker domain.ReadMarker) (bool, error)
+	// ForRoom returns the markers of everyone who read in a room.
+	ForRoom(ctx context.Context, roomID domain.RoomID) ([]domain.ReadMarker, error)
+	// ForUser returns userID's markers keyed by room.
+	ForUser(ctx context.Context, userID domain.UserID) (map[domain.RoomID]domain.ReadMarker, error)
+}
+
+// ReactionRepository stores emoji reactions to messages.
+type ReactionRepository interface {
+	// Add saves r unless the user already reacted to the message with that
+	// emoji, and reports whether it was added. Fails with
+	// domain.ErrMessageNotFound.
+	Add(ctx context.Context, r domain.Reaction) (bool, error)
+	// Remove deletes a reaction and reports whether there was one.
+	Remove(ctx context.Context, messageID domain.MessageID, userID domain.UserID, emoji string) (bool, error)
+	// ForMessages returns the reactions to each of the messages, oldest
+	// first. Messages without reactions are left out.
+	ForMessages(ctx context.Context, messageIDs []domain.MessageID) (map[domain.MessageID][]domain.Reaction, error)
+}
+
+type UserRepository interface {
+	// Create stores a new user; passwordHash may be nil for users that
+	// authenticate elsewhere. Fails with domain.ErrUsernameTaken.
+	Create(ctx context.Context, user domain.User, passwordHash []byte) error
+	Get(ctx context.Context, id domain.UserID) (domain.User, error)
+	// GetMany returns the users found among ids, silently skipping unknown ones.
+	GetMany(ctx context.Context, ids []domain.UserID) (map[domain.UserID]domain.User, error)
+	Update(ctx context.Context, user domain.User) error
+	// PasswordHash returns the credentials of a username, or
+	// domain.ErrUserNotFound.
+	PasswordHash(ctx context.Context, username string) (domain.UserID, []byte, error)
+}
+
+type RoomRepository interface {
+	// Create stores a room together with its initial members, or fails with
+	// domain.ErrRoomExists.
+	Create(ctx context.Context, room domain.Room) error
+	// Get returns a room with its members, or domain.ErrRoomNotFound.
+	Get(ctx context.Context, id domain.RoomID) (domain.Room, error)
+	// ListForUser returns the rooms userID is a member of, with members.
+	ListForUser(ctx context.Context, userID domain.UserID) ([]domain.Room, error)
+	// Update saves the room's name and topic.
+	Update(ctx context.Context, room domain.Room) error
+	// AddMember fails with domain.ErrAlreadyMember.
+	AddMember(ctx context.Context, roomID domain.RoomID, member domain.Member) error
+	// RemoveMember fails with domain.ErrNotMember.
+	RemoveMember(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error
+	// Member returns a single membership, or domain.ErrNotMember.
+	Member(ctx context.Context, roomID domain.RoomID, userID domain.UserID) (domain.Member, error)
+	// UpdateMember saves a member's role, or fails with domain.ErrNotMember.
+	UpdateMember(ctx context.Context, roomID domain.RoomID, member domain.Member) error
+	// AddBan bans a user and drops their membership if any. Banning twice
+	// is not an error.
+	AddBan(ctx context.Context, ban domain.Ban) error
+	// RemoveBan lifts a ban. Lifting a missing ban is not an error.
+	RemoveBan(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error
+	IsBanned(ctx context.Context, roomID domain.RoomID, userID domain.UserID) (bool, error)
 }
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/rs/zerolog/log"
+)
+
+type AttachmentConfig struct {
+	// MaxSize bounds each file, in bytes
+	MaxSize int64
+	// MaxFiles bounds the attachments of a single message
+	MaxFiles int
+	// Types are the allowed media types, "image/*" allows every image type
+	Types []string
+	// URLTTL is how long download URLs stay valid
+	URLTTL time.Duration
+}
+
+func DefaultAttachmentConfig() AttachmentConfig {
+	return AttachmentConfig{
+		MaxSize:  25 << 20,
+		MaxFiles: 10,
+		Types: []string{
+			"image/*", "audio/*", "video/*",
+			"text/plain", "application/pdf", "application/zip",
+		},
+		URLTTL: time.Hour,
+	}
+}
+
+func (c AttachmentConfig) Validate() error {
+	if c.MaxSize < 1 {
+		return errors.New("attachment max size must be positive")
+	}
+	if c.MaxFiles < 1 {
+		return errors.New("attachment max files must be positive")
+	}
+	if c.URLTTL <= 0 {
+		return errors.New("attachment URL TTL must be positive")
+	}
+	return nil
+}
+
+// Allows reports whether files of contentType may be attached. Parameters
+// such as charset are ignored.
+func (c AttachmentConfig) Allows(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, t := range c.Types {
+		if t == mediaType || t == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Upload is a file being attached to a message.
+type Upload struct {
+	Name string
+	// ContentType must be detected from the content by the caller
+	ContentType string
+	Size        int64
+	Body        io.Reader
+}
+
+// pendingBlob is content to put in the blob store.
+type pendingBlob struct {
+	key  string
+	body io.Reader
+	info port.BlobInfo
+}
+
+// SendFiles stores uploads in the blob store and sends a message carrying
+// them, in reply to parentID when set. content may be empty. Images are
+// stored without location metadata, along with a thumbnail.
+func (s *ChatService) SendFiles(ctx context.Context, senderID domain.UserID, roomID domain.RoomID, parentID *domain.MessageID, content string, uploads []Upload) (domain.Message, error) {
+	room, err := s.author(ctx, senderID, roomID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if len(uploads) > s.attachments.MaxFiles {
+		return domain.Message{}, domain.ErrTooManyAttachments
+	}
+
+	attachments := make([]domain.Attachment, 0, len(uploads))
+	pending := make([]pendingBlob, 0, len(uploads))
+	for _, u := range uploads {
+		if u.Size > s.attachments.MaxSize {
+			return domain.Message{}, domain.ErrAttachmentTooLarge
+		}
+		if !s.attachments.Allows(u.ContentType) {
+			return domain.Message{}, domain.ErrAttachmentType
+		}
+		a, err := domain.NewAttachment(roomID, u.Name, u.ContentType, u.Size)
+		if err != nil {
+			return domain.Message{}, err
+		}
+		blobs, err := s.prepare(ctx, &a, u)
+		if err != nil {
+			return domain.Message{}, err
+		}
+		attachments = append(attachments, a)
+		pending = append(pending, blobs...)
+	}
+
+	var msg *domain.Message
+	if parentID != nil {
+		parent, err := s.repo.Get(ctx, roomID, *parentID)
+		if err != nil {
+			return domain.Message{}, err
+		}
+		msg, err = domain.NewReply(senderID, parent, content, attachments...)
+		if err != nil {
+			return domain.Message{}, err
+		}
+	} else {
+		msg, err = domain.NewMessage(senderID, roomID, content, attachments...)
+		if err != nil {
+			return domain.Message{}, err
+		}
+	}
+
+	// Content first, nobody may see an attachment that cannot be downloaded
+	for _, b := range pending {
+		if err := s.blobs.Put(ctx, b.key, b.body, b.info); err != nil {
+			s.dropBlobs(ctx, attachments)
+			return domain.Message{}, err
+		}
+	}
+	var sent domain.Message
+	if msg.ParentID != nil {
+		sent, err = s.postReply(ctx, room, msg)
+	} else {
+		sent, err = s.post(ctx, room, msg)
+	}
+	// A message that was saved keeps its content even if delivery failed
+	if err != nil && msg.Seq == 0 {
+		s.dropBlobs(ctx, attachments)
+	}
+	return sent, err
+}
+
+// prepare returns what to store for an upload, filling in the image details
+// of a.
+func (s *ChatService) prepare(ctx context.Context, a *domain.Attachment, u Upload) ([]pendingBlob, error) {
+	if !a.IsImage() {
+		return []pendingBlob{{a.Key, u.Body, blobInfo(*a)}}, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(u.Body, u.Size))
+	if err != nil {
+		return nil, err
+	}
+	img, err := s.images.Process(ctx, a.ContentType, data)
+	switch {
+	case errors.Is(err, port.ErrUnsupportedImage):
+		return []pendingBlob{{a.Key, bytes.NewReader(data), blobInfo(*a)}}, nil
+	case err != nil:
+		return nil, fmt.Errorf("%w: %s: %v", domain.ErrInvalidAttachment, a.Name, err)
+	}
+
+	a.Size = int64(len(img.Data))
+	a.Width, a.Height = img.Width, img.Height
+	blobs := []pendingBlob{{a.Key, bytes.NewReader(img.Data), blobInfo(*a)}}
+	if img.Thumbnail == nil {
+		return blobs, nil
+	}
+	ext := thumbnailExt(img.ThumbnailContentType)
+	a.ThumbnailKey = "thumbs/" + a.ID.String() + ext
+	thumb := *a
+	thumb.Name = strings.TrimSuffix(a.Name, path.Ext(a.Name)) + ext
+	thumb.ContentType = img.ThumbnailContentType
+	thumb.Size = int64(len(img.Thumbnail))
+	return append(blobs, pendingBlob{a.ThumbnailKey, bytes.NewReader(img.Thumbnail), blobInfo(thumb)}), nil
+}
+
+// thumbnailExt names thumbnails, which are stored under their attachment's
+// ID apart from uploads so no file name can collide with one.
+func thumbnailExt(contentType string) string {
+	if contentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// AttachmentConfig returns the limits SendFiles enforces.
+func (s *ChatService) AttachmentConfig() AttachmentConfig {
+	return s.attachments
+}
+
+// withURLs signs a download URL for each attachment.
+func (s *ChatService) withURLs(ctx context.Context, msgs []*domain.Message) error {
+	expires := time.Now().Add(s.attachments.URLTTL)
+	for _, msg := range msgs {
+		if len(msg.Attachments) == 0 {
+			continue
+		}
+		// The repository may share the slice with its own copy
+		msg.Attachments = slices.Clone(msg.Attachments)
+		for i := range msg.Attachments {
+			a := &msg.Attachments[i]
+			url, err := s.blobs.SignedURL(ctx, a.Key, expires)
+			if err != nil {
+				return err
+			}
+			a.URL = url
+			if a.ThumbnailKey == "" {
+				continue
+			}
+			if a.ThumbnailURL, err = s.blobs.SignedURL(ctx, a.ThumbnailKey, expires); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropBlobs removes the content of attachments that are gone, failures only
+// leave orphaned blobs behind.
+func (s *ChatService) dropBlobs(ctx context.Context, attachments []domain.Attachment) {
+	for _, a := range attachments {
+		for _, key := range []string{a.Key, a.ThumbnailKey} {
+			if key == "" {
+				continue
+			}
+			if err := s.blobs.Delete(ctx, key); err != nil {
+				log.Error().Err(err).Str("key", key).Msg("Failed to delete attachment content")
+			}
+		}
+	}
+}
+
+func blobInfo(a domain.Attachment) port.BlobInfo {
+	disposition := "attachment"
+	if a.IsImage() {
+		disposition = "inline"
+	}
+	return port.BlobInfo{
+		Size:               a.Size,
+		ContentType:        a.ContentType,
+		ContentDisposition: mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}),
+	}
+}
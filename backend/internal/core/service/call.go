@@ -9,19 +9,25 @@ import (
 )
 
 type CallService struct {
-	media  port.MediaEngine
+	media   port.MediaEngine
+	rooms   port.RoomRepository
 	gateway port.RealTimeGateway
 }
 
-func NewCallService(media port.MediaEngine, gateway port.RealTimeGateway) *CallService {
+func NewCallService(media port.MediaEngine, rooms port.RoomRepository, gateway port.RealTimeGateway) *CallService {
 	s := &CallService{
 		media:   media,
+		rooms:   rooms,
 		gateway: gateway,
 	}
 	
 	media.SetSignalCallback(func(sessionID domain.SessionID, userID domain.UserID, signal domain.Signal) {
 		// TODO: context ?
-		if err := gateway.SendSignal(context.Background(), userID, signal); err != nil {
+		roomID, err := domain.NewRoomIDFromString(sessionID.String())
+		if err == nil {
+			err = gateway.SendSignal(context.Background(), roomID, userID, signal)
+		}
+		if err != nil {
 			log.Error().Err(err).
 				Str("sessionID", sessionID.String()).
 				Str("userID", userID.String()).
@@ -33,18 +39,31 @@ func NewCallService(media port.MediaEngine, gateway port.RealTimeGateway) *CallS
 }
 
 func (s *CallService) JoinCall(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	member, err := s.rooms.Member(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if err := member.Authorize(domain.PermJoinCall); err != nil {
+		return err
+	}
+
 	// map RoomID -> SesssionID //TODO: is it good?
 	sessionID := domain.SessionID(roomID.String())
 	
+	// Rejoining, e.g. from another connection, replaces the previous peer
+	s.media.RemovePeer(sessionID, userID)
 	offer, err := s.media.AddPeer(sessionID, userID)
 	if err != nil {
 		return err
 	}
 
-	return s.gateway.SendSignal(ctx, userID, offer)
+	return s.gateway.SendSignal(ctx, roomID, userID, offer)
 }
 
 func (s *CallService) HandleSignal(ctx context.Context, userID domain.UserID, roomID domain.RoomID, signal domain.Signal) error {
+	if _, err := s.rooms.Member(ctx, roomID, userID); err != nil {
+		return err
+	}
 	sessionID := domain.SessionID(roomID.String()) //TODO is it good ?
 	return s.media.HandleSignal(sessionID, userID, signal)
 }
@@ -54,3 +73,36 @@ func (s *CallService) LeaveCall(ctx context.Context, roomID domain.RoomID, userI
 	s.media.RemovePeer(sessionID, userID)
 	return nil
 }
+
+// Remove takes userID out of the call of roomID, if they are in it, and tells
+// them. Used when they lose their membership.
+func (s *CallService) Remove(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	sessionID := domain.SessionID(roomID.String())
+	if !s.media.RemovePeer(sessionID, userID) {
+		return nil
+	}
+	return s.gateway.EndCall(ctx, roomID, userID)
+}
+
+// Mute stops relaying target's audio to the call. Members may always mute
+// themselves; muting others takes PermMuteInCall and a higher role.
+func (s *CallService) Mute(ctx context.Context, actor domain.UserID, roomID domain.RoomID, target domain.UserID, muted bool) error {
+	room, err := s.rooms.Get(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	member, ok := room.Member(actor)
+	if !ok {
+		return domain.ErrNotMember
+	}
+	if actor != target {
+		if err := member.Authorize(domain.PermMuteInCall); err != nil {
+			return err
+		}
+		if _, err := outrank(room, member, domain.PermMuteInCall, target); err != nil {
+			return err
+		}
+	}
+	sessionID := domain.SessionID(roomID.String())
+	return s.media.SetMuted(sessionID, target, muted)
+}
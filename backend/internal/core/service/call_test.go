@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+func TestMute(t *testing.T) {
+	f := newFixture(t)
+	owner, admin, mod, member, outsider := f.user("owner"), f.user("admin"), f.user("mod"), f.user("member"), f.user("outsider")
+	roomID := f.roomOf(domain.RoomCall, owner, map[domain.UserID]domain.Role{
+		admin:  domain.RoleAdmin,
+		mod:    domain.RoleAdmin,
+		member: domain.RoleMember,
+	})
+	for _, userID := range []domain.UserID{owner, admin, mod, member} {
+		if err := f.calls.JoinCall(f.ctx, roomID, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.gateway.take()
+
+	tests := []struct {
+		name   string
+		actor  domain.UserID
+		target domain.UserID
+		want   error
+	}{
+		{"themselves", member, member, nil},
+		{"moderator over member", admin, member, nil},
+		{"owner over moderator", owner, admin, nil},
+		{"member over member", member, admin, domain.ErrForbidden},
+		{"moderator over moderator", admin, mod, domain.ErrForbidden},
+		{"moderator over owner", admin, owner, domain.ErrForbidden},
+		{"outsider over themselves", outsider, outsider, domain.ErrNotMember},
+		{"outsider over member", outsider, member, domain.ErrNotMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := f.calls.Mute(f.ctx, tt.actor, roomID, tt.target, true)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if muted := f.media.muted(roomID, tt.target); muted != (tt.want == nil) {
+				t.Fatalf("muted = %t after err %v", muted, err)
+			}
+			if err := f.calls.Mute(f.ctx, tt.target, roomID, tt.target, false); err != nil && tt.want == nil {
+				t.Fatalf("unmute: %v", err)
+			}
+		})
+	}
+}
@@ -2,31 +2,609 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/Wyydra/ya/backend/internal/core/domain"
 	"github.com/Wyydra/ya/backend/internal/core/port"
+	"github.com/rs/zerolog/log"
 )
 
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 200
+)
+
+// HistoryQuery selects a page of a room's history. At most one of Before,
+// After, AfterSeq or the From/To range should be set; with none set the
+// latest messages are returned.
+type HistoryQuery struct {
+	Before   *domain.MessageID
+	After    *domain.MessageID
+	AfterSeq *int64
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// SearchQuery selects messages across the caller's rooms. Text, SenderID or
+// both must be set.
+type SearchQuery struct {
+	Text     string
+	RoomID   *domain.RoomID
+	SenderID *domain.UserID
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// ThreadQuery selects a page of a thread's replies, those after AfterSeq.
+type ThreadQuery struct {
+	AfterSeq int64
+	Limit    int
+}
+
 type ChatService struct {
-	repo    port.MessageRepository
-	gateway port.RealTimeGateway
+	repo      port.MessageRepository
+	users     port.UserRepository
+	rooms     port.RoomRepository
+	markers   port.ReadMarkerRepository
+	reactions port.ReactionRepository
+	blobs     port.BlobStore
+	images    port.ImageProcessor
+	gateway   port.RealTimeGateway
+	typing    *typingTracker
+
+	attachments AttachmentConfig
 }
 
-func NewChatService(repo port.MessageRepository, gateway port.RealTimeGateway) *ChatService {
-	return &ChatService{
-		repo:    repo,
-		gateway: gateway,
+func NewChatService(repo port.MessageRepository, users port.UserRepository, rooms port.RoomRepository, markers port.ReadMarkerRepository, reactions port.ReactionRepository, blobs port.BlobStore, images port.ImageProcessor, gateway port.RealTimeGateway, attachments AttachmentConfig) *ChatService {
+	s := &ChatService{
+		repo:        repo,
+		users:       users,
+		rooms:       rooms,
+		markers:     markers,
+		reactions:   reactions,
+		blobs:       blobs,
+		images:      images,
+		gateway:     gateway,
+		attachments: attachments,
 	}
+	s.typing = newTypingTracker(func(t domain.Typing) {
+		if err := gateway.SendTyping(context.Background(), t); err != nil {
+			log.Error().Err(err).Str("room_id", t.RoomID.String()).Msg("Failed to expire typing indicator")
+		}
+	})
+	return s
 }
 
-func (s *ChatService) SendMessage(ctx context.Context, senderID domain.UserID, roomID domain.RoomID, content string) error {
+// SendMessage stores a message and delivers it to the room. Direct messages
+// reach the two participants only.
+func (s *ChatService) SendMessage(ctx context.Context, senderID domain.UserID, roomID domain.RoomID, content string) (domain.Message, error) {
+	room, err := s.author(ctx, senderID, roomID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+
 	msg, err := domain.NewMessage(senderID, roomID, content)
 	if err != nil {
+		return domain.Message{}, err
+	}
+	return s.post(ctx, room, msg)
+}
+
+// Reply answers parentID in its thread. The reply reaches the room like any
+// message and the followers of the thread, which the sender joins. The root,
+// with its new reply count, is delivered as an update.
+func (s *ChatService) Reply(ctx context.Context, senderID domain.UserID, roomID domain.RoomID, parentID domain.MessageID, content string) (domain.Message, error) {
+	room, err := s.author(ctx, senderID, roomID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	parent, err := s.repo.Get(ctx, roomID, parentID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+
+	msg, err := domain.NewReply(senderID, parent, content)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	return s.postReply(ctx, room, msg)
+}
+
+// author returns the room senderID posts a new message in, checking they
+// may.
+func (s *ChatService) author(ctx context.Context, senderID domain.UserID, roomID domain.RoomID) (domain.Room, error) {
+	room, member, err := s.member(ctx, senderID, roomID)
+	if err != nil {
+		return room, err
+	}
+	if err := member.Authorize(domain.PermSendMessage); err != nil {
+		return room, err
+	}
+	if !room.Chat() {
+		return room, domain.ErrCallRoom
+	}
+	return room, nil
+}
+
+// postReply posts msg like post, then has its sender follow the thread and
+// updates the root.
+func (s *ChatService) postReply(ctx context.Context, room domain.Room, msg *domain.Message) (domain.Message, error) {
+	sent, err := s.post(ctx, room, msg)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if err := s.gateway.FollowThread(ctx, room.ID, *msg.ParentID, msg.SenderID); err != nil {
+		return domain.Message{}, err
+	}
+	root, err := s.repo.Get(ctx, room.ID, *msg.ParentID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if _, err := s.update(ctx, room, root); err != nil {
+		return domain.Message{}, err
+	}
+	return sent, nil
+}
+
+// post saves a new message and delivers it.
+func (s *ChatService) post(ctx context.Context, room domain.Room, msg *domain.Message) (domain.Message, error) {
+	if err := s.repo.Save(ctx, msg); err != nil {
+		return domain.Message{}, err
+	}
+	// Clients clear the sender's indicator when the message arrives
+	s.typing.stop(typingKey{room.ID, msg.SenderID})
+	// Senders have read their own message
+	if _, err := s.markers.Advance(ctx, domain.NewReadMarker(msg.SenderID, *msg)); err != nil {
+		return domain.Message{}, err
+	}
+	if err := s.withSenders(ctx, []*domain.Message{msg}); err != nil {
+		return domain.Message{}, err
+	}
+	if err := s.withURLs(ctx, []*domain.Message{msg}); err != nil {
+		return domain.Message{}, err
+	}
+	var err error
+	if room.Kind == domain.RoomDirect {
+		err = s.gateway.SendMessage(ctx, room.MemberIDs(), *msg)
+	} else {
+		err = s.gateway.BroadcastMessage(ctx, *msg)
+	}
+	return *msg, err
+}
+
+// EditMessage replaces the content of one of actor's messages, keeping the
+// previous content as a revision.
+func (s *ChatService) EditMessage(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID, content string) (domain.Message, error) {
+	room, member, err := s.member(ctx, actor, roomID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if err := member.Authorize(domain.PermSendMessage); err != nil {
+		return domain.Message{}, err
+	}
+	msg, err := s.repo.Get(ctx, roomID, messageID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if msg.SenderID != actor {
+		return domain.Message{}, domain.ErrNotAuthor
+	}
+	rev, err := msg.Edit(content)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if err := s.repo.Edit(ctx, msg, rev); err != nil {
+		return domain.Message{}, err
+	}
+	return s.update(ctx, room, msg)
+}
+
+// DeleteMessage turns a message into a tombstone. Authors may delete their
+// own messages, members allowed to PermDeleteMessage those of members they
+// outrank. Deleting twice is not an error.
+func (s *ChatService) DeleteMessage(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID) (domain.Message, error) {
+	room, member, err := s.member(ctx, actor, roomID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	msg, err := s.repo.Get(ctx, roomID, messageID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if msg.Deleted() {
+		return msg, nil
+	}
+	if msg.SenderID != actor {
+		if err := member.Authorize(domain.PermDeleteMessage); err != nil {
+			return domain.Message{}, err
+		}
+		// Authors who left the room no longer outrank anyone
+		if author, ok := room.Member(msg.SenderID); ok && !member.Role.Outranks(author.Role) {
+			return domain.Message{}, &domain.PermissionError{Permission: domain.PermDeleteMessage, Role: member.Role, Over: author.Role}
+		}
+	}
+	attachments := msg.Attachments
+	msg.Delete(actor)
+	if err := s.repo.Delete(ctx, msg); err != nil {
+		return domain.Message{}, err
+	}
+	s.dropBlobs(ctx, attachments)
+	return s.update(ctx, room, msg)
+}
+
+// Revisions returns the previous contents of a message, oldest first.
+func (s *ChatService) Revisions(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID) ([]domain.MessageRevision, error) {
+	if _, err := s.rooms.Member(ctx, roomID, actor); err != nil {
+		return nil, err
+	}
+	return s.repo.Revisions(ctx, roomID, messageID)
+}
+
+// React adds actor's emoji reaction to a message and returns the message
+// with its reactions. Reacting twice with the same emoji changes nothing.
+func (s *ChatService) React(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID, emoji string) (domain.Message, error) {
+	member, err := s.rooms.Member(ctx, roomID, actor)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if err := member.Authorize(domain.PermReact); err != nil {
+		return domain.Message{}, err
+	}
+	msg, err := s.repo.Get(ctx, roomID, messageID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	reaction, err := domain.NewReaction(actor, msg, emoji)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	added, err := s.reactions.Add(ctx, reaction)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if added {
+		change := domain.ReactionChange{Reaction: reaction, Added: true, ThreadID: msg.ThreadID()}
+		if err := s.gateway.SendReaction(ctx, change); err != nil {
+			return domain.Message{}, err
+		}
+	}
+	return msg, s.withDetails(ctx, []*domain.Message{&msg})
+}
+
+// Unreact removes one of actor's reactions. Removing a missing reaction is
+// not an error.
+func (s *ChatService) Unreact(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID, emoji string) (domain.Message, error) {
+	member, err := s.rooms.Member(ctx, roomID, actor)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if err := member.Authorize(domain.PermReact); err != nil {
+		return domain.Message{}, err
+	}
+	if err := domain.ValidateEmoji(emoji); err != nil {
+		return domain.Message{}, err
+	}
+	msg, err := s.repo.Get(ctx, roomID, messageID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	removed, err := s.reactions.Remove(ctx, messageID, actor, emoji)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if removed {
+		change := domain.ReactionChange{
+			Reaction: domain.Reaction{MessageID: messageID, RoomID: roomID, UserID: actor, Emoji: emoji, CreatedAt: time.Now().UTC()},
+			ThreadID: msg.ThreadID(),
+		}
+		if err := s.gateway.SendReaction(ctx, change); err != nil {
+			return domain.Message{}, err
+		}
+	}
+	return msg, s.withDetails(ctx, []*domain.Message{&msg})
+}
+
+// update delivers a changed message to whoever received the original.
+func (s *ChatService) update(ctx context.Context, room domain.Room, msg domain.Message) (domain.Message, error) {
+	if err := s.withDetails(ctx, []*domain.Message{&msg}); err != nil {
+		return domain.Message{}, err
+	}
+	var err error
+	if room.Kind == domain.RoomDirect {
+		err = s.gateway.SendUpdate(ctx, room.MemberIDs(), msg)
+	} else {
+		err = s.gateway.BroadcastUpdate(ctx, msg)
+	}
+	return msg, err
+}
+
+// member loads a room and actor's membership of it.
+func (s *ChatService) member(ctx context.Context, actor domain.UserID, roomID domain.RoomID) (domain.Room, domain.Member, error) {
+	room, err := s.rooms.Get(ctx, roomID)
+	if err != nil {
+		return domain.Room{}, domain.Member{}, err
+	}
+	member, ok := room.Member(actor)
+	if !ok {
+		return domain.Room{}, domain.Member{}, domain.ErrNotMember
+	}
+	return room, member, nil
+}
+
+// Thread returns the root of the thread messageID belongs to and a page of
+// its replies, oldest first.
+func (s *ChatService) Thread(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID, q ThreadQuery) (domain.Message, []domain.Message, error) {
+	if _, err := s.rooms.Member(ctx, roomID, actor); err != nil {
+		return domain.Message{}, nil, err
+	}
+	root, err := s.root(ctx, roomID, messageID)
+	if err != nil {
+		return domain.Message{}, nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	limit = min(limit, MaxHistoryLimit)
+
+	replies, err := s.repo.Thread(ctx, roomID, root.ID, q.AfterSeq, limit)
+	if err != nil {
+		return domain.Message{}, nil, err
+	}
+	ptrs := make([]*domain.Message, 0, len(replies)+1)
+	ptrs = append(ptrs, &root)
+	for i := range replies {
+		ptrs = append(ptrs, &replies[i])
+	}
+	return root, replies, s.withDetails(ctx, ptrs)
+}
+
+// FollowThread subscribes actor's connections to the thread messageID
+// belongs to and returns its root.
+func (s *ChatService) FollowThread(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID) (domain.Message, error) {
+	if _, err := s.rooms.Member(ctx, roomID, actor); err != nil {
+		return domain.Message{}, err
+	}
+	root, err := s.root(ctx, roomID, messageID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if err := s.gateway.FollowThread(ctx, roomID, root.ID, actor); err != nil {
+		return domain.Message{}, err
+	}
+	return root, s.withDetails(ctx, []*domain.Message{&root})
+}
+
+// UnfollowThread undoes FollowThread and returns the ID of the thread's root.
+func (s *ChatService) UnfollowThread(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID) (domain.MessageID, error) {
+	if _, err := s.rooms.Member(ctx, roomID, actor); err != nil {
+		return domain.MessageID{}, err
+	}
+	root, err := s.root(ctx, roomID, messageID)
+	if err != nil {
+		return domain.MessageID{}, err
+	}
+	return root.ID, s.gateway.UnfollowThread(ctx, root.ID, actor)
+}
+
+// root returns the root of the thread messageID belongs to.
+func (s *ChatService) root(ctx context.Context, roomID domain.RoomID, messageID domain.MessageID) (domain.Message, error) {
+	msg, err := s.repo.Get(ctx, roomID, messageID)
+	if err != nil || msg.ParentID == nil {
+		return msg, err
+	}
+	return s.repo.Get(ctx, roomID, *msg.ParentID)
+}
+
+// MarkRead moves actor's read marker in a room forward to messageID and
+// tells the room. Marking an older message read changes nothing.
+func (s *ChatService) MarkRead(ctx context.Context, actor domain.UserID, roomID domain.RoomID, messageID domain.MessageID) error {
+	if _, err := s.rooms.Member(ctx, roomID, actor); err != nil {
+		return err
+	}
+	msg, err := s.repo.Get(ctx, roomID, messageID)
+	if err != nil {
+		return err
+	}
+	marker := domain.NewReadMarker(actor, msg)
+	moved, err := s.markers.Advance(ctx, marker)
+	if err != nil || !moved {
+		return err
+	}
+	return s.gateway.SendReceipt(ctx, marker)
+}
+
+// Receipts returns how far each member has read in a room.
+func (s *ChatService) Receipts(ctx context.Context, actor domain.UserID, roomID domain.RoomID) ([]domain.ReadMarker, error) {
+	if _, err := s.rooms.Member(ctx, roomID, actor); err != nil {
+		return nil, err
+	}
+	return s.markers.ForRoom(ctx, roomID)
+}
+
+// UnreadCounts returns the number of messages actor has not read in each of
+// the rooms. Rooms without unread messages are left out.
+func (s *ChatService) UnreadCounts(ctx context.Context, actor domain.UserID, roomIDs []domain.RoomID) (map[domain.RoomID]int64, error) {
+	last, err := s.repo.LastSeqs(ctx, roomIDs)
+	if err != nil {
+		return nil, err
+	}
+	markers, err := s.markers.ForUser(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	unread := make(map[domain.RoomID]int64, len(last))
+	for roomID, seq := range last {
+		if n := seq - markers[roomID].Seq; n > 0 {
+			unread[roomID] = n
+		}
+	}
+	return unread, nil
+}
+
+// SetTyping starts or stops actor's typing indicator in a room. Starts are
+// throttled and indicators expire after TypingTimeout without update.
+func (s *ChatService) SetTyping(ctx context.Context, actor domain.UserID, roomID domain.RoomID, typing bool) error {
+	if _, err := s.author(ctx, actor, roomID); err != nil {
+		return err
+	}
+
+	key := typingKey{roomID, actor}
+	var notify bool
+	if typing {
+		notify = s.typing.start(key)
+	} else {
+		notify = s.typing.stop(key)
+	}
+	if !notify {
+		return nil
+	}
+	return s.gateway.SendTyping(ctx, domain.NewTyping(roomID, actor, typing))
+}
+
+func (s *ChatService) History(ctx context.Context, userID domain.UserID, roomID domain.RoomID, q HistoryQuery) ([]domain.Message, error) {
+	if _, err := s.rooms.Member(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	limit = min(limit, MaxHistoryLimit)
+
+	var (
+		msgs []domain.Message
+		err  error
+	)
+	switch {
+	case q.Before != nil:
+		msgs, err = s.repo.Before(ctx, roomID, *q.Before, limit)
+	case q.After != nil:
+		msgs, err = s.repo.After(ctx, roomID, *q.After, limit)
+	case q.AfterSeq != nil:
+		msgs, err = s.repo.Since(ctx, roomID, *q.AfterSeq, limit)
+	case !q.From.IsZero() || !q.To.IsZero():
+		to := q.To
+		if to.IsZero() {
+			to = time.Now().UTC()
+		}
+		msgs, err = s.repo.Between(ctx, roomID, q.From, to, limit)
+	default:
+		msgs, err = s.repo.Latest(ctx, roomID, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ptrs := make([]*domain.Message, len(msgs))
+	for i := range msgs {
+		ptrs[i] = &msgs[i]
+	}
+	return msgs, s.withDetails(ctx, ptrs)
+}
+
+// Search finds messages by content, sender, room and creation time in the
+// rooms actor belongs to, newest first.
+func (s *ChatService) Search(ctx context.Context, actor domain.UserID, q SearchQuery) ([]domain.Message, error) {
+	terms := domain.SearchTerms(q.Text)
+	if q.Text == "" && q.SenderID == nil {
+		return nil, domain.ErrEmptySearch
+	}
+	// Text made of separators only matches nothing
+	if q.Text != "" && len(terms) == 0 {
+		return []domain.Message{}, nil
+	}
+
+	var roomIDs []domain.RoomID
+	if q.RoomID != nil {
+		if _, err := s.rooms.Member(ctx, *q.RoomID, actor); err != nil {
+			return nil, err
+		}
+		roomIDs = []domain.RoomID{*q.RoomID}
+	} else {
+		rooms, err := s.rooms.ListForUser(ctx, actor)
+		if err != nil {
+			return nil, err
+		}
+		for _, room := range rooms {
+			roomIDs = append(roomIDs, room.ID)
+		}
+	}
+	if len(roomIDs) == 0 {
+		return []domain.Message{}, nil
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	limit = min(limit, MaxHistoryLimit)
+
+	msgs, err := s.repo.Search(ctx, port.MessageSearch{
+		Terms:    terms,
+		RoomIDs:  roomIDs,
+		SenderID: q.SenderID,
+		From:     q.From,
+		To:       q.To,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ptrs := make([]*domain.Message, len(msgs))
+	for i := range msgs {
+		ptrs[i] = &msgs[i]
+	}
+	return msgs, s.withDetails(ctx, ptrs)
+}
+
+// withDetails fills in what is not stored with the messages themselves.
+func (s *ChatService) withDetails(ctx context.Context, msgs []*domain.Message) error {
+	if err := s.withSenders(ctx, msgs); err != nil {
+		return err
+	}
+	if err := s.withURLs(ctx, msgs); err != nil {
 		return err
 	}
+	return s.withReactions(ctx, msgs)
+}
 
-	if err := s.repo.Save(ctx, *msg); err != nil {
+// withReactions attaches the reactions to each message but tombstones.
+func (s *ChatService) withReactions(ctx context.Context, msgs []*domain.Message) error {
+	ids := make([]domain.MessageID, 0, len(msgs))
+	for _, msg := range msgs {
+		if !msg.Deleted() {
+			ids = append(ids, msg.ID)
+		}
+	}
+	reactions, err := s.reactions.ForMessages(ctx, ids)
+	if err != nil {
 		return err
 	}
-	return s.gateway.BroadcastMessage(ctx, *msg)
+	for _, msg := range msgs {
+		msg.Reactions = domain.SummarizeReactions(reactions[msg.ID])
+	}
+	return nil
+}
+
+// withSenders attaches the author's profile to each message.
+func (s *ChatService) withSenders(ctx context.Context, msgs []*domain.Message) error {
+	ids := make([]domain.UserID, 0, len(msgs))
+	for _, msg := range msgs {
+		ids = append(ids, msg.SenderID)
+	}
+	users, err := s.users.GetMany(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if user, ok := users[msg.SenderID]; ok {
+			msg.Sender = &user
+		}
+	}
+	return nil
 }
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+func TestDeleteMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		actor  domain.Role
+		author domain.Role
+		// left has the author leave the room before the deletion
+		left    bool
+		allowed bool
+	}{
+		{"own message", domain.RoleMember, "", false, true},
+		{"moderator over member", domain.RoleAdmin, domain.RoleMember, false, true},
+		{"moderator over a former member", domain.RoleAdmin, domain.RoleMember, true, true},
+		{"owner over moderator", domain.RoleOwner, domain.RoleAdmin, false, true},
+		{"moderator over moderator", domain.RoleAdmin, domain.RoleAdmin, false, false},
+		{"moderator over owner", domain.RoleAdmin, domain.RoleOwner, false, false},
+		{"member over member", domain.RoleMember, domain.RoleMember, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			owner, actor, author := f.user("owner"), f.user("actor"), f.user("author")
+			members := map[domain.UserID]domain.Role{}
+			switch {
+			case tt.author == "":
+				author = actor
+				members[actor] = tt.actor
+			case tt.actor == domain.RoleOwner:
+				actor = owner
+				members[author] = tt.author
+			case tt.author == domain.RoleOwner:
+				author = owner
+				members[actor] = tt.actor
+			default:
+				members[actor] = tt.actor
+				members[author] = tt.author
+			}
+			roomID := f.roomOf(domain.RoomGroup, owner, members)
+			msg := f.send(author, roomID, "hello")
+			if tt.left {
+				if err := f.room.Leave(f.ctx, author, roomID); err != nil {
+					t.Fatal(err)
+				}
+				f.gateway.take()
+			}
+
+			deleted, err := f.chat.DeleteMessage(f.ctx, actor, roomID, msg.ID)
+			stored, getErr := f.msgs.Get(f.ctx, roomID, msg.ID)
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+			if !tt.allowed {
+				if !errors.Is(err, domain.ErrForbidden) {
+					t.Fatalf("err = %v, want ErrForbidden", err)
+				}
+				f.expectEvents()
+				if stored.Deleted() {
+					t.Fatal("refused deletion deleted the message")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !deleted.Deleted() || deleted.DeletedBy != actor || !stored.Deleted() {
+				t.Fatalf("deleted = %+v, stored = %+v", deleted, stored)
+			}
+			f.expectEvents(`update ""`)
+
+			// Deleting again changes nothing
+			if _, err := f.chat.DeleteMessage(f.ctx, actor, roomID, msg.ID); err != nil {
+				t.Fatalf("second delete: %v", err)
+			}
+			f.expectEvents()
+		})
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	f := newFixture(t)
+	owner, bob := f.user("owner"), f.user("bob")
+	roomID := f.roomOf(domain.RoomGroup, owner, map[domain.UserID]domain.Role{bob: domain.RoleMember})
+	msg := f.send(bob, roomID, "first")
+
+	edited, err := f.chat.EditMessage(f.ctx, bob, roomID, msg.ID, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Content != "second" || edited.EditedAt.IsZero() {
+		t.Fatalf("edited = %+v", edited)
+	}
+	f.expectEvents(`update "second"`)
+
+	if _, err := f.chat.EditMessage(f.ctx, owner, roomID, msg.ID, "hijacked"); !errors.Is(err, domain.ErrNotAuthor) {
+		t.Fatalf("edit by another member: err = %v, want ErrNotAuthor", err)
+	}
+	if _, err := f.chat.DeleteMessage(f.ctx, bob, roomID, msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	f.gateway.take()
+	if _, err := f.chat.EditMessage(f.ctx, bob, roomID, msg.ID, "third"); !errors.Is(err, domain.ErrMessageDeleted) {
+		t.Fatalf("edit of a deleted message: err = %v, want ErrMessageDeleted", err)
+	}
+	f.expectEvents()
+	stored, err := f.msgs.Get(f.ctx, roomID, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Content != "" {
+		t.Fatalf("deleted message content = %q, want it gone", stored.Content)
+	}
+}
+
+func TestUnreadCounts(t *testing.T) {
+	f := newFixture(t)
+	alice, bob, carol := f.user("alice"), f.user("bob"), f.user("carol")
+	busy := f.roomOf(domain.RoomGroup, alice, map[domain.UserID]domain.Role{bob: domain.RoleMember})
+	read := f.roomOf(domain.RoomGroup, alice, map[domain.UserID]domain.Role{bob: domain.RoleMember})
+	quiet := f.roomOf(domain.RoomGroup, alice, map[domain.UserID]domain.Role{bob: domain.RoleMember})
+
+	first := f.send(alice, busy, "one")
+	f.send(alice, busy, "two")
+	f.send(alice, busy, "three")
+	last := f.send(alice, read, "seen")
+
+	if err := f.chat.MarkRead(f.ctx, bob, busy, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvents("receipt bob 1")
+	if err := f.chat.MarkRead(f.ctx, bob, read, last.ID); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvents("receipt bob 1")
+
+	rooms := []domain.RoomID{busy, read, quiet}
+	tests := []struct {
+		name string
+		user domain.UserID
+		want map[domain.RoomID]int64
+	}{
+		{"reader", bob, map[domain.RoomID]int64{busy: 2}},
+		{"sender", alice, map[domain.RoomID]int64{}},
+		{"without markers", carol, map[domain.RoomID]int64{busy: 3, read: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.chat.UnreadCounts(f.ctx, tt.user, rooms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("unread = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("marking an older message", func(t *testing.T) {
+		if err := f.chat.MarkRead(f.ctx, alice, busy, first.ID); err != nil {
+			t.Fatal(err)
+		}
+		f.expectEvents()
+	})
+	t.Run("marking as an outsider", func(t *testing.T) {
+		if err := f.chat.MarkRead(f.ctx, carol, busy, first.ID); !errors.Is(err, domain.ErrNotMember) {
+			t.Fatalf("err = %v, want ErrNotMember", err)
+		}
+		f.expectEvents()
+	})
+}
+
+func TestFollowThread(t *testing.T) {
+	f := newFixture(t)
+	alice, bob, carol := f.user("alice"), f.user("bob"), f.user("carol")
+	roomID := f.roomOf(domain.RoomGroup, alice, map[domain.UserID]domain.Role{bob: domain.RoleMember})
+	root := f.send(alice, roomID, "root")
+	reply, err := f.chat.Reply(f.ctx, alice, roomID, root.ID, "reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.gateway.take()
+
+	// Following through a reply follows its root
+	got, err := f.chat.FollowThread(f.ctx, bob, roomID, reply.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != root.ID || got.ReplyCount != 1 {
+		t.Fatalf("followed %+v, want the root with one reply", got)
+	}
+	f.expectEvents("follow bob")
+
+	rootID, err := f.chat.UnfollowThread(f.ctx, bob, roomID, reply.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootID != root.ID {
+		t.Fatalf("unfollowed %v, want the root %v", rootID, root.ID)
+	}
+	f.expectEvents("unfollow bob")
+
+	if _, err := f.chat.FollowThread(f.ctx, carol, roomID, root.ID); !errors.Is(err, domain.ErrNotMember) {
+		t.Fatalf("follow as outsider: err = %v, want ErrNotMember", err)
+	}
+	if _, err := f.chat.UnfollowThread(f.ctx, carol, roomID, root.ID); !errors.Is(err, domain.ErrNotMember) {
+		t.Fatalf("unfollow as outsider: err = %v, want ErrNotMember", err)
+	}
+	if _, err := f.chat.FollowThread(f.ctx, bob, roomID, domain.NewMessageID()); !errors.Is(err, domain.ErrMessageNotFound) {
+		t.Fatalf("follow unknown message: err = %v, want ErrMessageNotFound", err)
+	}
+	f.expectEvents()
+}
+
+func TestReactions(t *testing.T) {
+	f := newFixture(t)
+	alice, bob, guest, carol := f.user("alice"), f.user("bob"), f.user("guest"), f.user("carol")
+	roomID := f.roomOf(domain.RoomGroup, alice, map[domain.UserID]domain.Role{
+		bob:   domain.RoleMember,
+		guest: domain.RoleGuest,
+	})
+	msg := f.send(alice, roomID, "hello")
+
+	react := func(emoji string) domain.Message {
+		t.Helper()
+		got, err := f.chat.React(f.ctx, bob, roomID, msg.ID, emoji)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	unreact := func(emoji string) domain.Message {
+		t.Helper()
+		got, err := f.chat.Unreact(f.ctx, bob, roomID, msg.ID, emoji)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := react("👍"); len(got.Reactions) != 1 {
+		t.Fatalf("reactions = %+v, want one", got.Reactions)
+	}
+	f.expectEvents("react bob 👍")
+	if got := react("👍"); len(got.Reactions) != 1 {
+		t.Fatalf("reacting twice: reactions = %+v, want one", got.Reactions)
+	}
+	f.expectEvents()
+
+	if got := unreact("👍"); len(got.Reactions) != 0 {
+		t.Fatalf("reactions = %+v, want none", got.Reactions)
+	}
+	f.expectEvents("unreact bob 👍")
+	unreact("👍")
+	f.expectEvents()
+
+	tests := []struct {
+		name  string
+		actor domain.UserID
+		want  error
+	}{
+		{"guest", guest, domain.ErrForbidden},
+		{"outsider", carol, domain.ErrNotMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := f.chat.React(f.ctx, tt.actor, roomID, msg.ID, "🎉"); !errors.Is(err, tt.want) {
+				t.Fatalf("react: err = %v, want %v", err, tt.want)
+			}
+			if _, err := f.chat.Unreact(f.ctx, tt.actor, roomID, msg.ID, "🎉"); !errors.Is(err, tt.want) {
+				t.Fatalf("unreact: err = %v, want %v", err, tt.want)
+			}
+			f.expectEvents()
+		})
+	}
+}
+
+func TestSetTyping(t *testing.T) {
+	f := newFixture(t)
+	alice, bob, guest := f.user("alice"), f.user("bob"), f.user("guest")
+	roomID := f.roomOf(domain.RoomGroup, alice, map[domain.UserID]domain.Role{
+		bob:   domain.RoleMember,
+		guest: domain.RoleGuest,
+	})
+	callRoom := f.roomOf(domain.RoomCall, alice, nil)
+
+	typing := func(on bool) {
+		t.Helper()
+		if err := f.chat.SetTyping(f.ctx, bob, roomID, on); err != nil {
+			t.Fatal(err)
+		}
+	}
+	typing(true)
+	f.expectEvents("typing bob true")
+	// Within the throttle only the expiry moves
+	typing(true)
+	f.expectEvents()
+	typing(false)
+	f.expectEvents("typing bob false")
+	typing(false)
+	f.expectEvents()
+
+	// Posting clears the indicator without an event
+	typing(true)
+	f.gateway.take()
+	if _, err := f.chat.SendMessage(f.ctx, bob, roomID, "done"); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvents("message done")
+	typing(false)
+	f.expectEvents()
+
+	tests := []struct {
+		name   string
+		actor  domain.UserID
+		roomID domain.RoomID
+		want   error
+	}{
+		{"guest", guest, roomID, domain.ErrForbidden},
+		{"outsider", bob, callRoom, domain.ErrNotMember},
+		{"call room", alice, callRoom, domain.ErrCallRoom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := f.chat.SetTyping(f.ctx, tt.actor, tt.roomID, true); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			f.expectEvents()
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+)
+
+type RoomService struct {
+	rooms   port.RoomRepository
+	users   port.UserRepository
+	gateway port.RealTimeGateway
+	calls   *CallService
+}
+
+func NewRoomService(rooms port.RoomRepository, users port.UserRepository, gateway port.RealTimeGateway, calls *CallService) *RoomService {
+	return &RoomService{
+		rooms:   rooms,
+		users:   users,
+		gateway: gateway,
+		calls:   calls,
+	}
+}
+
+// Create opens a group or call room owned by actor. Direct rooms are only
+// made through OpenDirect.
+func (s *RoomService) Create(ctx context.Context, actor domain.UserID, name, topic string, kind domain.RoomKind) (domain.Room, error) {
+	if kind == domain.RoomDirect {
+		return domain.Room{}, domain.ErrInvalidRoomKind
+	}
+	room, err := domain.NewRoom(name, topic, kind, actor)
+	if err != nil {
+		return domain.Room{}, err
+	}
+	if err := s.rooms.Create(ctx, *room); err != nil {
+		return domain.Room{}, err
+	}
+	if err := s.gateway.JoinRoom(ctx, room.ID, actor); err != nil {
+		return domain.Room{}, err
+	}
+	return *room, nil
+}
+
+// OpenDirect returns the direct room of actor and peer, creating it on first
+// use. Both users end up subscribed to it.
+func (s *RoomService) OpenDirect(ctx context.Context, actor, peer domain.UserID) (domain.Room, error) {
+	roomID := domain.DirectRoomID(actor, peer)
+	room, err := s.rooms.Get(ctx, roomID)
+	if errors.Is(err, domain.ErrRoomNotFound) {
+		room, err = s.createDirect(ctx, actor, peer)
+	}
+	if err != nil {
+		return domain.Room{}, err
+	}
+	for _, userID := range room.MemberIDs() {
+		if err := s.gateway.JoinRoom(ctx, roomID, userID); err != nil {
+			return domain.Room{}, err
+		}
+	}
+	return room, nil
+}
+
+func (s *RoomService) createDirect(ctx context.Context, actor, peer domain.UserID) (domain.Room, error) {
+	if _, err := s.users.Get(ctx, peer); err != nil {
+		return domain.Room{}, err
+	}
+	room, err := domain.NewDirectRoom(actor, peer)
+	if err != nil {
+		return domain.Room{}, err
+	}
+	err = s.rooms.Create(ctx, *room)
+	if errors.Is(err, domain.ErrRoomExists) {
+		// Lost the race against the peer opening the same room
+		return s.rooms.Get(ctx, room.ID)
+	}
+	if err != nil {
+		return domain.Room{}, err
+	}
+	return *room, nil
+}
+
+func (s *RoomService) List(ctx context.Context, actor domain.UserID) ([]domain.Room, error) {
+	return s.rooms.ListForUser(ctx, actor)
+}
+
+// Get returns a room to one of its members.
+func (s *RoomService) Get(ctx context.Context, actor domain.UserID, roomID domain.RoomID) (domain.Room, error) {
+	room, err := s.rooms.Get(ctx, roomID)
+	if err != nil {
+		return domain.Room{}, err
+	}
+	if _, ok := room.Member(actor); !ok {
+		return domain.Room{}, domain.ErrNotMember
+	}
+	return room, nil
+}
+
+// Join makes actor a member of an open room and subscribes its connections.
+// Joining a room actor already belongs to only resubscribes.
+func (s *RoomService) Join(ctx context.Context, actor domain.UserID, roomID domain.RoomID) (domain.Room, error) {
+	room, err := s.rooms.Get(ctx, roomID)
+	if err != nil {
+		return domain.Room{}, err
+	}
+	_, joined := room.Member(actor)
+	if !joined {
+		if !room.Open() {
+			return domain.Room{}, domain.ErrRoomClosed
+		}
+		if err := s.checkBan(ctx, roomID, actor); err != nil {
+			return domain.Room{}, err
+		}
+		member := domain.NewMember(actor, domain.RoleMember)
+		if err := s.rooms.AddMember(ctx, roomID, member); err != nil && !errors.Is(err, domain.ErrAlreadyMember) {
+			return domain.Room{}, err
+		}
+		room.Members = append(room.Members, member)
+	}
+	if !joined {
+		if err := s.gateway.NotifyUserJoined(ctx, roomID, actor); err != nil {
+			return domain.Room{}, err
+		}
+	}
+	if err := s.gateway.JoinRoom(ctx, roomID, actor); err != nil {
+		return domain.Room{}, err
+	}
+	return room, nil
+}
+
+func (s *RoomService) Leave(ctx context.Context, actor domain.UserID, roomID domain.RoomID) error {
+	room, err := s.Get(ctx, actor, roomID)
+	if err != nil {
+		return err
+	}
+	if room.Kind == domain.RoomDirect {
+		return domain.ErrDirectRoom
+	}
+	if err := s.rooms.RemoveMember(ctx, roomID, actor); err != nil {
+		return err
+	}
+	return s.unsubscribe(ctx, roomID, actor)
+}
+
+// Invite adds invitee to a room actor belongs to. The invitee's connected
+// clients start receiving the room right away.
+func (s *RoomService) Invite(ctx context.Context, actor domain.UserID, roomID domain.RoomID, invitee domain.UserID) error {
+	if _, err := s.users.Get(ctx, invitee); err != nil {
+		return err
+	}
+	room, _, err := s.authorize(ctx, actor, roomID, domain.PermInvite)
+	if err != nil {
+		return err
+	}
+	if room.Kind == domain.RoomDirect {
+		return domain.ErrDirectRoom
+	}
+	if _, ok := room.Member(invitee); ok {
+		return domain.ErrAlreadyMember
+	}
+	if err := s.checkBan(ctx, roomID, invitee); err != nil {
+		return err
+	}
+	if err := s.rooms.AddMember(ctx, roomID, domain.NewMember(invitee, domain.RoleMember)); err != nil {
+		return err
+	}
+	if err := s.gateway.NotifyUserJoined(ctx, roomID, invitee); err != nil {
+		return err
+	}
+	return s.gateway.JoinRoom(ctx, roomID, invitee)
+}
+
+// Kick removes target from the room. They may join again unless banned.
+func (s *RoomService) Kick(ctx context.Context, actor domain.UserID, roomID domain.RoomID, target domain.UserID) error {
+	if _, err := s.authorizeOver(ctx, actor, roomID, domain.PermKick, target); err != nil {
+		return err
+	}
+	if err := s.rooms.RemoveMember(ctx, roomID, target); err != nil {
+		return err
+	}
+	return s.evict(ctx, roomID, target)
+}
+
+// Ban removes target from the room and keeps them out. Users who are not
+// members can be banned too, as long as they do not outrank actor.
+func (s *RoomService) Ban(ctx context.Context, actor domain.UserID, roomID domain.RoomID, target domain.UserID) error {
+	room, member, err := s.authorize(ctx, actor, roomID, domain.PermBan)
+	if err != nil {
+		return err
+	}
+	_, err = outrank(room, member, domain.PermBan, target)
+	wasMember := !errors.Is(err, domain.ErrNotMember)
+	if err != nil && wasMember {
+		return err
+	}
+	if err := s.rooms.AddBan(ctx, domain.NewBan(roomID, target, actor)); err != nil {
+		return err
+	}
+	if !wasMember {
+		return s.gateway.LeaveRoom(ctx, roomID, target)
+	}
+	return s.evict(ctx, roomID, target)
+}
+
+func (s *RoomService) Unban(ctx context.Context, actor domain.UserID, roomID domain.RoomID, target domain.UserID) error {
+	if _, _, err := s.authorize(ctx, actor, roomID, domain.PermBan); err != nil {
+		return err
+	}
+	return s.rooms.RemoveBan(ctx, roomID, target)
+}
+
+func (s *RoomService) SetTopic(ctx context.Context, actor domain.UserID, roomID domain.RoomID, topic string) (domain.Room, error) {
+	room, _, err := s.authorize(ctx, actor, roomID, domain.PermChangeTopic)
+	if err != nil {
+		return domain.Room{}, err
+	}
+	if err := domain.ValidateTopic(topic); err != nil {
+		return domain.Room{}, err
+	}
+	room.Topic = topic
+	if err := s.rooms.Update(ctx, room); err != nil {
+		return domain.Room{}, err
+	}
+	return room, nil
+}
+
+// SetRole changes target's role. Ownership cannot be handed out this way.
+func (s *RoomService) SetRole(ctx context.Context, actor domain.UserID, roomID domain.RoomID, target domain.UserID, role domain.Role) error {
+	if !role.Valid() || role == domain.RoleOwner {
+		return domain.ErrInvalidRole
+	}
+	member, err := s.authorizeOver(ctx, actor, roomID, domain.PermManageRoles, target)
+	if err != nil {
+		return err
+	}
+	member.Role = role
+	return s.rooms.UpdateMember(ctx, roomID, member)
+}
+
+// Subscribe attaches actor's connections to a room it already belongs to,
+// e.g. when a session is resumed.
+func (s *RoomService) Subscribe(ctx context.Context, actor domain.UserID, roomID domain.RoomID) error {
+	if _, err := s.rooms.Member(ctx, roomID, actor); err != nil {
+		return err
+	}
+	return s.gateway.JoinRoom(ctx, roomID, actor)
+}
+
+// Roster lists the members of a room with whether each is online in it.
+func (s *RoomService) Roster(ctx context.Context, actor domain.UserID, roomID domain.RoomID) ([]domain.RosterEntry, error) {
+	room, err := s.Get(ctx, actor, roomID)
+	if err != nil {
+		return nil, err
+	}
+	online, err := s.gateway.OnlineUsers(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	roster := make([]domain.RosterEntry, 0, len(room.Members))
+	for _, m := range room.Members {
+		roster = append(roster, domain.RosterEntry{
+			Member: m,
+			Online: slices.Contains(online, m.UserID),
+		})
+	}
+	return roster, nil
+}
+
+// unsubscribe detaches a former member from the room and tells the others.
+func (s *RoomService) unsubscribe(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	if err := s.gateway.LeaveRoom(ctx, roomID, userID); err != nil {
+		return err
+	}
+	return s.gateway.NotifyUserLeft(ctx, roomID, userID)
+}
+
+// evict drops a removed member from the room's call and subscriptions.
+func (s *RoomService) evict(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	if err := s.calls.Remove(ctx, roomID, userID); err != nil {
+		return err
+	}
+	return s.unsubscribe(ctx, roomID, userID)
+}
+
+// authorize loads the room and checks that actor is a member allowed to p.
+func (s *RoomService) authorize(ctx context.Context, actor domain.UserID, roomID domain.RoomID, p domain.Permission) (domain.Room, domain.Member, error) {
+	room, err := s.rooms.Get(ctx, roomID)
+	if err != nil {
+		return domain.Room{}, domain.Member{}, err
+	}
+	member, ok := room.Member(actor)
+	if !ok {
+		return domain.Room{}, domain.Member{}, domain.ErrNotMember
+	}
+	if err := member.Authorize(p); err != nil {
+		return domain.Room{}, domain.Member{}, err
+	}
+	return room, member, nil
+}
+
+// authorizeOver is authorize for actions on another member, which actor must
+// also outrank. It returns target's membership.
+func (s *RoomService) authorizeOver(ctx context.Context, actor domain.UserID, roomID domain.RoomID, p domain.Permission, target domain.UserID) (domain.Member, error) {
+	room, member, err := s.authorize(ctx, actor, roomID, p)
+	if err != nil {
+		return domain.Member{}, err
+	}
+	return outrank(room, member, p, target)
+}
+
+func outrank(room domain.Room, actor domain.Member, p domain.Permission, target domain.UserID) (domain.Member, error) {
+	other, ok := room.Member(target)
+	if !ok {
+		return domain.Member{}, domain.ErrNotMember
+	}
+	if !actor.Role.Outranks(other.Role) {
+		return domain.Member{}, &domain.PermissionError{Permission: p, Role: actor.Role, Over: other.Role}
+	}
+	return other, nil
+}
+
+func (s *RoomService) checkBan(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	banned, err := s.rooms.IsBanned(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return domain.ErrBanned
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+func TestRoomPermissions(t *testing.T) {
+	// Each action targets a guest, whom every role but guest outranks
+	actions := map[string]func(f *fixture, actor domain.UserID, roomID domain.RoomID, guest domain.UserID) error{
+		"invite": func(f *fixture, actor domain.UserID, roomID domain.RoomID, _ domain.UserID) error {
+			return f.room.Invite(f.ctx, actor, roomID, f.user("newcomer"))
+		},
+		"kick": func(f *fixture, actor domain.UserID, roomID domain.RoomID, guest domain.UserID) error {
+			return f.room.Kick(f.ctx, actor, roomID, guest)
+		},
+		"ban": func(f *fixture, actor domain.UserID, roomID domain.RoomID, guest domain.UserID) error {
+			return f.room.Ban(f.ctx, actor, roomID, guest)
+		},
+		"unban": func(f *fixture, actor domain.UserID, roomID domain.RoomID, guest domain.UserID) error {
+			return f.room.Unban(f.ctx, actor, roomID, guest)
+		},
+		"set topic": func(f *fixture, actor domain.UserID, roomID domain.RoomID, _ domain.UserID) error {
+			_, err := f.room.SetTopic(f.ctx, actor, roomID, "new topic")
+			return err
+		},
+		"set role": func(f *fixture, actor domain.UserID, roomID domain.RoomID, guest domain.UserID) error {
+			return f.room.SetRole(f.ctx, actor, roomID, guest, domain.RoleMember)
+		},
+	}
+	allowed := map[string][]domain.Role{
+		"invite":    {domain.RoleOwner, domain.RoleAdmin, domain.RoleMember},
+		"kick":      {domain.RoleOwner, domain.RoleAdmin},
+		"ban":       {domain.RoleOwner, domain.RoleAdmin},
+		"unban":     {domain.RoleOwner, domain.RoleAdmin},
+		"set topic": {domain.RoleOwner, domain.RoleAdmin},
+		"set role":  {domain.RoleOwner},
+	}
+
+	for name, action := range actions {
+		for _, role := range []domain.Role{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember, domain.RoleGuest} {
+			t.Run(name+" as "+string(role), func(t *testing.T) {
+				f := newFixture(t)
+				owner, actor, guest := f.user("owner"), f.user("actor"), f.user("guest")
+				members := map[domain.UserID]domain.Role{guest: domain.RoleGuest}
+				if role == domain.RoleOwner {
+					actor = owner
+				} else {
+					members[actor] = role
+				}
+				roomID := f.roomOf(domain.RoomGroup, owner, members)
+
+				err := action(f, actor, roomID, guest)
+				if slices.Contains(allowed[name], role) {
+					if err != nil {
+						t.Fatalf("refused: %v", err)
+					}
+				} else if !errors.Is(err, domain.ErrForbidden) {
+					t.Fatalf("err = %v, want ErrForbidden", err)
+				}
+			})
+		}
+	}
+}
+
+func TestAuthorizeOver(t *testing.T) {
+	tests := []struct {
+		name   string
+		actor  domain.Role
+		target domain.Role
+		// over is the role the refusal names when actor is outranked
+		over    domain.Role
+		allowed bool
+	}{
+		{"admin over member", domain.RoleAdmin, domain.RoleMember, "", true},
+		{"admin over guest", domain.RoleAdmin, domain.RoleGuest, "", true},
+		{"owner over admin", domain.RoleOwner, domain.RoleAdmin, "", true},
+		{"admin over admin", domain.RoleAdmin, domain.RoleAdmin, domain.RoleAdmin, false},
+		{"admin over owner", domain.RoleAdmin, domain.RoleOwner, domain.RoleOwner, false},
+		{"member without the permission", domain.RoleMember, domain.RoleGuest, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			owner, actor, target := f.user("owner"), f.user("actor"), f.user("target")
+			members := map[domain.UserID]domain.Role{}
+			switch {
+			case tt.actor == domain.RoleOwner:
+				actor = owner
+				members[target] = tt.target
+			case tt.target == domain.RoleOwner:
+				target = owner
+				members[actor] = tt.actor
+			default:
+				members[actor] = tt.actor
+				members[target] = tt.target
+			}
+			roomID := f.roomOf(domain.RoomGroup, owner, members)
+
+			err := f.room.Kick(f.ctx, actor, roomID, target)
+			if !tt.allowed {
+				var perr *domain.PermissionError
+				if !errors.As(err, &perr) || perr.Over != tt.over {
+					t.Fatalf("err = %v, want a refusal over %q", err, tt.over)
+				}
+				f.expectEvents()
+				if _, err := f.rooms.Member(f.ctx, roomID, target); err != nil {
+					t.Fatalf("refused kick removed the target: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.expectEvents("unsubscribe target", "left target")
+			if _, err := f.rooms.Member(f.ctx, roomID, target); !errors.Is(err, domain.ErrNotMember) {
+				t.Fatalf("target still a member: %v", err)
+			}
+		})
+	}
+
+	t.Run("kick a non-member", func(t *testing.T) {
+		f := newFixture(t)
+		owner, stranger := f.user("owner"), f.user("stranger")
+		roomID := f.roomOf(domain.RoomGroup, owner, nil)
+		if err := f.room.Kick(f.ctx, owner, roomID, stranger); !errors.Is(err, domain.ErrNotMember) {
+			t.Fatalf("err = %v, want ErrNotMember", err)
+		}
+	})
+
+	t.Run("ban a non-member", func(t *testing.T) {
+		f := newFixture(t)
+		owner, stranger := f.user("owner"), f.user("stranger")
+		roomID := f.roomOf(domain.RoomGroup, owner, nil)
+		if err := f.room.Ban(f.ctx, owner, roomID, stranger); err != nil {
+			t.Fatal(err)
+		}
+		f.expectEvents("unsubscribe stranger")
+		if _, err := f.room.Join(f.ctx, stranger, roomID); !errors.Is(err, domain.ErrBanned) {
+			t.Fatalf("banned user joined: err = %v", err)
+		}
+	})
+}
+
+func TestInvite(t *testing.T) {
+	f := newFixture(t)
+	owner, member, guest, carol := f.user("owner"), f.user("member"), f.user("guest"), f.user("carol")
+	roomID := f.roomOf(domain.RoomGroup, owner, map[domain.UserID]domain.Role{
+		member: domain.RoleMember,
+		guest:  domain.RoleGuest,
+	})
+
+	if err := f.room.Invite(f.ctx, member, roomID, carol); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvents("joined carol", "subscribe carol")
+	if m, err := f.rooms.Member(f.ctx, roomID, carol); err != nil || m.Role != domain.RoleMember {
+		t.Fatalf("invitee membership = %+v, %v", m, err)
+	}
+
+	banned := f.user("banned")
+	if err := f.room.Ban(f.ctx, owner, roomID, banned); err != nil {
+		t.Fatal(err)
+	}
+	f.gateway.take()
+	peer := f.user("peer")
+	direct, err := f.room.OpenDirect(f.ctx, owner, peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.gateway.take()
+
+	tests := []struct {
+		name    string
+		actor   domain.UserID
+		roomID  domain.RoomID
+		invitee domain.UserID
+		want    error
+	}{
+		{"unknown user", owner, roomID, domain.NewUserID(), domain.ErrUserNotFound},
+		{"current member", owner, roomID, carol, domain.ErrAlreadyMember},
+		{"banned user", owner, roomID, banned, domain.ErrBanned},
+		{"guest inviting", guest, roomID, f.user("dave"), domain.ErrForbidden},
+		{"outsider inviting", f.user("outsider"), roomID, f.user("erin"), domain.ErrNotMember},
+		{"direct room", owner, direct.ID, f.user("frank"), domain.ErrDirectRoom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := f.room.Invite(f.ctx, tt.actor, tt.roomID, tt.invitee); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			f.expectEvents()
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Wyydra/ya/backend/internal/adapter/driven/persistence/memory"
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+// recordingGateway records what the services send, with users named as in
+// the fixture.
+type recordingGateway struct {
+	name func(domain.UserID) string
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (g *recordingGateway) record(format string, args ...any) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.events = append(g.events, fmt.Sprintf(format, args...))
+	return nil
+}
+
+// take returns the events recorded since the last call.
+func (g *recordingGateway) take() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	events := g.events
+	g.events = nil
+	return events
+}
+
+func (g *recordingGateway) BroadcastMessage(ctx context.Context, msg domain.Message) error {
+	return g.record("message %s", msg.Content)
+}
+
+func (g *recordingGateway) SendMessage(ctx context.Context, userIDs []domain.UserID, msg domain.Message) error {
+	return g.record("message %s to %d users", msg.Content, len(userIDs))
+}
+
+func (g *recordingGateway) BroadcastUpdate(ctx context.Context, msg domain.Message) error {
+	return g.record("update %q", msg.Content)
+}
+
+func (g *recordingGateway) SendUpdate(ctx context.Context, userIDs []domain.UserID, msg domain.Message) error {
+	return g.record("update %q to %d users", msg.Content, len(userIDs))
+}
+
+func (g *recordingGateway) SendSignal(ctx context.Context, roomID domain.RoomID, userID domain.UserID, signal domain.Signal) error {
+	return g.record("signal %s", g.name(userID))
+}
+
+func (g *recordingGateway) EndCall(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	return g.record("end call %s", g.name(userID))
+}
+
+func (g *recordingGateway) SendTyping(ctx context.Context, typing domain.Typing) error {
+	return g.record("typing %s %t", g.name(typing.UserID), typing.Typing)
+}
+
+func (g *recordingGateway) SendReceipt(ctx context.Context, marker domain.ReadMarker) error {
+	return g.record("receipt %s %d", g.name(marker.UserID), marker.Seq)
+}
+
+func (g *recordingGateway) SendReaction(ctx context.Context, change domain.ReactionChange) error {
+	if change.Added {
+		return g.record("react %s %s", g.name(change.UserID), change.Emoji)
+	}
+	return g.record("unreact %s %s", g.name(change.UserID), change.Emoji)
+}
+
+func (g *recordingGateway) NotifyUserJoined(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	return g.record("joined %s", g.name(userID))
+}
+
+func (g *recordingGateway) NotifyUserLeft(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	return g.record("left %s", g.name(userID))
+}
+
+func (g *recordingGateway) OnlineUsers(ctx context.Context, roomID domain.RoomID) ([]domain.UserID, error) {
+	return nil, nil
+}
+
+func (g *recordingGateway) JoinRoom(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	return g.record("subscribe %s", g.name(userID))
+}
+
+func (g *recordingGateway) LeaveRoom(ctx context.Context, roomID domain.RoomID, userID domain.UserID) error {
+	return g.record("unsubscribe %s", g.name(userID))
+}
+
+func (g *recordingGateway) FollowThread(ctx context.Context, roomID domain.RoomID, rootID domain.MessageID, userID domain.UserID) error {
+	return g.record("follow %s", g.name(userID))
+}
+
+func (g *recordingGateway) UnfollowThread(ctx context.Context, rootID domain.MessageID, userID domain.UserID) error {
+	return g.record("unfollow %s", g.name(userID))
+}
+
+// fakeMedia keeps the peers of each call and their mute state.
+type fakeMedia struct {
+	mu    sync.Mutex
+	peers map[domain.SessionID]map[domain.UserID]bool // user -> muted
+}
+
+func (m *fakeMedia) AddPeer(sessionID domain.SessionID, userID domain.UserID) (domain.Signal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.peers[sessionID] == nil {
+		m.peers[sessionID] = make(map[domain.UserID]bool)
+	}
+	m.peers[sessionID][userID] = false
+	return domain.NewSignal(domain.SignalOffer, "offer"), nil
+}
+
+func (m *fakeMedia) HandleSignal(domain.SessionID, domain.UserID, domain.Signal) error { return nil }
+
+func (m *fakeMedia) RemovePeer(sessionID domain.SessionID, userID domain.UserID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.peers[sessionID][userID]
+	delete(m.peers[sessionID], userID)
+	return ok
+}
+
+func (m *fakeMedia) SetMuted(sessionID domain.SessionID, userID domain.UserID, muted bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.peers[sessionID][userID]; !ok {
+		return domain.ErrNotInCall
+	}
+	m.peers[sessionID][userID] = muted
+	return nil
+}
+
+func (m *fakeMedia) muted(roomID domain.RoomID, userID domain.UserID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.peers[domain.SessionID(roomID.String())][userID]
+}
+
+func (m *fakeMedia) SetSignalCallback(func(domain.SessionID, domain.UserID, domain.Signal)) {}
+
+// fixture runs the services over the memory adapters.
+type fixture struct {
+	t   *testing.T
+	ctx context.Context
+
+	users   *memory.UserRepository
+	rooms   *memory.RoomRepository
+	msgs    *memory.MessageRepository
+	gateway *recordingGateway
+	media   *fakeMedia
+
+	room  *RoomService
+	chat  *ChatService
+	calls *CallService
+
+	names map[domain.UserID]string
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{
+		t:     t,
+		ctx:   context.Background(),
+		users: memory.NewUserRepository(),
+		rooms: memory.NewRoomRepository(),
+		msgs:  memory.NewMessageRepository(),
+		media: &fakeMedia{peers: make(map[domain.SessionID]map[domain.UserID]bool)},
+		names: make(map[domain.UserID]string),
+	}
+	f.gateway = &recordingGateway{name: func(id domain.UserID) string { return f.names[id] }}
+	f.calls = NewCallService(f.media, f.rooms, f.gateway)
+	f.room = NewRoomService(f.rooms, f.users, f.gateway, f.calls)
+	f.chat = NewChatService(f.msgs, f.users, f.rooms, memory.NewReadMarkerRepository(), memory.NewReactionRepository(), nil, nil, f.gateway, DefaultAttachmentConfig())
+	return f
+}
+
+// user registers a user called name.
+func (f *fixture) user(name string) domain.UserID {
+	f.t.Helper()
+	u, err := domain.NewUser(name, "")
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err := f.users.Create(f.ctx, *u, nil); err != nil {
+		f.t.Fatal(err)
+	}
+	f.names[u.ID] = name
+	return u.ID
+}
+
+// roomOf creates a room of kind owned by owner, with the other members
+// holding the given roles, and forgets the events it caused.
+func (f *fixture) roomOf(kind domain.RoomKind, owner domain.UserID, members map[domain.UserID]domain.Role) domain.RoomID {
+	f.t.Helper()
+	room, err := f.room.Create(f.ctx, owner, "room", "", kind)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	for userID, role := range members {
+		if err := f.rooms.AddMember(f.ctx, room.ID, domain.NewMember(userID, role)); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	f.gateway.take()
+	return room.ID
+}
+
+// send posts a message as sender and forgets the events it caused.
+func (f *fixture) send(sender domain.UserID, roomID domain.RoomID, content string) domain.Message {
+	f.t.Helper()
+	msg, err := f.chat.SendMessage(f.ctx, sender, roomID, content)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.gateway.take()
+	return msg
+}
+
+// expectEvents fails unless the gateway recorded want since the last take.
+func (f *fixture) expectEvents(want ...string) {
+	f.t.Helper()
+	if got := f.gateway.take(); !slices.Equal(got, want) {
+		f.t.Fatalf("gateway events = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+const (
+	// TypingThrottle is the minimum delay between two "typing" events of the
+	// same user in a room, updates in between only extend the indicator.
+	TypingThrottle = 3 * time.Second
+	// TypingTimeout ends an indicator that has not been updated.
+	TypingTimeout = 5 * time.Second
+)
+
+type typingKey struct {
+	roomID domain.RoomID
+	userID domain.UserID
+}
+
+type typingState struct {
+	announced time.Time
+	updated   time.Time
+	expiry    *time.Timer
+}
+
+// typingTracker keeps who is typing where, in memory only.
+type typingTracker struct {
+	mu     sync.Mutex
+	active map[typingKey]*typingState
+	// throttle and timeout are TypingThrottle and TypingTimeout
+	throttle time.Duration
+	timeout  time.Duration
+	// expired is called, without the lock, when an indicator times out
+	expired func(domain.Typing)
+}
+
+func newTypingTracker(expired func(domain.Typing)) *typingTracker {
+	return &typingTracker{
+		active:   make(map[typingKey]*typingState),
+		throttle: TypingThrottle,
+		timeout:  TypingTimeout,
+		expired:  expired,
+	}
+}
+
+// start records that the user is typing and reports whether the room should
+// be told.
+func (t *typingTracker) start(key typingKey) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	st, ok := t.active[key]
+	if !ok {
+		st = &typingState{}
+		st.expiry = time.AfterFunc(t.timeout, func() { t.expire(key, st) })
+		t.active[key] = st
+	} else {
+		st.expiry.Reset(t.timeout)
+	}
+	st.updated = now
+	if now.Sub(st.announced) < t.throttle {
+		return false
+	}
+	st.announced = now
+	return true
+}
+
+// stop forgets the indicator and reports whether there was one.
+func (t *typingTracker) stop(key typingKey) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.active[key]
+	if !ok {
+		return false
+	}
+	st.expiry.Stop()
+	delete(t.active, key)
+	return true
+}
+
+func (t *typingTracker) expire(key typingKey, st *typingState) {
+	t.mu.Lock()
+	// The timer may fire right before being reset or replaced
+	if t.active[key] != st || time.Since(st.updated) < t.timeout {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.active, key)
+	t.mu.Unlock()
+
+	t.expired(domain.NewTyping(key.roomID, key.userID, false))
+}
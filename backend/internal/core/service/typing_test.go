@@ -0,0 +1,102 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+)
+
+// newTestTracker returns a tracker with short delays, sending expiries on
+// the returned channel.
+func newTestTracker(throttle, timeout time.Duration) (*typingTracker, chan domain.Typing) {
+	expired := make(chan domain.Typing, 4)
+	t := newTypingTracker(func(typing domain.Typing) { expired <- typing })
+	t.throttle, t.timeout = throttle, timeout
+	return t, expired
+}
+
+func TestTypingDelays(t *testing.T) {
+	tracker := newTypingTracker(nil)
+	if tracker.throttle != 3*time.Second || tracker.timeout != 5*time.Second {
+		t.Fatalf("throttle %v and timeout %v, want 3s and 5s", tracker.throttle, tracker.timeout)
+	}
+}
+
+func TestTypingThrottle(t *testing.T) {
+	tracker, _ := newTestTracker(50*time.Millisecond, time.Minute)
+	key := typingKey{domain.NewRoomID(), domain.NewUserID()}
+
+	if !tracker.start(key) {
+		t.Fatal("first start not announced")
+	}
+	if tracker.start(key) {
+		t.Fatal("start within the throttle announced")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !tracker.start(key) {
+		t.Fatal("start after the throttle not announced")
+	}
+	if !tracker.stop(key) {
+		t.Fatal("stop of an active indicator not announced")
+	}
+	if tracker.stop(key) {
+		t.Fatal("second stop announced")
+	}
+	// A stop resets the throttle
+	if !tracker.start(key) {
+		t.Fatal("start after a stop not announced")
+	}
+}
+
+func TestTypingExpiry(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	tracker, expired := newTestTracker(time.Minute, timeout)
+	key := typingKey{domain.NewRoomID(), domain.NewUserID()}
+
+	begin := time.Now()
+	tracker.start(key)
+	// Updates before the timeout keep the indicator alive
+	time.Sleep(timeout / 2)
+	tracker.start(key)
+	time.Sleep(timeout / 2)
+	tracker.start(key)
+
+	select {
+	case typing := <-expired:
+		if typing.Typing || typing.RoomID != key.roomID || typing.UserID != key.userID {
+			t.Fatalf("expired with %+v", typing)
+		}
+		if elapsed := time.Since(begin); elapsed < 2*timeout {
+			t.Fatalf("expired after %v despite updates", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("indicator did not expire")
+	}
+	if tracker.stop(key) {
+		t.Fatal("expired indicator still active")
+	}
+
+	// A stopped indicator never expires
+	tracker.start(key)
+	tracker.stop(key)
+	select {
+	case typing := <-expired:
+		t.Fatalf("stopped indicator expired with %+v", typing)
+	case <-time.After(2 * timeout):
+	}
+}
+
+func TestSetTypingExpires(t *testing.T) {
+	f := newFixture(t)
+	alice, bob := f.user("alice"), f.user("bob")
+	roomID := f.roomOf(domain.RoomGroup, alice, map[domain.UserID]domain.Role{bob: domain.RoleMember})
+	f.chat.typing.timeout = 50 * time.Millisecond
+
+	if err := f.chat.SetTyping(f.ctx, bob, roomID, true); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvents("typing bob true")
+	time.Sleep(150 * time.Millisecond)
+	f.expectEvents("typing bob false")
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Wyydra/ya/backend/internal/core/domain"
+	"github.com/Wyydra/ya/backend/internal/core/port"
+)
+
+var ErrRegistrationDisabled = errors.New("registration is disabled")
+
+type UserService struct {
+	users  port.UserRepository
+	hasher port.PasswordHasher
+	// provisioned caches the users known to have a profile
+	provisioned sync.Map // domain.UserID -> struct{}
+}
+
+// NewUserService returns the user service; a nil hasher disables password
+// registration.
+func NewUserService(users port.UserRepository, hasher port.PasswordHasher) *UserService {
+	return &UserService{
+		users:  users,
+		hasher: hasher,
+	}
+}
+
+func (s *UserService) Register(ctx context.Context, username, password, displayName string) (*domain.User, error) {
+	if s.hasher == nil {
+		return nil, ErrRegistrationDisabled
+	}
+	user, err := domain.NewUser(username, displayName)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) < domain.MinPasswordLength {
+		return nil, domain.ErrWeakPassword
+	}
+	if len(password) > domain.MaxPasswordLength {
+		return nil, domain.ErrPasswordTooLong
+	}
+	hash, err := s.hasher.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.Create(ctx, *user, hash); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Provision creates the profile of an authenticated user on their first sign
+// in, for users of providers that keep no profile here (identity providers,
+// users files).
+func (s *UserService) Provision(ctx context.Context, identity domain.Identity) error {
+	if _, ok := s.provisioned.Load(identity.UserID); ok {
+		return nil
+	}
+	_, err := s.users.Get(ctx, identity.UserID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		user := domain.NewUserFromIdentity(identity)
+		err = s.users.Create(ctx, *user, nil)
+		if errors.Is(err, domain.ErrUsernameTaken) {
+			// Either a concurrent request of the same user won, or the
+			// suggested name belongs to someone else
+			if _, err = s.users.Get(ctx, identity.UserID); errors.Is(err, domain.ErrUserNotFound) {
+				user.Username = domain.FallbackUsername(identity.UserID)
+				err = s.users.Create(ctx, *user, nil)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.provisioned.Store(identity.UserID, struct{}{})
+	return nil
+}
+
+func (s *UserService) Get(ctx context.Context, id domain.UserID) (domain.User, error) {
+	return s.users.Get(ctx, id)
+}
+
+// ProfileUpdate holds the profile fields to change; nil fields are kept.
+type ProfileUpdate struct {
+	DisplayName *string
+	AvatarRef   *string
+	Status      *domain.UserStatus
+	StatusText  *string
+}
+
+func (s *UserService) UpdateProfile(ctx context.Context, id domain.UserID, upd ProfileUpdate) (domain.User, error) {
+	user, err := s.users.Get(ctx, id)
+	if err != nil {
+		return user, err
+	}
+
+	if upd.DisplayName != nil {
+		if err := domain.ValidateDisplayName(*upd.DisplayName); err != nil {
+			return user, err
+		}
+		user.DisplayName = *upd.DisplayName
+	}
+	if upd.AvatarRef != nil {
+		if err := domain.ValidateAvatarRef(*upd.AvatarRef); err != nil {
+			return user, err
+		}
+		user.AvatarRef = *upd.AvatarRef
+	}
+	if upd.Status != nil {
+		if !upd.Status.Valid() {
+			return user, domain.ErrInvalidStatus
+		}
+		user.Status = *upd.Status
+	}
+	if upd.StatusText != nil {
+		if err := domain.ValidateStatusText(*upd.StatusText); err != nil {
+			return user, err
+		}
+		user.StatusText = *upd.StatusText
+	}
+
+	if err := s.users.Update(ctx, user); err != nil {
+		return user, err
+	}
+	return user, nil
+}
@@ -6,12 +6,37 @@ class YaClient {
         this.pc = null;
         this.localStream = null;
         this.isVoiceConnected = false;
+        this.roomID = this.resolveRoomID();
+        this.sessionToken = sessionStorage.getItem('ya-session');
+        // Bearer token from POST /auth/login, when the server requires one
+        this.accessToken = localStorage.getItem('ya-token');
+        this.lastSeq = 0;
+        // Members of the current room: user id -> online
+        this.roster = new Map();
+        // Members typing in the current room, and when we last said we were
+        this.typers = new Set();
+        this.lastTypingSent = 0;
+        // Newest displayed message not yet reported read, see markRead
+        this.unreadMessage = null;
+        this.markReadTimer = null;
+        // Message whose thread the next message replies in, picked by
+        // clicking it; Escape goes back to the room
+        this.replyTo = null;
+        // Displayed messages by id, and their reactions: emoji -> user ids
+        this.displayed = new Map();
+        this.reactions = new Map();
+        this.userID = null;
+        // Requests awaiting their ack: id -> { resolve, reject }
+        this.pending = new Map();
+        this.nextRequestID = 1;
 
         // UI References
         this.ui = {
             messages: document.getElementById('messages'),
             input: document.getElementById('chat-input'),
             form: document.getElementById('chat-form'),
+            attachBtn: document.getElementById('attach-btn'),
+            fileInput: document.getElementById('file-input'),
             joinBtn: document.getElementById('join-btn'),
             videoGrid: document.getElementById('video-section'),
             localVideo: document.getElementById('local-video'),
@@ -26,11 +51,55 @@ class YaClient {
             e.preventDefault();
             const text = this.ui.input.value.trim();
             if (text) {
-                this.sendJSON({ content: text }); // Chat message
+                const req = { room_id: this.roomID, content: text };
+                if (this.replyTo) req.parent_id = this.replyTo;
+                this.request('send_message', req)
+                    .then(msg => this.receiveChatMessage(msg))
+                    .catch(err => this.logSystem(`Could not send: ${err.message}`));
                 this.ui.input.value = '';
+                this.lastTypingSent = 0;
+                this.setReplyTo(null);
             }
         });
 
+        this.ui.attachBtn.addEventListener('click', () => this.ui.fileInput.click());
+        this.ui.fileInput.addEventListener('change', () => {
+            if (this.ui.fileInput.files.length) this.uploadFiles(this.ui.fileInput.files);
+            this.ui.fileInput.value = '';
+        });
+
+        this.ui.messages.addEventListener('click', (e) => {
+            const el = e.target.closest('.message');
+            if (!el) return;
+            this.setReplyTo(el.id.slice('msg-'.length));
+            this.ui.input.focus();
+        });
+
+        // Double-click toggles a thumbs up
+        this.ui.messages.addEventListener('dblclick', (e) => {
+            const el = e.target.closest('.message');
+            if (!el) return;
+            const id = el.id.slice('msg-'.length);
+            const mine = this.reactions.get(id)?.get('👍')?.has(this.userID);
+            this.request(mine ? 'unreact' : 'react', { room_id: this.roomID, message_id: id, emoji: '👍' })
+                .catch(err => this.logSystem(`Could not react: ${err.message}`));
+        });
+
+        this.ui.input.addEventListener('keydown', (e) => {
+            if (e.key === 'Escape') this.setReplyTo(null);
+        });
+
+        document.addEventListener('visibilitychange', () => {
+            if (this.unreadMessage) this.markRead(this.unreadMessage);
+        });
+
+        this.ui.input.addEventListener('input', () => {
+            const now = Date.now();
+            if (!this.ui.input.value || now - this.lastTypingSent < 2000) return;
+            this.lastTypingSent = now;
+            this.request('typing', { room_id: this.roomID }).catch(() => {});
+        });
+
         this.ui.joinBtn.addEventListener('click', () => {
             if (!this.isVoiceConnected) {
                 this.joinVoice();
@@ -45,16 +114,23 @@ class YaClient {
     connectWS() {
         const proto = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
         const url = `${proto}//${window.location.host}/ws`;
+        // Credentials travel as extra subprotocols to stay out of the URL
+        const protocols = ['ya.v1']; // See backend/PROTOCOL.md
+        if (this.sessionToken) protocols.push(`ya.session.${this.sessionToken}`);
+        if (this.accessToken) protocols.push(`ya.bearer.${this.accessToken}`);
 
         console.log(`Connecting to ${url}`);
-        this.socket = new WebSocket(url);
+        this.socket = new WebSocket(url, protocols);
 
         this.socket.onopen = () => {
             this.logSystem('Connected to server via WebSocket.');
         };
 
         this.socket.onclose = () => {
-            this.logSystem('Disconnected from server.');
+            this.pending.forEach(p => p.reject(new Error('disconnected')));
+            this.pending.clear();
+            this.logSystem('Disconnected from server. Reconnecting...');
+            setTimeout(() => this.connectWS(), 2000);
         };
 
         this.socket.onerror = (err) => {
@@ -65,30 +141,272 @@ class YaClient {
         this.socket.onmessage = (e) => this.handleMessage(e);
     }
 
+    // The room lives in the URL hash so it can be shared: /#<room-id>.
+    // Without one a new room is created once connected.
+    resolveRoomID() {
+        return window.location.hash.slice(1) || null;
+    }
+
     handleMessage(event) {
+        let env;
         try {
-            const msg = JSON.parse(event.data);
-
-            if (msg.type === 'signal') {
-                if (!msg.payload) {
-                    console.error("Signal payload is missing! Server might be sending wrong key.");
+            env = JSON.parse(event.data);
+        } catch (err) {
+            console.error("Failed to parse frame:", event.data, err);
+            return;
+        }
+        const payload = env.payload;
+
+        switch (env.type) {
+            case 'ack':
+            case 'error': {
+                const pending = this.pending.get(env.id);
+                if (!pending) {
+                    if (env.type === 'error') this.logSystem(`Error: ${payload.message}`);
                     return;
                 }
-                this.handleSignal(msg.payload);
-            } else if (msg.sender_id) {
-                this.addChatMessage(msg.sender_id, msg.content);
+                this.pending.delete(env.id);
+                if (env.type === 'ack') {
+                    pending.resolve(payload);
+                } else {
+                    pending.reject(new Error(payload.message));
+                }
+                break;
             }
+            case 'session':
+                this.handleSession(payload);
+                break;
+            case 'room':
+                this.handleRoom(payload);
+                break;
+            case 'message':
+                this.receiveChatMessage(payload);
+                break;
+            case 'message_update':
+                this.handleMessageUpdate(payload);
+                break;
+            case 'history':
+                payload.messages.forEach(m => this.receiveChatMessage(m));
+                break;
+            case 'signal':
+                this.handleSignal(payload);
+                break;
+            case 'presence':
+                this.handlePresence(payload);
+                break;
+            case 'typing':
+                this.handleTyping(payload);
+                break;
+            case 'reaction':
+                this.handleReaction(payload);
+                break;
+            default:
+                console.warn("Unknown frame type:", env.type);
+        }
+    }
+
+    handleSession(session) {
+        this.sessionToken = session.token;
+        this.userID = session.user_id;
+        sessionStorage.setItem('ya-session', session.token);
+
+        let entered;
+        if (session.resumed) {
+            // Ask the server for everything we missed while disconnected
+            entered = this.request('resume', { last_seq: { [this.roomID]: this.lastSeq } });
+        } else if (this.roomID) {
+            entered = this.request('join', { room_id: this.roomID }).then(room => this.handleRoom(room));
+        } else {
+            entered = this.request('create_room', { name: "New room" }).then(room => this.handleRoom(room));
+        }
+        entered.catch(err => this.logSystem(`Could not enter the room: ${err.message}`));
+    }
+
+    handleRoom(room) {
+        this.roomID = room.id;
+        window.location.hash = room.id;
+        this.logSystem(`Joined ${room.name} (${room.members.length} members).`);
+        this.request('presence', { room_id: this.roomID }).then(roster => {
+            this.roster = new Map(roster.members.map(m => [m.user_id, m.online]));
+            const online = roster.members.filter(m => m.online).length;
+            this.logSystem(`${online} of ${roster.members.length} members online.`);
+        });
+        // Load scrollback
+        return this.request('history', { room_id: this.roomID })
+            .then(history => history.messages.forEach(m => this.receiveChatMessage(m)));
+    }
+
+    handlePresence(p) {
+        if (p.room_id !== this.roomID) return;
+        switch (p.kind) {
+            case 'join':
+                this.roster.set(p.user_id, this.roster.get(p.user_id) || false);
+                this.logSystem(`${p.user_id} joined the room.`);
+                break;
+            case 'leave':
+                this.roster.delete(p.user_id);
+                this.logSystem(`${p.user_id} left the room.`);
+                break;
+            case 'online':
+            case 'offline':
+                this.roster.set(p.user_id, p.kind === 'online');
+                break;
+        }
+    }
+
+    handleTyping(t) {
+        if (t.room_id !== this.roomID) return;
+        if (t.typing) {
+            this.typers.add(t.user_id);
+        } else {
+            this.typers.delete(t.user_id);
+        }
+        this.renderTypers();
+    }
+
+    renderTypers() {
+        const n = this.typers.size;
+        const idle = this.replyTo ? 'Reply in thread...' : 'Type a message...';
+        this.ui.input.placeholder = n === 0 ? idle : n === 1 ? 'Someone is typing...' : `${n} people are typing...`;
+    }
+
+    setReplyTo(messageID) {
+        this.replyTo = messageID;
+        this.renderTypers();
+    }
+
+    receiveChatMessage(msg) {
+        if (msg.room_id !== this.roomID || msg.seq <= this.lastSeq) {
+            return; // Other room, or already displayed
+        }
+        if (this.typers.delete(msg.sender_id)) this.renderTypers();
+        this.lastSeq = msg.seq;
+        this.remember(msg);
+        this.addChatMessage(msg.sender ? msg.sender.display_name : msg.sender_id, this.messageText(msg), msg.id, !!msg.parent_id);
+        this.renderAttachments(msg);
+        this.markRead(msg);
+    }
+
+    // uploadFiles sends the files over HTTP, along with the typed text and in
+    // the selected thread, the message comes back like any other.
+    async uploadFiles(files) {
+        const form = new FormData();
+        for (const file of files) form.append('file', file);
+        const text = this.ui.input.value.trim();
+        if (text) form.append('content', text);
+        if (this.replyTo) form.append('parent_id', this.replyTo);
+
+        const headers = {};
+        if (this.accessToken) headers['Authorization'] = `Bearer ${this.accessToken}`;
+        try {
+            const res = await fetch(`/rooms/${this.roomID}/attachments`, { method: 'POST', headers, body: form });
+            const body = await res.json();
+            if (!res.ok) throw new Error(body.error || res.statusText);
+            this.receiveChatMessage(body);
+            this.ui.input.value = '';
+            this.setReplyTo(null);
         } catch (err) {
-            console.error("Failed to parse message:", event.data, err);
+            this.logSystem(`Could not upload: ${err.message}`);
         }
     }
 
-    sendJSON(obj) {
-        if (this.socket && this.socket.readyState === WebSocket.OPEN) {
-            this.socket.send(JSON.stringify(obj));
+    // An edited or deleted message: patch it in place if it is displayed
+    handleMessageUpdate(msg) {
+        if (!this.displayed.has(msg.id)) return;
+        this.remember(msg);
+        this.renderMessage(msg.id);
+    }
+
+    handleReaction(r) {
+        if (!this.displayed.has(r.message_id)) return;
+        const byEmoji = this.reactions.get(r.message_id);
+        const users = byEmoji.get(r.emoji) || new Set();
+        if (r.added) {
+            users.add(r.user_id);
+        } else {
+            users.delete(r.user_id);
+        }
+        if (users.size) {
+            byEmoji.set(r.emoji, users);
         } else {
+            byEmoji.delete(r.emoji);
+        }
+        this.renderMessage(r.message_id);
+    }
+
+    remember(msg) {
+        this.displayed.set(msg.id, msg);
+        this.reactions.set(msg.id, new Map((msg.reactions || []).map(r => [r.emoji, new Set(r.user_ids)])));
+    }
+
+    renderMessage(id) {
+        const el = document.getElementById(`msg-${id}`);
+        if (!el) return;
+        el.querySelector('.content').textContent = this.messageText(this.displayed.get(id));
+        this.renderAttachments(this.displayed.get(id));
+    }
+
+    // Images are shown inline, other files as download links
+    renderAttachments(msg) {
+        const el = document.getElementById(`msg-${msg.id}`);
+        if (!el) return;
+        el.querySelector('.attachments')?.remove();
+        if (!msg.attachments?.length) return;
+
+        const list = document.createElement('div');
+        list.className = 'attachments';
+        for (const a of msg.attachments) {
+            const link = document.createElement('a');
+            link.href = a.url;
+            link.target = '_blank';
+            link.rel = 'noopener';
+            if (a.content_type.startsWith('image/')) {
+                const img = document.createElement('img');
+                img.src = a.thumbnail_url || a.url;
+                img.alt = a.name;
+                img.title = a.width ? `${a.name} (${a.width}×${a.height})` : a.name;
+                link.appendChild(img);
+            } else {
+                link.textContent = `📎 ${a.name} (${Math.ceil(a.size / 1024)} KB)`;
+            }
+            list.appendChild(link);
+        }
+        el.appendChild(list);
+    }
+
+    messageText(msg) {
+        let text = msg.deleted ? '(message deleted)' : msg.content;
+        if (msg.edited_at && !msg.deleted) text += ' (edited)';
+        if (msg.reply_count) text += ` (${msg.reply_count} ${msg.reply_count === 1 ? 'reply' : 'replies'})`;
+        for (const [emoji, users] of this.reactions.get(msg.id) || []) {
+            text += ` ${emoji} ${users.size}`;
+        }
+        return text;
+    }
+
+    // markRead reports displayed messages as read, at most once a second.
+    markRead(msg) {
+        this.unreadMessage = msg;
+        if (this.markReadTimer || document.visibilityState !== 'visible') return;
+        this.markReadTimer = setTimeout(() => {
+            this.markReadTimer = null;
+            const m = this.unreadMessage;
+            this.unreadMessage = null;
+            if (m) this.request('mark_read', { room_id: m.room_id, message_id: m.id }).catch(() => {});
+        }, 1000);
+    }
+
+    // request sends a typed request and resolves with the payload of its ack.
+    request(type, payload) {
+        if (!this.socket || this.socket.readyState !== WebSocket.OPEN) {
             this.logSystem("Cannot send: disconnected.");
+            return Promise.reject(new Error('disconnected'));
         }
+        const id = String(this.nextRequestID++);
+        return new Promise((resolve, reject) => {
+            this.pending.set(id, { resolve, reject });
+            this.socket.send(JSON.stringify({ v: 1, type, id, payload }));
+        });
     }
 
     // --- WebRTC Core ---
@@ -111,7 +429,8 @@ class YaClient {
             this.ui.joinBtn.classList.replace('btn-green', 'btn-red');
 
             // 2. Send 'join_call' to server => Server sends Offer
-            this.sendJSON({ type: "join_call" });
+            this.request('join_call', { room_id: this.roomID })
+                .catch(err => this.logSystem(`Could not join the call: ${err.message}`));
             this.logSystem("Joining call...");
 
         } catch (err) {
@@ -121,22 +440,22 @@ class YaClient {
     }
 
     async handleSignal(signal) {
-        console.log("Received Signal:", signal.Type);
+        console.log("Received Signal:", signal.type);
 
         if (!this.pc) this.createPeerConnection();
 
         try {
-            switch (signal.Type) {
+            switch (signal.type) {
                 case 'offer':
-                    await this.handleOffer(signal.Payload);
+                    await this.handleOffer(signal.sdp);
                     break;
                 case 'candidate':
-                    await this.handleCandidate(signal.Payload);
+                    await this.pc.addIceCandidate(signal.candidate);
                     break;
                 case 'answer':
                     // We are usually the answerer in this flow (Server offers), 
                     // but if we were offering, we'd handle answer here.
-                    await this.pc.setRemoteDescription({ type: 'answer', sdp: signal.Payload });
+                    await this.pc.setRemoteDescription({ type: 'answer', sdp: signal.sdp });
                     break;
             }
         } catch (err) {
@@ -217,7 +536,7 @@ class YaClient {
         // 3. Handle ICE Candidates
         this.pc.onicecandidate = (event) => {
             if (event.candidate) {
-                this.sendSignal('candidate', JSON.stringify(event.candidate));
+                this.sendSignal({ type: 'candidate', candidate: event.candidate.toJSON() });
             }
         };
 
@@ -231,34 +550,20 @@ class YaClient {
         await this.pc.setRemoteDescription({ type: 'offer', sdp: sdp });
         const answer = await this.pc.createAnswer();
         await this.pc.setLocalDescription(answer);
-        this.sendSignal('answer', answer.sdp);
-    }
-
-    async handleCandidate(candidateJSON) {
-        if (!candidateJSON) return;
-        const candidate = JSON.parse(candidateJSON);
-        await this.pc.addIceCandidate(candidate);
+        this.sendSignal({ type: 'answer', sdp: answer.sdp });
     }
 
-    sendSignal(type, payload) {
-        // Wrap in the format expected by the backend
-        // Backend expects: { type: "signal", payload: "{ type: 'answer', payload: '...' }" }
-        const innerPayload = JSON.stringify({
-            type: type,
-            payload: payload
-        });
-
-        this.sendJSON({
-            type: "signal",
-            payload: innerPayload
-        });
+    sendSignal(signal) {
+        this.request('signal', { room_id: this.roomID, ...signal })
+            .catch(err => console.error("Signal rejected:", err));
     }
 
     // --- UI Helpers ---
 
-    addChatMessage(sender, text) {
+    addChatMessage(sender, text, id, reply) {
         const div = document.createElement('div');
-        div.className = 'message';
+        div.className = reply ? 'message reply' : 'message';
+        if (id) div.id = `msg-${id}`;
         div.innerHTML = `<div class="author">${sender}</div><div class="content">${this.escapeHtml(text)}</div>`;
         this.ui.messages.appendChild(div);
         this.ui.messages.scrollTop = this.ui.messages.scrollHeight;
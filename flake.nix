@@ -46,7 +46,7 @@
           nativeBuildInputs = with pkgs; [ pkg-config ];
           buildInputs = with pkgs; [ gtk3 webkitgtk_4_1 typescript typescript-language-server ];
           packages = with pkgs; [
-            just
+            just minio minio-client
             go gopls gotools resterm wails
             jdk17 gradle_8 android-tools
           ];